@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// runAckCommand is `marathon-alerts ack`, which acks an open alert through the HTTP
+// API of a running marathon-alerts. It returns the exit code.
+func runAckCommand(args []string, output io.Writer) int {
+	flags := flag.NewFlagSet("marathon-alerts ack", flag.ContinueOnError)
+	flags.SetOutput(output)
+	api := flags.String("api", "http://localhost:8000", "URL of the marathon-alerts HTTP API (see --http-address)")
+	var request ackRequest
+	flags.StringVar(&request.Cluster, "cluster", "", "Cluster of the app, when marathon-alerts watches more than one")
+	flags.StringVar(&request.App, "app", "", "App with the open alert, like /foo")
+	flags.StringVar(&request.CheckName, "check", "", "Check with the open alert, like min-healthy")
+	flags.StringVar(&request.User, "user", os.Getenv("USER"), "Who is acking the alert")
+	flags.StringVar(&request.Comment, "comment", "", "What you're doing about it")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if request.App == "" || request.CheckName == "" || request.User == "" {
+		fmt.Fprintln(output, "Expected --app, --check and --user to be set")
+		return 2
+	}
+
+	err = postAck(strings.TrimSuffix(*api, "/")+"/api/acks", request)
+	if err != nil {
+		fmt.Fprintf(output, "%v\n", err)
+		return 1
+	}
+	fmt.Fprintf(output, "Acked %s on %s\n", request.CheckName, request.App)
+	return 0
+}
+
+func postAck(url string, request ackRequest) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: (30 * time.Second)}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		var response errorResponse
+		json.NewDecoder(resp.Body).Decode(&response)
+		return fmt.Errorf("Expected 201 from %s but got %d - %s", url, resp.StatusCode, response.Error)
+	}
+	return nil
+}
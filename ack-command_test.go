@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAckCommand(t *testing.T) {
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+	}
+	mgr.processCheck(checks.AppCheck{Cluster: "prod", App: "/foo", CheckName: "min-healthy", Result: checks.Warning})
+	apiServer := APIServer{Snoozer: NewSnoozer(), AlertManager: &mgr}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	var output bytes.Buffer
+	exitCode := runAckCommand([]string{"--api", server.URL, "--cluster", "prod", "--app", "/foo", "--check", "min-healthy", "--user", "ashwanthkumar", "--comment", "Scaling up"}, &output)
+	assert.Equal(t, 0, exitCode, output.String())
+	assert.Equal(t, "Scaling up", mgr.Acks["prod:/foo-min-healthy-2"].Comment)
+
+	output.Reset()
+	exitCode = runAckCommand([]string{"--api", server.URL, "--app", "/bar", "--check", "min-healthy", "--user", "ashwanthkumar"}, &output)
+	assert.Equal(t, 1, exitCode)
+	assert.Contains(t, output.String(), "No open alert for app /bar and check min-healthy")
+
+	exitCode = runAckCommand([]string{"--api", server.URL, "--app", "/foo"}, &output)
+	assert.Equal(t, 2, exitCode)
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,106 +13,318 @@ import (
 	"github.com/ashwanthkumar/marathon-alerts/checks"
 	"github.com/ashwanthkumar/marathon-alerts/notifiers"
 	"github.com/ashwanthkumar/marathon-alerts/routes"
+	"github.com/ashwanthkumar/marathon-alerts/state"
 	"github.com/rcrowley/go-metrics"
 )
 
 const (
-	AlertsEnabledLabel = "alerts.enabled"
-	AppRoutesLabel     = "alerts.routes"
+	AlertsEnabledLabel     = "alerts.enabled"
+	AppRoutesLabel         = "alerts.routes"
+	DefaultShutdownTimeout = 30 * time.Second
 )
 
 type AlertManager struct {
-	CheckerChan      chan checks.AppCheck // channel to get app check results
-	AppSuppress      map[string]time.Time // Key - AppName-CheckName-CheckResult
-	AlertCount       map[string]int       // Key - AppName-CheckName -> Consecutive # of failures
+	CheckerChan      chan checks.AppCheck       // channel to get app check results
+	AppSuppress      map[string]time.Time       // Key - AppName-CheckName-CheckResult
+	AlertCount       map[string]int             // Key - AppName-CheckName -> Consecutive # of failures
+	LastChecks       map[string]checks.AppCheck // Key - AppName-CheckName -> Latest check result
+	Streaks          map[string]int             // Key - AppName-CheckName -> # of consecutive results that passed, or failed, like the latest
+	Acks             map[string]state.Ack       // Key - AppName-CheckName-CheckResult, same as AppSuppress
+	OpenedOn         map[string]time.Time       // Key - AppName-CheckName-CheckResult, same as AppSuppress -> When the alert was opened, escalations count from it
 	SuppressDuration time.Duration
+	DefaultRoutes    string // used for apps without the alerts.routes label, defaults to routes.DefaultRoutes
 	Notifiers        []notifiers.Notifier
-	RunWaitGroup     sync.WaitGroup
-	stopChannel      chan bool
-	supressMutex     sync.Mutex
+	Store            state.Store // optional, persists AppSuppress, AlertCount, Acks and OpenedOn across restarts
+	Snoozer          *Snoozer    // optional, drops the notifications of snoozed checks
+	// FailAfter is the # of consecutive failures before an alert is opened, and
+	// ResolveAfter the # of consecutive passes before it's resolved. Both default to
+	// 1 and are overridden by the alerts.<check>.fail-after and resolve-after labels.
+	FailAfter    int
+	ResolveAfter int
+	// Maintenance is optional, it holds back the notifications of the checks in
+	// maintenance and notifies the ones still failing once the window closes
+	Maintenance *MaintenanceWindows
+	// Escalations by name, apps without the alerts.escalation label use DefaultEscalation.
+	// Alerts without a policy are re-notified once SuppressDuration is over.
+	Escalations       map[string]EscalationPolicy
+	DefaultEscalation string
+	// FlapDetection is optional, a flapping check is notified once when it starts and
+	// once when it stops flapping instead of on every change in between
+	FlapDetection FlapDetection
+	StateHistory  map[string][]checks.CheckStatus // Key - AppName-CheckName -> Latest results, oldest first
+	Flapping      map[string]bool                 // Key - AppName-CheckName of the checks that are flapping
+	// GroupWindow is optional, the notifications to DigestNotifiers within it are
+	// grouped by GroupBy (one of GroupByOptions) and sent as a single digest
+	GroupWindow time.Duration
+	GroupBy     string
+	// History keeps the last HistorySize transitions of every check, defaults to
+	// DefaultHistorySize
+	History      map[string][]Transition // Key - AppName-CheckName -> Latest transitions, oldest first
+	HistorySize  int
+	LastNotified map[string]time.Time // Key - AppName-CheckName -> When we last sent it to the notifiers
+	// Runbook is a text/template of the runbook link of the apps without an
+	// alerts.runbook label, the checks have no runbook when it's empty
+	Runbook string
+	// Dispatcher is optional, it sends the notifications in the background and retries
+	// the failed ones. Without it they're sent right away and failures are only logged.
+	Dispatcher *Dispatcher
+	// ShutdownTimeout is how long Stop waits for the queued checks and in-flight
+	// notifications, defaults to DefaultShutdownTimeout
+	ShutdownTimeout time.Duration
+	RunWaitGroup    sync.WaitGroup
+	stopChannel     chan bool
+	stopped         chan bool // closed once run returns
+	stopOnce        sync.Once
+	supressMutex    sync.Mutex
+	lastTick        time.Time
+	digests         map[string]*pendingDigest // Key - NotifierName/Group
 }
 
 func (a *AlertManager) Start() {
 	log.Println("Starting Alert Manager...")
 	a.RunWaitGroup.Add(1)
 	a.stopChannel = make(chan bool)
+	a.stopped = make(chan bool)
 	a.AppSuppress = make(map[string]time.Time)
 	a.AlertCount = make(map[string]int)
+	a.LastChecks = make(map[string]checks.AppCheck)
+	a.Streaks = make(map[string]int)
+	a.Acks = make(map[string]state.Ack)
+	a.OpenedOn = make(map[string]time.Time)
+	a.StateHistory = make(map[string][]checks.CheckStatus)
+	a.Flapping = make(map[string]bool)
+	a.History = make(map[string][]Transition)
+	a.LastNotified = make(map[string]time.Time)
+	a.lastTick = time.Now()
+	a.restoreState()
 	go a.run()
 	log.Println("Alert Manager Started.")
 }
 
+// Stop processes the checks already queued on CheckerChan and waits for their
+// notifications to be sent before saving the state, giving up after ShutdownTimeout.
+// It's safe to call Stop more than once.
 func (a *AlertManager) Stop() {
-	log.Println("Stopping Alert Manager...")
-	close(a.stopChannel)
-	a.RunWaitGroup.Done()
+	a.stopOnce.Do(func() {
+		log.Println("Stopping Alert Manager...")
+		close(a.stopChannel)
+		timeout := a.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = DefaultShutdownTimeout
+		}
+		done := make(chan bool)
+		go func() {
+			<-a.stopped
+			a.supressMutex.Lock()
+			// Everything that's pending is due by then
+			a.flushDigests(time.Now().Add(a.GroupWindow))
+			a.saveState()
+			a.supressMutex.Unlock()
+			if a.Dispatcher != nil {
+				a.Dispatcher.Close()
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+			log.Println("Alert Manager Stopped.")
+		case <-time.After(timeout):
+			// We save the state before notifying, so what's on disk is still good
+			metrics.GetOrRegisterCounter("alerts-manager-shutdown-timeout", nil).Inc(int64(1))
+			log.Printf("Error - Gave up waiting for the notifications after %v\n", timeout)
+		}
+		a.RunWaitGroup.Done()
+	})
 }
 
+// cleanUpSupressedAlerts drops the suppressions older than SuppressDuration, so the
+// next check notifies again. Alerts with an escalation policy are left to escalate,
+// and acked alerts aren't notified again until they're resolved.
 func (a *AlertManager) cleanUpSupressedAlerts() {
 	a.supressMutex.Lock()
+	cleaned := false
 	for key, suppressedOn := range a.AppSuppress {
+		if _, escalated := a.openCheckEscalation(key); escalated {
+			continue
+		}
+		if _, acked := a.Acks[key]; acked {
+			continue
+		}
 		if time.Now().Sub(suppressedOn) > a.SuppressDuration {
 			metrics.GetOrRegisterCounter("alerts-suppressed-cleaned", nil).Inc(int64(1))
 			delete(a.AppSuppress, key)
+			delete(a.OpenedOn, key)
+			cleaned = true
 		}
 	}
+	if cleaned {
+		a.saveState()
+	}
 	a.supressMutex.Unlock()
 }
 
+// restoreState loads the state we saved before the last shutdown. Suppressions that
+// expired while we were down are renewed, else they'd be cleaned up before the next
+// check could resolve them, but the alerts keep escalating from when they were opened.
+func (a *AlertManager) restoreState() {
+	if a.Store == nil {
+		return
+	}
+	snapshot, err := a.Store.Load()
+	if err != nil {
+		log.Printf("Error - Unable to restore the alerts state, starting afresh - %v\n", err)
+		return
+	}
+	now := time.Now()
+	for key, suppressedOn := range snapshot.AppSuppress {
+		openedOn, present := snapshot.OpenedOn[key]
+		if !present {
+			openedOn = suppressedOn
+		}
+		a.markOpened(key, openedOn)
+		if now.Sub(suppressedOn) > a.SuppressDuration {
+			suppressedOn = now
+		}
+		a.AppSuppress[key] = suppressedOn
+	}
+	for key, count := range snapshot.AlertCount {
+		a.AlertCount[key] = count
+	}
+	for key, ack := range snapshot.Acks {
+		a.Acks[key] = ack
+	}
+	log.Printf("Alert Manager - Restored %d open alerts\n", len(a.AppSuppress))
+}
+
+// saveState persists the current state if we've a Store, callers should hold supressMutex
+func (a *AlertManager) saveState() {
+	if a.Store == nil {
+		return
+	}
+	snapshot := state.NewSnapshot()
+	for key, suppressedOn := range a.AppSuppress {
+		snapshot.AppSuppress[key] = suppressedOn
+		snapshot.OpenedOn[key] = a.alertOpenedOn(key)
+	}
+	for key, count := range a.AlertCount {
+		snapshot.AlertCount[key] = count
+	}
+	for key, ack := range a.Acks {
+		snapshot.Acks[key] = ack
+	}
+	err := a.Store.Save(snapshot)
+	if err != nil {
+		metrics.GetOrRegisterCounter("alerts-state-save-failed", nil).Inc(int64(1))
+		log.Printf("Error - Unable to save the alerts state - %v\n", err)
+	}
+}
+
+// run processes the checks as they come in and ticks every 5 seconds. The ticker
+// keeps ticking however many checks come in, so they can't hold the tick off.
 func (a *AlertManager) run() {
+	defer close(a.stopped)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
 	running := true
 	for running {
 		select {
-		case <-time.After(5 * time.Second):
+		case <-ticker.C:
 			metrics.GetOrRegisterCounter("alerts-suppressed-called", DebugMetricsRegistry).Inc(int64(1))
 			a.cleanUpSupressedAlerts()
+			a.tick(time.Now())
 		case check := <-a.CheckerChan:
 			metrics.GetOrRegisterCounter("alerts-process-check-called", DebugMetricsRegistry).Inc(int64(1))
 			a.processCheck(check)
 		case <-a.stopChannel:
 			metrics.GetOrRegisterCounter("alerts-manager-stopped", DebugMetricsRegistry).Inc(int64(1))
+			a.drain()
 			running = false
 		}
 	}
 }
 
+// drain processes the checks that were queued by the time we were stopped
+func (a *AlertManager) drain() {
+	for {
+		select {
+		case check := <-a.CheckerChan:
+			a.processCheck(check)
+		default:
+			return
+		}
+	}
+}
+
 func (a *AlertManager) processCheck(check checks.AppCheck) {
 	a.supressMutex.Lock()
 	defer a.supressMutex.Unlock()
 
+	a.recordStreak(check)
+	if a.LastChecks != nil {
+		a.LastChecks[a.keyPrefix(check)] = check
+	}
+
 	alertEnabled := maps.GetBoolean(check.Labels, AlertsEnabledLabel, true)
 
 	if alertEnabled {
-		allRoutes, err := routes.ParseRoutes(maps.GetString(check.Labels, AppRoutesLabel, routes.DefaultRoutes))
+		allRoutes, err := a.routesOf(check)
 		if err != nil {
 			log.Printf("Error - %v\n", err)
 			return
 		}
+		policy, escalated := a.escalationPolicy(check)
+		var notifierPatterns []string
+		if escalated {
+			notifierPatterns = policy.Immediate()
+		} else if name := maps.GetString(check.Labels, AppEscalationLabel, ""); name != "" {
+			log.Printf("Error - Unknown escalation policy %s for %s, falling back to alerts.suppress-duration\n", name, check.App)
+		}
+		flapping, flapChanged := a.detectFlapping(check)
+		flapCheck := check
 		checkExists, keyPrefixIfCheckExists, keyIfCheckExists, previousCheckLevel := a.checkExist(check)
 
-		if checkExists && check.Result == checks.Pass {
+		if pending := a.pending(check, checkExists); pending > 0 {
+			log.Printf("[Pending] App: %s, Result: %s, Check: %s, %d more to go\n", check.App, checks.CheckStatusToString(check.Result), check.CheckName, pending)
+			metrics.GetOrRegisterCounter("alerts-pending", nil).Inc(int64(1))
+		} else if checkExists && check.Result == checks.Pass {
 			a.AlertCount[keyPrefixIfCheckExists]++
 			check.Times = a.AlertCount[keyPrefixIfCheckExists]
 			check.Result = checks.Resolved
-			previousRouteExists := a.checkForRouteWithCheckLevel(previousCheckLevel, allRoutes)
+			previousRouteExists := a.checkForRouteWithCheckLevel(previousCheckLevel, check, allRoutes)
+			if escalated {
+				notifierPatterns = policy.Reached(a.alertOpenedOn(keyIfCheckExists), check.Timestamp)
+			}
+			if ack, acked := a.Acks[keyIfCheckExists]; acked {
+				check.AckedBy = ack.By
+				check.AckComment = ack.Comment
+			}
 			delete(a.AppSuppress, keyIfCheckExists)
+			delete(a.OpenedOn, keyIfCheckExists)
 			delete(a.AlertCount, keyPrefixIfCheckExists)
+			delete(a.Acks, keyIfCheckExists)
+			a.recordTransition(check, previousCheckLevel, checks.Resolved)
+			a.saveState()
 			if previousRouteExists {
-				a.notifyCheck(check, allRoutes)
-				a.incNotifCounter(check)
+				a.notifyTransition(check, allRoutes, escalated, notifierPatterns)
 			}
 		} else if checkExists && check.Result != previousCheckLevel {
+			// The alert at the new level needs to be acked again
 			delete(a.AppSuppress, keyIfCheckExists)
+			delete(a.OpenedOn, keyIfCheckExists)
+			delete(a.Acks, keyIfCheckExists)
 			key := a.key(check, check.Result)
 			a.AppSuppress[key] = check.Timestamp
+			a.markOpened(key, check.Timestamp)
 			a.AlertCount[keyPrefixIfCheckExists]++
 			check.Times = a.AlertCount[keyPrefixIfCheckExists]
-			a.notifyCheck(check, allRoutes)
-			a.incNotifCounter(check)
+			a.recordTransition(check, previousCheckLevel, check.Result)
+			a.saveState()
+			a.notifyTransition(check, allRoutes, escalated, notifierPatterns)
 		} else if !checkExists && check.Result != checks.Pass {
 			keyPrefix := a.keyPrefix(check)
 			key := a.key(check, check.Result)
 			a.AppSuppress[key] = check.Timestamp
+			a.markOpened(key, check.Timestamp)
 			_, present := a.AlertCount[keyPrefix]
 			if present {
 				a.AlertCount[keyPrefix]++
@@ -117,37 +332,569 @@ func (a *AlertManager) processCheck(check checks.AppCheck) {
 				a.AlertCount[keyPrefix] = 1
 			}
 			check.Times = a.AlertCount[keyPrefix]
-			a.notifyCheck(check, allRoutes)
-			a.incNotifCounter(check)
+			a.recordTransition(check, checks.Pass, check.Result)
+			a.saveState()
+			a.notifyTransition(check, allRoutes, escalated, notifierPatterns)
 		} else if !checkExists && check.Result == checks.Pass {
 			keyPrefix := a.keyPrefix(check)
-			delete(a.AlertCount, keyPrefix)
+			_, present := a.AlertCount[keyPrefix]
+			if present {
+				delete(a.AlertCount, keyPrefix)
+				a.saveState()
+			}
+		}
+
+		if flapChanged {
+			// The change in this check is in the notification that it stopped flapping
+			if !flapping {
+				delete(a.Flapping, a.keyPrefix(check))
+			}
+			a.notifyFlapping(flapCheck, flapping, allRoutes, escalated, notifierPatterns)
 		}
 	}
 	// TODO - Add a log message that runs only once per every new app / if app state has changed
 }
 
-func (a *AlertManager) checkForRouteWithCheckLevel(level checks.CheckStatus, allRoutes []routes.Route) bool {
-	for _, route := range allRoutes {
-		if route.MatchCheckResult(level) {
-			return true
+// recordStreak counts the consecutive results of the check that passed, or failed,
+// like this one. Callers should hold supressMutex.
+func (a *AlertManager) recordStreak(check checks.AppCheck) {
+	if a.Streaks == nil {
+		a.Streaks = make(map[string]int)
+	}
+	keyPrefix := a.keyPrefix(check)
+	previous, present := a.LastChecks[keyPrefix]
+	if present && (previous.Result == checks.Pass) == (check.Result == checks.Pass) {
+		a.Streaks[keyPrefix]++
+	} else {
+		a.Streaks[keyPrefix] = 1
+	}
+}
+
+// pending returns the # of results like this one the check still needs before its
+// alert is opened, or resolved when the alert is open. It's 0 when there's nothing
+// to hold back.
+func (a *AlertManager) pending(check checks.AppCheck, alertOpen bool) int {
+	failAfter := countLabel(check.Labels, fmt.Sprintf("alerts.%s.fail-after", check.CheckName), a.FailAfter)
+	resolveAfter := countLabel(check.Labels, fmt.Sprintf("alerts.%s.resolve-after", check.CheckName), a.ResolveAfter)
+	streak := a.Streaks[a.keyPrefix(check)]
+	if !alertOpen && check.Result != checks.Pass && streak < failAfter {
+		return failAfter - streak
+	}
+	if alertOpen && check.Result == checks.Pass && streak < resolveAfter {
+		return resolveAfter - streak
+	}
+	return 0
+}
+
+func countLabel(labels map[string]string, label string, defaultValue int) int {
+	value, err := strconv.Atoi(maps.GetString(labels, label, strconv.Itoa(defaultValue)))
+	if err != nil {
+		log.Printf("Error - Expected a number for %s but %s found\n", label, labels[label])
+		return defaultValue
+	}
+	return value
+}
+
+// tick escalates the open alerts, catches up on the maintenance windows that closed
+// since the last tick and sends the digests that are due
+func (a *AlertManager) tick(now time.Time) {
+	a.supressMutex.Lock()
+	defer a.supressMutex.Unlock()
+	since := a.lastTick
+	a.lastTick = now
+	a.escalate(since, now)
+	a.notifyClosedMaintenance(since, now)
+	a.notifyEndedSnoozes(now)
+	a.flushDigests(now)
+}
+
+// escalate notifies the open alerts whose escalation policy has a step due in
+// (since, now], callers should hold supressMutex
+func (a *AlertManager) escalate(since, now time.Time) {
+	escalated := false
+	for key := range a.AppSuppress {
+		policy, present := a.openCheckEscalation(key)
+		if _, acked := a.Acks[key]; !present || acked || a.Flapping[keyPrefixOf(key)] {
+			continue
+		}
+		notifierPatterns := policy.Due(a.alertOpenedOn(key), since, now)
+		if len(notifierPatterns) == 0 {
+			continue
 		}
+		check := a.LastChecks[keyPrefixOf(key)]
+		allRoutes, err := a.routesOf(check)
+		if err != nil {
+			log.Printf("Error - %v\n", err)
+			continue
+		}
+		metrics.GetOrRegisterCounter("alerts-escalated", nil).Inc(int64(1))
+		a.AlertCount[keyPrefixOf(key)]++
+		check.Times = a.AlertCount[keyPrefixOf(key)]
+		a.saveState()
+		a.notifyCheck(check, allRoutes, true, notifierPatterns)
+		a.incNotifCounter(check)
+		escalated = true
 	}
+	if escalated {
+		log.Println("Alert Manager - Escalated the open alerts that were due")
+	}
+}
 
-	return false
+// notifyClosedMaintenance notifies the alerts that are still open once a maintenance
+// window covering them closes in (since, now], as their notifications were held
+// back. Every notifier gets a summary of them. Callers should hold supressMutex.
+func (a *AlertManager) notifyClosedMaintenance(since, now time.Time) {
+	if a.Maintenance == nil {
+		return
+	}
+	for _, window := range a.Maintenance.ClosedBetween(since, now) {
+		keys := a.openAlerts(func(check checks.AppCheck) bool {
+			return window.Matches(check.Cluster, check.App, check.CheckName)
+		})
+		metrics.GetOrRegisterCounter("maintenance-windows-closed", nil).Inc(int64(1))
+		log.Printf("[Maintenance] Window %s closed, %d alerts are still open\n", window.Name, len(keys))
+		a.notifyStillOpen(keys, notifiers.Digest{GroupBy: "maintenance window", Group: window.Name},
+			"Still failing after the maintenance window "+window.Name, now)
+	}
+}
+
+// notifyEndedSnoozes notifies the alerts that are still open once a snooze covering
+// them expires or is cancelled, as their notifications were dropped. Every notifier
+// gets a summary of them. Callers should hold supressMutex.
+func (a *AlertManager) notifyEndedSnoozes(now time.Time) {
+	if a.Snoozer == nil {
+		return
+	}
+	for _, snooze := range a.Snoozer.Ended() {
+		keys := a.openAlerts(snooze.Matches)
+		metrics.GetOrRegisterCounter("snoozes-ended", nil).Inc(int64(1))
+		log.Printf("[Snoozed] Snooze %s ended, %d alerts are still open\n", snooze.ID, len(keys))
+		a.notifyStillOpen(keys, notifiers.Digest{GroupBy: "snooze", Group: snooze.Reason},
+			"Still failing after the snooze ended", now)
+	}
+}
+
+// openAlerts returns the sorted keys of the open alerts that aren't acked, of the
+// checks that match. Callers should hold supressMutex.
+func (a *AlertManager) openAlerts(matches func(check checks.AppCheck) bool) []string {
+	var keys []string
+	for key := range a.AppSuppress {
+		check, present := a.LastChecks[keyPrefixOf(key)]
+		if _, acked := a.Acks[key]; acked || !present || a.key(check, check.Result) != key {
+			continue
+		}
+		if matches(check) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// notifyStillOpen notifies the open alerts of the keys again, with the reason in
+// their message. Every notifier is sent a single summary of them - the digest when it
+// takes digests, else each of its checks. Callers should hold supressMutex.
+func (a *AlertManager) notifyStillOpen(keys []string, summary notifiers.Digest, reason string, now time.Time) {
+	summaries := make(map[string]*notifiers.Digest)
+	var summarized []notifiers.Notifier
+	for _, key := range keys {
+		check := a.LastChecks[keyPrefixOf(key)]
+		allRoutes, err := a.routesOf(check)
+		if err != nil {
+			log.Printf("Error - %v\n", err)
+			continue
+		}
+		policy, escalated := a.escalationPolicy(check)
+		var notifierPatterns []string
+		if escalated {
+			notifierPatterns = policy.Reached(a.alertOpenedOn(key), now)
+		}
+		check.Message = fmt.Sprintf("%s - %s", reason, check.Message)
+		if a.Flapping[keyPrefixOf(key)] || a.heldBack(check) {
+			continue
+		}
+		a.AlertCount[keyPrefixOf(key)]++
+		check.Times = a.AlertCount[keyPrefixOf(key)]
+		check.OpenedAt = a.openedAt(check)
+		check.Runbook = a.runbookOf(check)
+		for _, notifier := range a.notifiersOf(check, allRoutes, escalated, notifierPatterns) {
+			notifierSummary, present := summaries[notifier.Name()]
+			if !present {
+				notifierSummary = &notifiers.Digest{GroupBy: summary.GroupBy, Group: summary.Group}
+				summaries[notifier.Name()] = notifierSummary
+				summarized = append(summarized, notifier)
+			}
+			notifierSummary.Checks = append(notifierSummary.Checks, check)
+			a.markNotified(check)
+		}
+		a.incNotifCounter(check)
+	}
+	a.saveState()
+
+	for _, notifier := range summarized {
+		notifierSummary := summaries[notifier.Name()]
+		if _, takesDigests := notifier.(notifiers.DigestNotifier); takesDigests && len(notifierSummary.Checks) > 1 {
+			log.Printf("[Summary] Sending %d checks still open to %s\n", len(notifierSummary.Checks), notifier.Name())
+			a.dispatch(notification{notifier: notifier, digest: notifierSummary})
+			continue
+		}
+		for i := range notifierSummary.Checks {
+			a.dispatch(notification{notifier: notifier, check: &notifierSummary.Checks[i]})
+		}
+	}
+}
+
+// detectFlapping records the result of the check and tells if it's flapping, and if
+// that changed with this check. A check that starts flapping is marked right away,
+// callers unmark the ones that stopped. Callers should hold supressMutex.
+func (a *AlertManager) detectFlapping(check checks.AppCheck) (bool, bool) {
+	if !a.FlapDetection.Enabled() {
+		return false, false
+	}
+	if a.StateHistory == nil {
+		a.StateHistory = make(map[string][]checks.CheckStatus)
+	}
+	if a.Flapping == nil {
+		a.Flapping = make(map[string]bool)
+	}
+	keyPrefix := a.keyPrefix(check)
+	history := a.FlapDetection.Record(a.StateHistory[keyPrefix], check.Result)
+	a.StateHistory[keyPrefix] = history
+	wasFlapping := a.Flapping[keyPrefix]
+	flapping := a.FlapDetection.IsFlapping(history, wasFlapping)
+	if flapping {
+		a.Flapping[keyPrefix] = true
+	}
+	return flapping, flapping != wasFlapping
+}
+
+// notifyFlapping tells the routes of the check that it started or stopped flapping.
+// It's sent at the worst level in the history when it starts, and at the current
+// level (or as resolved) when it stops.
+func (a *AlertManager) notifyFlapping(check checks.AppCheck, started bool, allRoutes []routes.Route, escalated bool, notifierPatterns []string) {
+	keyPrefix := a.keyPrefix(check)
+	history := a.StateHistory[keyPrefix]
+	percent := a.FlapDetection.PercentStateChange(history)
+	if started {
+		metrics.GetOrRegisterCounter("alerts-flapping-started", nil).Inc(int64(1))
+		check.Result = worstLevel(history)
+		check.Message = fmt.Sprintf("Started flapping, the result changed in %.0f%% of the last %d checks - %s", percent, len(history), check.Message)
+	} else {
+		metrics.GetOrRegisterCounter("alerts-flapping-stopped", nil).Inc(int64(1))
+		if check.Result == checks.Pass {
+			check.Result = checks.Resolved
+		}
+		check.Message = fmt.Sprintf("Stopped flapping, the result changed in %.0f%% of the last %d checks - %s", percent, len(history), check.Message)
+	}
+	check.Times = a.AlertCount[keyPrefix]
+	a.notifyCheck(check, allRoutes, escalated, notifierPatterns)
+	a.incNotifCounter(check)
+}
+
+// Ack marks the open alert of the app and check as acked, which stops it from being
+// notified again until it's resolved. It tells if the check had an open alert.
+func (a *AlertManager) Ack(cluster, app, checkName, by, comment string) (state.Ack, bool) {
+	a.supressMutex.Lock()
+	defer a.supressMutex.Unlock()
+	checkExists, _, key, _ := a.checkExist(checks.AppCheck{Cluster: cluster, App: app, CheckName: checkName})
+	if !checkExists {
+		return state.Ack{}, false
+	}
+	if a.Acks == nil {
+		a.Acks = make(map[string]state.Ack)
+	}
+	ack := state.Ack{By: by, Comment: comment, At: time.Now()}
+	a.Acks[key] = ack
+	a.saveState()
+	return ack, true
+}
+
+// ForgetApp drops the checks of an app that was removed from Marathon along with its
+// open alerts, else they'd never be resolved and the escalated ones would be notified
+// forever
+func (a *AlertManager) ForgetApp(cluster, appID string) {
+	a.supressMutex.Lock()
+	defer a.supressMutex.Unlock()
+	forgotten := false
+	for keyPrefix, check := range a.LastChecks {
+		if check.Cluster != cluster || check.App != appID {
+			continue
+		}
+		for _, level := range checks.CheckLevels {
+			delete(a.AppSuppress, a.key(check, level))
+			delete(a.OpenedOn, a.key(check, level))
+			delete(a.Acks, a.key(check, level))
+		}
+		delete(a.AlertCount, keyPrefix)
+		delete(a.LastChecks, keyPrefix)
+		delete(a.Streaks, keyPrefix)
+		delete(a.StateHistory, keyPrefix)
+		delete(a.Flapping, keyPrefix)
+		delete(a.History, keyPrefix)
+		delete(a.LastNotified, keyPrefix)
+		forgotten = true
+	}
+	if forgotten {
+		metrics.GetOrRegisterCounter("alerts-apps-forgotten", nil).Inc(int64(1))
+		log.Printf("Alert Manager - Forgot the checks of %s, it was removed from Marathon\n", appID)
+		a.saveState()
+	}
+}
+
+// openCheckEscalation returns the escalation policy of the open alert with the key,
+// as long as the latest check of the app is still at the level of the alert
+func (a *AlertManager) openCheckEscalation(key string) (EscalationPolicy, bool) {
+	check, present := a.LastChecks[keyPrefixOf(key)]
+	if !present || a.key(check, check.Result) != key {
+		return EscalationPolicy{}, false
+	}
+	return a.escalationPolicy(check)
+}
+
+// escalationPolicy returns the policy in the alerts.escalation label of the app or
+// the DefaultEscalation, and false when there's none
+func (a *AlertManager) escalationPolicy(check checks.AppCheck) (EscalationPolicy, bool) {
+	name := maps.GetString(check.Labels, AppEscalationLabel, a.DefaultEscalation)
+	if name == "" {
+		return EscalationPolicy{}, false
+	}
+	policy, present := a.Escalations[name]
+	return policy, present
+}
+
+// Reconfigure swaps the notifiers, escalation policies and the settings in alerts,
+// without losing track of the open alerts. Digests already pending are still sent
+// when they're due.
+func (a *AlertManager) Reconfigure(allNotifiers []notifiers.Notifier, alerts AlertsConfig, escalations map[string]EscalationPolicy) {
+	a.supressMutex.Lock()
+	defer a.supressMutex.Unlock()
+	a.Notifiers = allNotifiers
+	a.SuppressDuration = alerts.SuppressDuration
+	a.DefaultRoutes = string(alerts.Routes)
+	a.Escalations = escalations
+	a.DefaultEscalation = alerts.Escalation
+	a.FlapDetection = alerts.Flapping
+	a.FailAfter = alerts.FailAfter
+	a.ResolveAfter = alerts.ResolveAfter
+	a.GroupWindow = alerts.GroupWindow
+	a.GroupBy = alerts.GroupBy
+	a.HistorySize = alerts.HistorySize
+	a.Runbook = alerts.Runbook
+	if !a.FlapDetection.Enabled() {
+		// Else the checks that were flapping would never be notified again
+		a.StateHistory = make(map[string][]checks.CheckStatus)
+		a.Flapping = make(map[string]bool)
+	}
+}
+
+// routesOf returns the routes of the check's app, its alerts.routes label overrides
+// or extends the default routes
+func (a *AlertManager) routesOf(check checks.AppCheck) ([]routes.Route, error) {
+	return routes.ParseRoutes(routes.Extend(a.defaultRoutes(), maps.GetString(check.Labels, AppRoutesLabel, "")))
+}
+
+func (a *AlertManager) defaultRoutes() string {
+	if a.DefaultRoutes != "" {
+		return a.DefaultRoutes
+	}
+	return routes.DefaultRoutes
+}
+
+// CurrentChecks returns the latest result of every app and check, sorted by app and check name
+func (a *AlertManager) CurrentChecks() []checks.AppCheck {
+	a.supressMutex.Lock()
+	defer a.supressMutex.Unlock()
+	var keys []string
+	for key := range a.LastChecks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	currentChecks := []checks.AppCheck{}
+	for _, key := range keys {
+		currentChecks = append(currentChecks, a.LastChecks[key])
+	}
+	return currentChecks
+}
+
+// CheckState is the latest result of an app and check, and where its alert is at
+type CheckState struct {
+	checks.AppCheck
+	// Alert is the level of the open alert, Pass when there's none
+	Alert checks.CheckStatus
+	// Pending is the # of results like the latest the check still needs before its
+	// alert is opened or resolved, 0 when nothing is held back
+	Pending int
+	// Since is when the alert last changed, zero if it's no longer in the History
+	Since        time.Time
+	LastNotified time.Time
+	Snoozed      bool
+	Ack          *state.Ack // of the open alert, nil if it's not acked
+}
+
+// CheckStates returns the state of every app and check, sorted by app and check name
+func (a *AlertManager) CheckStates() []CheckState {
+	a.supressMutex.Lock()
+	defer a.supressMutex.Unlock()
+	var keys []string
+	for key := range a.LastChecks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	states := []CheckState{}
+	for _, key := range keys {
+		check := a.LastChecks[key]
+		alertOpen, _, alertKey, level := a.checkExist(check)
+		keyPrefix := a.keyPrefix(check)
+		check.Times = a.AlertCount[keyPrefix]
+		checkState := CheckState{
+			AppCheck:     check,
+			Alert:        level,
+			Pending:      a.pending(check, alertOpen),
+			Since:        a.lastTransition(check),
+			LastNotified: a.LastNotified[keyPrefix],
+			Snoozed:      a.Snoozer != nil && a.Snoozer.IsSnoozed(check),
+		}
+		if ack, acked := a.Acks[alertKey]; alertOpen && acked {
+			checkState.Ack = &ack
+		}
+		states = append(states, checkState)
+	}
+	return states
 }
 
-func (a *AlertManager) notifyCheck(check checks.AppCheck, allRoutes []routes.Route) {
+func (a *AlertManager) checkForRouteWithCheckLevel(level checks.CheckStatus, check checks.AppCheck, allRoutes []routes.Route) bool {
+	check.Result = level
+	return len(routes.Matching(allRoutes, check)) > 0
+}
+
+// notifyTransition notifies the change in the check, unless it's flapping, which the
+// routes have already been told about
+func (a *AlertManager) notifyTransition(check checks.AppCheck, allRoutes []routes.Route, escalated bool, notifierPatterns []string) {
+	if a.Flapping[a.keyPrefix(check)] {
+		log.Printf("[Flapping] App: %s, Result: %s, Check: %s, Reason: %s \n", check.App, checks.CheckStatusToString(check.Result), check.CheckName, check.Message)
+		metrics.GetOrRegisterCounter("notifications-flapping", nil).Inc(1)
+		return
+	}
+	a.notifyCheck(check, allRoutes, escalated, notifierPatterns)
+	a.incNotifCounter(check)
+}
+
+// notifyCheck sends the check to the notifiers its routes match, only to the ones
+// matching notifierPatterns when the check is escalated. A notifier matched by more
+// than one route is sent the check once.
+func (a *AlertManager) notifyCheck(check checks.AppCheck, allRoutes []routes.Route, escalated bool, notifierPatterns []string) {
+	if a.heldBack(check) {
+		return
+	}
+	check.OpenedAt = a.openedAt(check)
+	check.Runbook = a.runbookOf(check)
 	log.Printf("[NotifyCheck] App: %s, Result: %s, Check: %s, Reason: %s \n", check.App, checks.CheckStatusToString(check.Result), check.CheckName, check.Message)
-	for _, route := range allRoutes {
-		if route.Match(check) {
-			for _, notifier := range a.Notifiers {
-				if route.MatchNotifier(notifier.Name()) {
-					notifier.Notify(check)
-				}
+	for _, notifier := range a.notifiersOf(check, allRoutes, escalated, notifierPatterns) {
+		a.send(notifier, check)
+		a.markNotified(check)
+	}
+}
+
+// heldBack tells if the notifications of the check are held back, as it's snoozed or
+// in a maintenance window
+func (a *AlertManager) heldBack(check checks.AppCheck) bool {
+	if a.Snoozer != nil && a.Snoozer.IsSnoozed(check) {
+		log.Printf("[Snoozed] App: %s, Result: %s, Check: %s, Reason: %s \n", check.App, checks.CheckStatusToString(check.Result), check.CheckName, check.Message)
+		metrics.GetOrRegisterCounter("notifications-snoozed", nil).Inc(1)
+		return true
+	}
+	if a.Maintenance != nil && a.Maintenance.InMaintenance(check, time.Now()) {
+		log.Printf("[Maintenance] App: %s, Result: %s, Check: %s, Reason: %s \n", check.App, checks.CheckStatusToString(check.Result), check.CheckName, check.Message)
+		metrics.GetOrRegisterCounter("notifications-maintenance", nil).Inc(1)
+		return true
+	}
+	return false
+}
+
+// notifiersOf returns the notifiers the routes of the check match, only the ones
+// matching notifierPatterns when the check is escalated. A notifier matched by more
+// than one route is returned once.
+func (a *AlertManager) notifiersOf(check checks.AppCheck, allRoutes []routes.Route, escalated bool, notifierPatterns []string) []notifiers.Notifier {
+	var matched []notifiers.Notifier
+	notified := make(map[string]bool)
+	for _, route := range routes.Matching(allRoutes, check) {
+		for _, notifier := range a.Notifiers {
+			if notified[notifier.Name()] {
+				continue
+			}
+			if route.MatchNotifier(notifier.Name()) && (!escalated || matchesAnyNotifier(notifierPatterns, notifier.Name())) {
+				notified[notifier.Name()] = true
+				matched = append(matched, notifier)
 			}
 		}
 	}
+	return matched
+}
+
+// markNotified records when the check was last notified. Callers should hold
+// supressMutex.
+func (a *AlertManager) markNotified(check checks.AppCheck) {
+	if a.LastNotified == nil {
+		a.LastNotified = make(map[string]time.Time)
+	}
+	a.LastNotified[a.keyPrefix(check)] = time.Now()
+}
+
+// send notifies the notifier of the check right away, or adds it to the digest of its
+// group when we're grouping and the notifier takes digests. Callers should hold
+// supressMutex.
+func (a *AlertManager) send(notifier notifiers.Notifier, check checks.AppCheck) {
+	digestNotifier, takesDigests := notifier.(notifiers.DigestNotifier)
+	if a.GroupWindow <= 0 || !takesDigests {
+		a.dispatch(notification{notifier: notifier, check: &check})
+		return
+	}
+	if a.digests == nil {
+		a.digests = make(map[string]*pendingDigest)
+	}
+	group := groupOf(check, a.GroupBy)
+	key := notifier.Name() + "/" + group
+	pending, present := a.digests[key]
+	if !present {
+		pending = &pendingDigest{
+			notifier: digestNotifier,
+			digest:   notifiers.Digest{GroupBy: a.GroupBy, Group: group},
+			due:      time.Now().Add(a.GroupWindow),
+		}
+		a.digests[key] = pending
+	}
+	pending.add(check)
+}
+
+// flushDigests sends the digests that are due by now, a digest of a single check is
+// sent as a regular notification. Callers should hold supressMutex.
+func (a *AlertManager) flushDigests(now time.Time) {
+	for key, pending := range a.digests {
+		if pending.due.After(now) {
+			continue
+		}
+		delete(a.digests, key)
+		if len(pending.digest.Checks) == 1 {
+			a.dispatch(notification{notifier: pending.notifier, check: &pending.digest.Checks[0]})
+			continue
+		}
+		metrics.GetOrRegisterCounter("notifications-digests", nil).Inc(int64(1))
+		log.Printf("[Digest] Sending %d checks of %s %q to %s\n", len(pending.digest.Checks), pending.digest.GroupBy, pending.digest.Group, pending.notifier.Name())
+		a.dispatch(notification{notifier: pending.notifier, digest: &pending.digest})
+	}
+}
+
+// dispatch hands the notification to the Dispatcher, or sends it right away when
+// there's none
+func (a *AlertManager) dispatch(n notification) {
+	if a.Dispatcher != nil {
+		a.Dispatcher.Dispatch(n)
+		return
+	}
+	if err := n.send(); err != nil {
+		metrics.GetOrRegisterCounter("notifications-failed", nil).Inc(int64(1))
+		log.Printf("Error - Unable to notify %s - %v\n", n.notifier.Name(), err)
+	}
 }
 
 func (a *AlertManager) checkExist(check checks.AppCheck) (bool, string, string, checks.CheckStatus) {
@@ -167,10 +914,37 @@ func (a *AlertManager) key(check checks.AppCheck, level checks.CheckStatus) stri
 	return fmt.Sprintf("%s-%d", a.keyPrefix(check), level)
 }
 
+// keyPrefix is AppName-CheckName, prefixed with `Cluster:` when the check has a Cluster
 func (a *AlertManager) keyPrefix(check checks.AppCheck) string {
+	if check.Cluster != "" {
+		return fmt.Sprintf("%s:%s-%s", check.Cluster, check.App, check.CheckName)
+	}
 	return fmt.Sprintf("%s-%s", check.App, check.CheckName)
 }
 
+// markOpened records when the alert of the key was opened, callers should hold
+// supressMutex
+func (a *AlertManager) markOpened(key string, openedOn time.Time) {
+	if a.OpenedOn == nil {
+		a.OpenedOn = make(map[string]time.Time)
+	}
+	a.OpenedOn[key] = openedOn
+}
+
+// alertOpenedOn is when the alert of the key was opened, it falls back to when it was
+// suppressed for the alerts we didn't see opening
+func (a *AlertManager) alertOpenedOn(key string) time.Time {
+	if openedOn, present := a.OpenedOn[key]; present {
+		return openedOn
+	}
+	return a.AppSuppress[key]
+}
+
+// keyPrefixOf returns the keyPrefix of a key in AppSuppress
+func keyPrefixOf(key string) string {
+	return key[:strings.LastIndex(key, "-")]
+}
+
 func (a *AlertManager) incNotifCounter(check checks.AppCheck) {
 	metrics.GetOrRegisterCounter("notifications-total", nil).Inc(1)
 	metrics.GetOrRegisterMeter("notifications-rate", nil).Mark(1)
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/maintenance"
 	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+	"github.com/ashwanthkumar/marathon-alerts/state"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -30,6 +35,93 @@ func TestKeyPrefix(t *testing.T) {
 	assert.Equal(t, "/foo-check-name", key)
 }
 
+func TestKeyPrefixWithCluster(t *testing.T) {
+	mgr := AlertManager{}
+	check := checks.AppCheck{
+		Cluster:   "prod",
+		App:       "/foo",
+		CheckName: "check-name",
+	}
+	assert.Equal(t, "prod:/foo-check-name", mgr.keyPrefix(check))
+	assert.Equal(t, "prod:/foo-check-name-1", mgr.key(check, checks.Critical))
+}
+
+func TestChecksFromDifferentClustersAreTrackedSeparately(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("pagerduty")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	mgr := AlertManager{
+		AppSuppress:   make(map[string]time.Time),
+		AlertCount:    make(map[string]int),
+		Notifiers:     []notifiers.Notifier{mockNotifier},
+		DefaultRoutes: "*/critical/*?cluster=prod;*/resolved/*?cluster=prod",
+	}
+	prod := checks.AppCheck{Cluster: "prod", App: "/foo", CheckName: "check-name", Result: checks.Critical}
+	staging := checks.AppCheck{Cluster: "staging", App: "/foo", CheckName: "check-name", Result: checks.Critical}
+
+	mgr.processCheck(prod)
+	mgr.processCheck(staging)
+	assert.Equal(t, 1, mgr.AlertCount["prod:/foo-check-name"])
+	assert.Equal(t, 1, mgr.AlertCount["staging:/foo-check-name"])
+	// Only prod is routed
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+
+	staging.Result = checks.Pass
+	mgr.processCheck(staging)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+	assert.Equal(t, 1, mgr.AlertCount["prod:/foo-check-name"])
+	assert.Equal(t, 0, mgr.AlertCount["staging:/foo-check-name"])
+}
+
+func TestRoutesMatchAppsAndLabelsAndStop(t *testing.T) {
+	pagerduty := new(notifiers.MockNotifier)
+	pagerduty.On("Name").Return("pagerduty")
+	pagerduty.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	slack := new(notifiers.MockNotifier)
+	slack.On("Name").Return("slack")
+	slack.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	mgr := AlertManager{
+		AppSuppress:   make(map[string]time.Time),
+		AlertCount:    make(map[string]int),
+		Notifiers:     []notifiers.Notifier{pagerduty, slack},
+		DefaultRoutes: "*/critical/slack;*/critical/pagerduty?app=/payments/*&stop&priority=10;*/resolved/*",
+	}
+
+	mgr.processCheck(checks.AppCheck{App: "/payments/api", CheckName: "min-healthy", Result: checks.Critical})
+	pagerduty.AssertNumberOfCalls(t, "Notify", 1)
+	slack.AssertNumberOfCalls(t, "Notify", 0)
+
+	mgr.processCheck(checks.AppCheck{App: "/search/api", CheckName: "min-healthy", Result: checks.Critical})
+	pagerduty.AssertNumberOfCalls(t, "Notify", 1)
+	slack.AssertNumberOfCalls(t, "Notify", 1)
+
+	// The label extends the default routes
+	labels := map[string]string{AppRoutesLabel: "+*/critical/pagerduty?label.team=search", "team": "search"}
+	mgr.processCheck(checks.AppCheck{App: "/search/web", CheckName: "min-healthy", Result: checks.Critical, Labels: labels})
+	pagerduty.AssertNumberOfCalls(t, "Notify", 2)
+	slack.AssertNumberOfCalls(t, "Notify", 2)
+}
+
+func TestOverlappingRoutesNotifyOnce(t *testing.T) {
+	pagerduty := new(notifiers.MockNotifier)
+	pagerduty.On("Name").Return("pagerduty")
+	pagerduty.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	slack := new(notifiers.MockNotifier)
+	slack.On("Name").Return("slack")
+	slack.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	mgr := AlertManager{
+		AppSuppress:   make(map[string]time.Time),
+		AlertCount:    make(map[string]int),
+		Notifiers:     []notifiers.Notifier{pagerduty, slack},
+		DefaultRoutes: "*/critical/*;*/resolved/*",
+	}
+
+	labels := map[string]string{AppRoutesLabel: "+*/critical/pagerduty"}
+	mgr.processCheck(checks.AppCheck{App: "/payments/api", CheckName: "min-healthy", Result: checks.Critical, Labels: labels})
+	pagerduty.AssertNumberOfCalls(t, "Notify", 1)
+	slack.AssertNumberOfCalls(t, "Notify", 1)
+}
+
 func TestCheckExists(t *testing.T) {
 	suppressedApps := make(map[string]time.Time)
 	suppressedApps["/foo-check-name-2"] = time.Now()
@@ -333,3 +425,851 @@ func TestShouldNotifyResolvedBecauseRoutesHaveWarning(t *testing.T) {
 	// We remove AlertCount upon Resolved check
 	assert.Equal(t, mgr.AlertCount["/foo-check-name"], 0)
 }
+
+func TestProcessCheckSavesStateOnEveryTransition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marathon-alerts-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := &state.FileStore{Path: filepath.Join(dir, "state.json")}
+
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		Notifiers:   []notifiers.Notifier{mockNotifier},
+		Store:       store,
+	}
+	check := checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Critical,
+		Timestamp: time.Now(),
+	}
+
+	mgr.processCheck(check)
+	snapshot, err := store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, snapshot.AppSuppress, 1)
+	assert.Equal(t, 1, snapshot.AlertCount["/foo-check-name"])
+
+	check.Result = checks.Pass
+	mgr.processCheck(check)
+	snapshot, err = store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, snapshot.AppSuppress, 0)
+	assert.Len(t, snapshot.AlertCount, 0)
+}
+
+func TestRestoreStateSendsResolvedAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marathon-alerts-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := &state.FileStore{Path: filepath.Join(dir, "state.json")}
+	snapshot := state.NewSnapshot()
+	// Expired while we were down
+	snapshot.AppSuppress["/foo-check-name-1"] = time.Now().Add(-2 * time.Hour)
+	snapshot.AlertCount["/foo-check-name"] = 4
+	assert.NoError(t, store.Save(snapshot))
+
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	mgr := AlertManager{
+		Notifiers:        []notifiers.Notifier{mockNotifier},
+		SuppressDuration: 30 * time.Minute,
+		Store:            store,
+	}
+	mgr.AppSuppress = make(map[string]time.Time)
+	mgr.AlertCount = make(map[string]int)
+	mgr.restoreState()
+	mgr.cleanUpSupressedAlerts()
+
+	assert.Len(t, mgr.AppSuppress, 1)
+	mgr.processCheck(checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Pass,
+	})
+	expectedCheck := checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Resolved,
+		Times:     5,
+	}
+	mockNotifier.AssertCalled(t, "Notify", expectedCheck)
+}
+
+func TestRestoreStateKeepsWhenTheAlertsWereOpened(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marathon-alerts-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := &state.FileStore{Path: filepath.Join(dir, "state.json")}
+	openedOn := time.Now().Add(-1 * time.Hour)
+	snapshot := state.NewSnapshot()
+	snapshot.AppSuppress["/foo-check-name-2"] = openedOn
+	snapshot.OpenedOn["/foo-check-name-2"] = openedOn
+	snapshot.AlertCount["/foo-check-name"] = 1
+	assert.NoError(t, store.Save(snapshot))
+
+	slack := new(notifiers.MockNotifier)
+	slack.On("Name").Return("slack")
+	slack.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	pagerDuty := new(notifiers.MockNotifier)
+	pagerDuty.On("Name").Return("pagerduty")
+	pagerDuty.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	mgr := AlertManager{
+		AppSuppress:       make(map[string]time.Time),
+		AlertCount:        make(map[string]int),
+		Notifiers:         []notifiers.Notifier{slack, pagerDuty},
+		Escalations:       map[string]EscalationPolicy{"oncall": testEscalationPolicy()},
+		DefaultEscalation: "oncall",
+		SuppressDuration:  30 * time.Minute,
+		Store:             store,
+	}
+	mgr.restoreState()
+
+	// The suppression is renewed but the alert was still opened an hour ago
+	assert.True(t, mgr.AppSuppress["/foo-check-name-2"].After(openedOn))
+	assert.True(t, openedOn.Equal(mgr.OpenedOn["/foo-check-name-2"]))
+	mgr.processCheck(checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Pass,
+		Timestamp: time.Now(),
+	})
+	// It had escalated to pagerduty, which should hear it's resolved
+	slack.AssertNumberOfCalls(t, "Notify", 1)
+	pagerDuty.AssertNumberOfCalls(t, "Notify", 1)
+}
+
+func TestRestoreStateWithCorruptStateStartsAfresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marathon-alerts-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+
+	mgr := AlertManager{Store: &state.FileStore{Path: path}}
+	mgr.AppSuppress = make(map[string]time.Time)
+	mgr.AlertCount = make(map[string]int)
+	mgr.restoreState()
+	assert.Len(t, mgr.AppSuppress, 0)
+	assert.Len(t, mgr.AlertCount, 0)
+}
+
+func TestSnoozedChecksAreTrackedButNotNotified(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	snoozer := NewSnoozer()
+	snooze, err := snoozer.Snooze(Snooze{App: "/foo", Reason: "maintenance", Author: "ashwanthkumar"}, 1*time.Hour)
+	assert.NoError(t, err)
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		Notifiers:   []notifiers.Notifier{mockNotifier},
+		Snoozer:     snoozer,
+	}
+	check := checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Critical,
+	}
+
+	mgr.processCheck(check)
+	mockNotifier.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+	assert.Equal(t, 1, mgr.AlertCount["/foo-check-name"])
+	assert.Len(t, mgr.AppSuppress, 1)
+
+	snoozer.Cancel(snooze.ID)
+	check.Result = checks.Pass
+	mgr.processCheck(check)
+	expectedCheck := checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Resolved,
+		Times:     2,
+	}
+	mockNotifier.AssertCalled(t, "Notify", expectedCheck)
+}
+
+func TestAlertsOpenedWhileSnoozedAreNotifiedOnceTheSnoozeEnds(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	snoozer := NewSnoozer()
+	_, err := snoozer.Snooze(Snooze{App: "/foo", Reason: "deploying", Author: "ashwanthkumar"}, 100*time.Millisecond)
+	assert.NoError(t, err)
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		LastChecks:  make(map[string]checks.AppCheck),
+		Notifiers:   []notifiers.Notifier{mockNotifier},
+		Snoozer:     snoozer,
+	}
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical, Message: "Only 1 healthy"}
+	mgr.processCheck(check)
+	mgr.tick(time.Now())
+	mockNotifier.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+
+	time.Sleep(200 * time.Millisecond)
+	mgr.tick(time.Now())
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+	check.Times = 2
+	check.Message = "Still failing after the snooze ended - Only 1 healthy"
+	mockNotifier.AssertCalled(t, "Notify", check)
+
+	mgr.tick(time.Now())
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+}
+
+func TestAlertsStillHeldBackWhenTheSnoozeEndsAreNotCounted(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	snoozer := NewSnoozer()
+	_, err := snoozer.Snooze(Snooze{App: "/foo", Reason: "deploying", Author: "ashwanthkumar"}, 100*time.Millisecond)
+	assert.NoError(t, err)
+	now := time.Now()
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		LastChecks:  make(map[string]checks.AppCheck),
+		Notifiers:   []notifiers.Notifier{mockNotifier},
+		Snoozer:     snoozer,
+		Maintenance: NewMaintenanceWindows([]maintenance.Window{
+			maintenance.Window{Name: "patching", Start: now.Add(-1 * time.Hour), End: now.Add(1 * time.Hour)},
+		}),
+	}
+	mgr.processCheck(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical})
+
+	time.Sleep(200 * time.Millisecond)
+	mgr.tick(time.Now())
+	mockNotifier.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+	assert.Equal(t, 1, mgr.AlertCount["/foo-min-healthy"])
+}
+
+func TestCurrentChecksReturnsLatestResultOfEveryCheck(t *testing.T) {
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		LastChecks:  make(map[string]checks.AppCheck),
+	}
+	mgr.processCheck(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Pass})
+	mgr.processCheck(checks.AppCheck{App: "/bar", CheckName: "min-healthy", Result: checks.Pass, Labels: map[string]string{"alerts.enabled": "false"}})
+	mgr.processCheck(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Warning, Message: "latest"})
+
+	currentChecks := mgr.CurrentChecks()
+	assert.Len(t, currentChecks, 2)
+	assert.Equal(t, "/bar", currentChecks[0].App)
+	assert.Equal(t, "/foo", currentChecks[1].App)
+	assert.Equal(t, "latest", currentChecks[1].Message)
+}
+
+func TestReconfigureSwapsNotifiersAndDefaultRoutes(t *testing.T) {
+	oldNotifier := new(notifiers.MockNotifier)
+	oldNotifier.On("Name").Return("old")
+	oldNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	newNotifier := new(notifiers.MockNotifier)
+	newNotifier.On("Name").Return("new")
+	newNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		Notifiers:   []notifiers.Notifier{oldNotifier},
+	}
+	mgr.Reconfigure([]notifiers.Notifier{oldNotifier, newNotifier}, AlertsConfig{SuppressDuration: 10 * time.Minute, Routes: "*/critical/new"}, nil)
+	assert.Equal(t, 10*time.Minute, mgr.SuppressDuration)
+
+	check := checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Critical,
+	}
+	mgr.processCheck(check)
+	oldNotifier.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+	newNotifier.AssertNumberOfCalls(t, "Notify", 1)
+	// The open alert survives the reload
+	assert.Equal(t, 1, mgr.AlertCount["/foo-check-name"])
+}
+
+func TestStopDrainsQueuedChecksAndSavesState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marathon-alerts-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := &state.FileStore{Path: filepath.Join(dir, "state.json")}
+
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	checkerChan := make(chan checks.AppCheck, 2)
+	mgr := AlertManager{
+		CheckerChan:      checkerChan,
+		SuppressDuration: 30 * time.Minute,
+		Notifiers:        []notifiers.Notifier{mockNotifier},
+		Store:            store,
+	}
+	mgr.Start()
+	checkerChan <- checks.AppCheck{App: "/foo", CheckName: "check-name", Result: checks.Critical, Timestamp: time.Now()}
+	checkerChan <- checks.AppCheck{App: "/bar", CheckName: "check-name", Result: checks.Warning, Timestamp: time.Now()}
+	mgr.Stop()
+	// Safe to call again
+	mgr.Stop()
+
+	assert.Len(t, checkerChan, 0)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 2)
+	snapshot, err := store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, snapshot.AppSuppress, 2)
+}
+
+func TestStopGivesUpOnNotificationsAfterShutdownTimeout(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil).After(1 * time.Hour)
+	checkerChan := make(chan checks.AppCheck, 1)
+	mgr := AlertManager{
+		CheckerChan:     checkerChan,
+		Notifiers:       []notifiers.Notifier{mockNotifier},
+		ShutdownTimeout: 50 * time.Millisecond,
+	}
+	mgr.Start()
+	checkerChan <- checks.AppCheck{App: "/foo", CheckName: "check-name", Result: checks.Critical}
+
+	stopped := make(chan bool)
+	go func() {
+		mgr.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Expected Stop to give up after the ShutdownTimeout")
+	}
+}
+
+func testEscalationPolicy() EscalationPolicy {
+	return EscalationPolicy{
+		Name: "oncall",
+		Steps: []EscalationStep{
+			EscalationStep{After: 0, Notifiers: "slack", Repeat: 15 * time.Minute},
+			EscalationStep{After: 30 * time.Minute, Notifiers: "pagerduty"},
+		},
+	}
+}
+
+func TestEscalationNotifiesStepsAsTheyAreDue(t *testing.T) {
+	slack := new(notifiers.MockNotifier)
+	slack.On("Name").Return("slack")
+	slack.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	pagerDuty := new(notifiers.MockNotifier)
+	pagerDuty.On("Name").Return("pagerduty")
+	pagerDuty.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	openedOn := time.Now().Add(-1 * time.Hour)
+	mgr := AlertManager{
+		AppSuppress:       make(map[string]time.Time),
+		AlertCount:        make(map[string]int),
+		LastChecks:        make(map[string]checks.AppCheck),
+		Notifiers:         []notifiers.Notifier{slack, pagerDuty},
+		Escalations:       map[string]EscalationPolicy{"oncall": testEscalationPolicy()},
+		DefaultEscalation: "oncall",
+		SuppressDuration:  1 * time.Minute,
+		lastTick:          openedOn,
+	}
+	check := checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Critical,
+		Timestamp: openedOn,
+	}
+
+	mgr.processCheck(check)
+	slack.AssertNumberOfCalls(t, "Notify", 1)
+	pagerDuty.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+
+	mgr.tick(openedOn.Add(10 * time.Minute))
+	slack.AssertNumberOfCalls(t, "Notify", 1)
+	mgr.tick(openedOn.Add(16 * time.Minute))
+	slack.AssertNumberOfCalls(t, "Notify", 2)
+	pagerDuty.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+	mgr.tick(openedOn.Add(31 * time.Minute))
+	slack.AssertNumberOfCalls(t, "Notify", 3)
+	pagerDuty.AssertNumberOfCalls(t, "Notify", 1)
+	assert.Equal(t, 3, mgr.AlertCount["/foo-check-name"])
+
+	// Escalated alerts aren't re-notified after the SuppressDuration
+	mgr.cleanUpSupressedAlerts()
+	assert.Len(t, mgr.AppSuppress, 1)
+
+	check.Result = checks.Pass
+	check.Timestamp = openedOn.Add(40 * time.Minute)
+	mgr.processCheck(check)
+	slack.AssertNumberOfCalls(t, "Notify", 4)
+	pagerDuty.AssertNumberOfCalls(t, "Notify", 2)
+}
+
+func TestAlertsOfDeletedAppsAreForgotten(t *testing.T) {
+	slack := new(notifiers.MockNotifier)
+	slack.On("Name").Return("slack")
+	slack.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	openedOn := time.Now().Add(-1 * time.Hour)
+	mgr := AlertManager{
+		AppSuppress:       make(map[string]time.Time),
+		AlertCount:        make(map[string]int),
+		LastChecks:        make(map[string]checks.AppCheck),
+		Acks:              make(map[string]state.Ack),
+		Notifiers:         []notifiers.Notifier{slack},
+		Escalations:       map[string]EscalationPolicy{"oncall": testEscalationPolicy()},
+		DefaultEscalation: "oncall",
+		SuppressDuration:  1 * time.Minute,
+		lastTick:          openedOn,
+	}
+	for _, app := range []string{"/foo", "/bar"} {
+		mgr.processCheck(checks.AppCheck{
+			Cluster:   "prod",
+			App:       app,
+			CheckName: "check-name",
+			Result:    checks.Critical,
+			Timestamp: openedOn,
+		})
+	}
+	slack.AssertNumberOfCalls(t, "Notify", 2)
+
+	mgr.ForgetApp("prod", "/foo")
+	assert.Len(t, mgr.AppSuppress, 1)
+	assert.Len(t, mgr.AlertCount, 1)
+	assert.Len(t, mgr.LastChecks, 1)
+	_, present := mgr.AppSuppress["prod:/bar-check-name-1"]
+	assert.True(t, present)
+
+	// Only /bar is repeated
+	mgr.tick(openedOn.Add(16 * time.Minute))
+	slack.AssertNumberOfCalls(t, "Notify", 3)
+	var notified []string
+	for _, call := range slack.Calls {
+		if call.Method == "Notify" {
+			notified = append(notified, call.Arguments.Get(0).(checks.AppCheck).App)
+		}
+	}
+	assert.Equal(t, "/bar", notified[2])
+
+	// The same app on another cluster is left alone
+	mgr.ForgetApp("", "/bar")
+	assert.Len(t, mgr.AppSuppress, 1)
+}
+
+func TestForgetAppPrunesEverythingTrackedForTheApp(t *testing.T) {
+	slack := new(notifiers.MockNotifier)
+	slack.On("Name").Return("slack")
+	slack.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	mgr := AlertManager{
+		AppSuppress:   make(map[string]time.Time),
+		AlertCount:    make(map[string]int),
+		LastChecks:    make(map[string]checks.AppCheck),
+		Notifiers:     []notifiers.Notifier{slack},
+		FlapDetection: FlapDetection{History: 5, HighThreshold: 50, LowThreshold: 25},
+	}
+	for _, result := range []checks.CheckStatus{checks.Critical, checks.Pass, checks.Critical} {
+		mgr.processCheck(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: result})
+	}
+	assert.True(t, mgr.Flapping["/foo-min-healthy"])
+
+	mgr.ForgetApp("", "/foo")
+	assert.Len(t, mgr.CurrentChecks(), 0)
+	assert.Len(t, mgr.Streaks, 0)
+	assert.Len(t, mgr.StateHistory, 0)
+	assert.Len(t, mgr.Flapping, 0)
+	assert.Len(t, mgr.History, 0)
+	assert.Len(t, mgr.LastNotified, 0)
+}
+
+func TestEscalationPolicyFromAppLabel(t *testing.T) {
+	slack := new(notifiers.MockNotifier)
+	slack.On("Name").Return("slack")
+	slack.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	pagerDuty := new(notifiers.MockNotifier)
+	pagerDuty.On("Name").Return("pagerduty")
+	pagerDuty.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		Notifiers:   []notifiers.Notifier{slack, pagerDuty},
+		Escalations: map[string]EscalationPolicy{"oncall": testEscalationPolicy()},
+	}
+	mgr.processCheck(checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Critical,
+		Labels:    map[string]string{"alerts.escalation": "oncall"},
+	})
+	mgr.processCheck(checks.AppCheck{
+		App:       "/bar",
+		CheckName: "check-name",
+		Result:    checks.Critical,
+	})
+	slack.AssertNumberOfCalls(t, "Notify", 2)
+	pagerDuty.AssertNumberOfCalls(t, "Notify", 1)
+}
+
+func TestAckedAlertsAreNotNotifiedAgainUntilResolved(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	mgr := AlertManager{
+		AppSuppress:      make(map[string]time.Time),
+		AlertCount:       make(map[string]int),
+		Notifiers:        []notifiers.Notifier{mockNotifier},
+		SuppressDuration: 1 * time.Minute,
+	}
+	check := checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Critical,
+		Timestamp: time.Now().Add(-5 * time.Minute),
+	}
+	_, acked := mgr.Ack("", "/foo", "check-name", "ashwanthkumar", "Looking into it")
+	assert.False(t, acked)
+
+	mgr.processCheck(check)
+	ack, acked := mgr.Ack("", "/foo", "check-name", "ashwanthkumar", "Looking into it")
+	assert.True(t, acked)
+	assert.Equal(t, "ashwanthkumar", ack.By)
+
+	mgr.cleanUpSupressedAlerts()
+	mgr.processCheck(check)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+
+	check.Result = checks.Pass
+	mgr.processCheck(check)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 2)
+	mockNotifier.AssertCalled(t, "Notify", checks.AppCheck{
+		App:        "/foo",
+		CheckName:  "check-name",
+		Result:     checks.Resolved,
+		Timestamp:  check.Timestamp,
+		Times:      2,
+		AckedBy:    "ashwanthkumar",
+		AckComment: "Looking into it",
+		OpenedAt:   check.Timestamp,
+	})
+	assert.Len(t, mgr.Acks, 0)
+}
+
+func TestAckIsDroppedWhenTheAlertChangesLevel(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		Notifiers:   []notifiers.Notifier{mockNotifier},
+	}
+	check := checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Warning,
+	}
+	mgr.processCheck(check)
+	mgr.Ack("", "/foo", "check-name", "ashwanthkumar", "")
+	check.Result = checks.Critical
+	mgr.processCheck(check)
+
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 2)
+	assert.Len(t, mgr.Acks, 0)
+}
+
+func TestAckedAlertsAreNotEscalated(t *testing.T) {
+	slack := new(notifiers.MockNotifier)
+	slack.On("Name").Return("slack")
+	slack.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	openedOn := time.Now().Add(-1 * time.Hour)
+	mgr := AlertManager{
+		AppSuppress:       make(map[string]time.Time),
+		AlertCount:        make(map[string]int),
+		LastChecks:        make(map[string]checks.AppCheck),
+		Notifiers:         []notifiers.Notifier{slack},
+		Escalations:       map[string]EscalationPolicy{"oncall": testEscalationPolicy()},
+		DefaultEscalation: "oncall",
+		lastTick:          openedOn,
+	}
+	mgr.processCheck(checks.AppCheck{
+		App:       "/foo",
+		CheckName: "check-name",
+		Result:    checks.Critical,
+		Timestamp: openedOn,
+	})
+	mgr.Ack("", "/foo", "check-name", "ashwanthkumar", "")
+	mgr.tick(openedOn.Add(16 * time.Minute))
+	slack.AssertNumberOfCalls(t, "Notify", 1)
+}
+
+func TestMaintenanceHoldsBackNotificationsTillTheWindowCloses(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	now := time.Now()
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		LastChecks:  make(map[string]checks.AppCheck),
+		Notifiers:   []notifiers.Notifier{mockNotifier},
+		Maintenance: NewMaintenanceWindows([]maintenance.Window{
+			maintenance.Window{Name: "patching", Start: now.Add(-1 * time.Hour), End: now.Add(200 * time.Millisecond)},
+		}),
+		lastTick: now,
+	}
+	broken := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical, Message: "Only 1 healthy"}
+	mgr.processCheck(broken)
+	mgr.processCheck(checks.AppCheck{App: "/bar", CheckName: "min-healthy", Result: checks.Warning})
+	mgr.processCheck(checks.AppCheck{App: "/bar", CheckName: "min-healthy", Result: checks.Pass})
+	mgr.tick(now.Add(100 * time.Millisecond))
+	mockNotifier.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+
+	time.Sleep(300 * time.Millisecond)
+	mgr.tick(time.Now())
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+	broken.Times = 2
+	broken.Message = "Still failing after the maintenance window patching - Only 1 healthy"
+	mockNotifier.AssertCalled(t, "Notify", broken)
+}
+
+func TestMaintenanceSendsASummaryPerNotifierWhenTheWindowCloses(t *testing.T) {
+	slack := new(notifiers.MockDigestNotifier)
+	slack.On("Name").Return("slack")
+	slack.On("NotifyDigest", mock.AnythingOfType("Digest")).Return(nil)
+	pagerduty := new(notifiers.MockNotifier)
+	pagerduty.On("Name").Return("pagerduty")
+	pagerduty.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	now := time.Now()
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		LastChecks:  make(map[string]checks.AppCheck),
+		Notifiers:   []notifiers.Notifier{slack, pagerduty},
+		Maintenance: NewMaintenanceWindows([]maintenance.Window{
+			maintenance.Window{Name: "patching", Start: now.Add(-1 * time.Hour), End: now.Add(200 * time.Millisecond)},
+		}),
+		lastTick: now,
+	}
+	mgr.processCheck(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical})
+	mgr.processCheck(checks.AppCheck{App: "/bar", CheckName: "min-healthy", Result: checks.Warning})
+	time.Sleep(300 * time.Millisecond)
+	mgr.tick(time.Now())
+
+	slack.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+	slack.AssertNumberOfCalls(t, "NotifyDigest", 1)
+	var summary notifiers.Digest
+	for _, call := range slack.Calls {
+		if call.Method == "NotifyDigest" {
+			summary = call.Arguments.Get(0).(notifiers.Digest)
+		}
+	}
+	assert.Equal(t, "maintenance window", summary.GroupBy)
+	assert.Equal(t, "patching", summary.Group)
+	assert.Len(t, summary.Checks, 2)
+	pagerduty.AssertNumberOfCalls(t, "Notify", 2)
+}
+
+func TestFlappingCheckIsNotifiedWhenItStartsAndStopsFlapping(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	mgr := AlertManager{
+		AppSuppress:   make(map[string]time.Time),
+		AlertCount:    make(map[string]int),
+		Notifiers:     []notifiers.Notifier{mockNotifier},
+		FlapDetection: FlapDetection{History: 5, HighThreshold: 50, LowThreshold: 25},
+	}
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Message: "Only 2 healthy"}
+	process := func(results ...checks.CheckStatus) {
+		for _, result := range results {
+			check.Result = result
+			mgr.processCheck(check)
+		}
+	}
+
+	process(checks.Warning, checks.Pass)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 2)
+	process(checks.Warning)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 3)
+	assert.True(t, mgr.Flapping["/foo-min-healthy"])
+	mockNotifier.AssertCalled(t, "Notify", checks.AppCheck{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Warning,
+		Message:   "Started flapping, the result changed in 57% of the last 5 checks - Only 2 healthy",
+		Times:     1,
+	})
+
+	process(checks.Pass, checks.Warning, checks.Warning, checks.Warning)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 3)
+	process(checks.Warning)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 4)
+	assert.False(t, mgr.Flapping["/foo-min-healthy"])
+	mockNotifier.AssertCalled(t, "Notify", checks.AppCheck{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Warning,
+		Message:   "Stopped flapping, the result changed in 20% of the last 5 checks - Only 2 healthy",
+		Times:     1,
+	})
+
+	process(checks.Pass)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 5)
+}
+
+func TestFlapDetectionIsOffWithoutHistory(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		Notifiers:   []notifiers.Notifier{mockNotifier},
+	}
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy"}
+	for i := 0; i < 10; i++ {
+		check.Result = checks.Warning
+		mgr.processCheck(check)
+		check.Result = checks.Pass
+		mgr.processCheck(check)
+	}
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 20)
+	assert.Len(t, mgr.Flapping, 0)
+}
+
+func TestAlertIsOpenedAndResolvedAfterConsecutiveResults(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	mgr := AlertManager{
+		AppSuppress:  make(map[string]time.Time),
+		AlertCount:   make(map[string]int),
+		LastChecks:   make(map[string]checks.AppCheck),
+		Notifiers:    []notifiers.Notifier{mockNotifier},
+		FailAfter:    3,
+		ResolveAfter: 2,
+	}
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy"}
+	process := func(results ...checks.CheckStatus) {
+		for _, result := range results {
+			check.Result = result
+			mgr.processCheck(check)
+		}
+	}
+
+	// A single bad poll is never alerted on
+	process(checks.Critical, checks.Pass, checks.Warning, checks.Critical)
+	mockNotifier.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+	assert.Equal(t, 1, mgr.CheckStates()[0].Pending)
+
+	process(checks.Critical)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+	assert.Len(t, mgr.AppSuppress, 1)
+	checkState := mgr.CheckStates()[0]
+	assert.Equal(t, checks.Critical, checkState.Alert)
+	assert.Equal(t, 0, checkState.Pending)
+	assert.Equal(t, 1, checkState.Times)
+	assert.False(t, checkState.LastNotified.IsZero())
+
+	process(checks.Pass, checks.Critical, checks.Pass)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+	assert.Equal(t, 1, mgr.CheckStates()[0].Pending)
+
+	process(checks.Pass)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 2)
+	assert.Len(t, mgr.AppSuppress, 0)
+}
+
+func TestFailAfterAndResolveAfterFromAppLabels(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("mock-notifer")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		LastChecks:  make(map[string]checks.AppCheck),
+		Notifiers:   []notifiers.Notifier{mockNotifier},
+		FailAfter:   5,
+	}
+	check := checks.AppCheck{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Warning,
+		Labels: map[string]string{
+			"alerts.min-healthy.fail-after":    "2",
+			"alerts.min-healthy.resolve-after": "not-a-number",
+		},
+	}
+	mgr.processCheck(check)
+	mockNotifier.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+	mgr.processCheck(check)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 1)
+
+	// Falls back to ResolveAfter
+	check.Result = checks.Pass
+	mgr.processCheck(check)
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 2)
+}
+
+func TestNotificationsWithinTheGroupWindowAreSentAsADigest(t *testing.T) {
+	slack := new(notifiers.MockDigestNotifier)
+	slack.On("Name").Return("slack")
+	slack.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	slack.On("NotifyDigest", mock.AnythingOfType("Digest")).Return(nil)
+	pagerduty := new(notifiers.MockNotifier)
+	pagerduty.On("Name").Return("pagerduty")
+	pagerduty.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		Notifiers:   []notifiers.Notifier{slack, pagerduty},
+		GroupWindow: 1 * time.Minute,
+		GroupBy:     GroupByCluster,
+		lastTick:    time.Now(),
+	}
+	foo := checks.AppCheck{Cluster: "prod", App: "/foo", CheckName: "min-healthy", Result: checks.Critical}
+	bar := checks.AppCheck{Cluster: "prod", App: "/bar", CheckName: "min-healthy", Result: checks.Critical}
+	baz := checks.AppCheck{Cluster: "staging", App: "/baz", CheckName: "min-healthy", Result: checks.Warning}
+	mgr.processCheck(foo)
+	mgr.processCheck(bar)
+	mgr.processCheck(baz)
+	// Notifiers that don't take digests are notified right away
+	pagerduty.AssertNumberOfCalls(t, "Notify", 3)
+
+	mgr.tick(time.Now())
+	slack.AssertNotCalled(t, "NotifyDigest", mock.AnythingOfType("Digest"))
+	slack.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+
+	mgr.tick(time.Now().Add(2 * time.Minute))
+	foo.Times = 1
+	bar.Times = 1
+	baz.Times = 1
+	slack.AssertNumberOfCalls(t, "NotifyDigest", 1)
+	slack.AssertCalled(t, "NotifyDigest", notifiers.Digest{
+		GroupBy: GroupByCluster,
+		Group:   "prod",
+		Checks:  []checks.AppCheck{foo, bar},
+	})
+	// A digest of a single check is a regular notification
+	slack.AssertNumberOfCalls(t, "Notify", 1)
+	slack.AssertCalled(t, "Notify", baz)
+	assert.Len(t, mgr.digests, 0)
+}
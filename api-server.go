@@ -0,0 +1,436 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/maintenance"
+	"github.com/ashwanthkumar/marathon-alerts/state"
+	"github.com/rcrowley/go-metrics"
+	"github.com/ryanuber/go-glob"
+)
+
+// APIServer is the embedded HTTP server to control marathon-alerts at runtime
+type APIServer struct {
+	Address      string
+	Snoozer      *Snoozer
+	Maintenance  *MaintenanceWindows
+	AlertManager *AlertManager
+	AppCheckers  []*AppChecker // optional, their status is shown on the dashboard
+	// Debug exposes the debug metrics on /metrics too, they've a metric per app
+	Debug    bool
+	listener net.Listener
+}
+
+type snoozeRequest struct {
+	Cluster   string `json:"cluster"`
+	App       string `json:"app"`
+	CheckName string `json:"check"`
+	Duration  string `json:"duration"`
+	Reason    string `json:"reason"`
+	Author    string `json:"author"`
+}
+
+// maintenanceRequest is a maintenance.Window, with the duration like 30m or 2h. One-off
+// windows can be given a duration instead of an end, they start now unless there's a start.
+type maintenanceRequest struct {
+	Name      string    `json:"name"`
+	Cluster   string    `json:"cluster"`
+	App       string    `json:"app"`
+	Group     string    `json:"group"`
+	CheckName string    `json:"check"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Cron      string    `json:"cron"`
+	Duration  string    `json:"duration"`
+	TimeZone  string    `json:"timeZone"`
+}
+
+type ackRequest struct {
+	Cluster   string `json:"cluster"`
+	App       string `json:"app"`
+	CheckName string `json:"check"`
+	User      string `json:"user"`
+	Comment   string `json:"comment"`
+}
+
+// checkStatus is a CheckState in the status API
+type checkStatus struct {
+	Cluster   string    `json:"cluster,omitempty"`
+	App       string    `json:"app"`
+	CheckName string    `json:"check"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+	// Alert is the level of the open alert, Passed when there's none
+	Alert        string     `json:"alert"`
+	Pending      int        `json:"pending"`
+	Since        time.Time  `json:"since"`
+	Times        int        `json:"times"`
+	LastNotified time.Time  `json:"lastNotified"`
+	Snoozed      bool       `json:"snoozed"`
+	Ack          *state.Ack `json:"ack,omitempty"`
+}
+
+// transition is a Transition in the history API
+type transition struct {
+	Cluster   string    `json:"cluster,omitempty"`
+	App       string    `json:"app"`
+	CheckName string    `json:"check"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// checkFilter picks the checks with the cluster, app and check query parameters,
+// which are globs and match everything when missing
+type checkFilter struct {
+	cluster   string
+	app       string
+	checkName string
+}
+
+func newCheckFilter(query url.Values) checkFilter {
+	return checkFilter{cluster: query.Get("cluster"), app: query.Get("app"), checkName: query.Get("check")}
+}
+
+func (f checkFilter) matches(cluster, app, checkName string) bool {
+	return (f.cluster == "" || glob.Glob(f.cluster, cluster)) &&
+		(f.app == "" || glob.Glob(f.app, app)) &&
+		(f.checkName == "" || glob.Glob(f.checkName, checkName))
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *APIServer) Start() error {
+	log.Println("Starting API Server...")
+	listener, err := net.Listen("tcp", s.Address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go http.Serve(listener, s.Handler())
+	log.Printf("API Server Started on %s.\n", listener.Addr())
+	return nil
+}
+
+func (s *APIServer) Stop() {
+	log.Println("Stopping API Server...")
+	s.listener.Close()
+}
+
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/snoozes", s.snoozes)
+	mux.HandleFunc("/api/snoozes/", s.snooze)
+	mux.HandleFunc("/api/acks", s.acks)
+	mux.HandleFunc("/api/status", s.status)
+	mux.HandleFunc("/api/history", s.history)
+	mux.HandleFunc("/api/maintenance", s.maintenanceWindows)
+	mux.HandleFunc("/api/maintenance/", s.maintenanceWindow)
+	mux.HandleFunc("/metrics", s.metrics)
+	mux.HandleFunc("/", s.dashboard)
+	return mux
+}
+
+// GET /api/snoozes lists the active snoozes, POST /api/snoozes adds a new one
+func (s *APIServer) snoozes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, s.Snoozer.Active())
+	case "POST":
+		if !requireJSON(w, r) {
+			return
+		}
+		var request snoozeRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Unable to parse the snooze - "+err.Error())
+			return
+		}
+		if request.Author == "" || request.Reason == "" {
+			writeError(w, http.StatusBadRequest, "Expected both author and reason for the snooze")
+			return
+		}
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Expected duration like 30m or 2h - "+err.Error())
+			return
+		}
+		snooze, err := s.Snoozer.Snooze(Snooze{
+			Cluster:   request.Cluster,
+			App:       request.App,
+			CheckName: request.CheckName,
+			Reason:    request.Reason,
+			Author:    request.Author,
+		}, duration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("[Snooze] %s snoozed App: %q, Check: %q until %v, Reason: %s\n", snooze.Author, snooze.App, snooze.CheckName, snooze.Until, snooze.Reason)
+		writeJSON(w, http.StatusCreated, snooze)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Expected GET or POST")
+	}
+}
+
+// DELETE /api/snoozes/<id> cancels a snooze before it expires
+func (s *APIServer) snooze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		writeError(w, http.StatusMethodNotAllowed, "Expected DELETE")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/snoozes/")
+	if !s.Snoozer.Cancel(id) {
+		writeError(w, http.StatusNotFound, "No active snooze with id "+id)
+		return
+	}
+	log.Printf("[Snooze] Cancelled snooze %s\n", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/maintenance lists the maintenance windows, POST /api/maintenance adds a new one
+func (s *APIServer) maintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, s.Maintenance.All())
+	case "POST":
+		if !requireJSON(w, r) {
+			return
+		}
+		var request maintenanceRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Unable to parse the maintenance window - "+err.Error())
+			return
+		}
+		window := maintenance.Window{
+			Name:      request.Name,
+			Cluster:   request.Cluster,
+			App:       request.App,
+			Group:     request.Group,
+			CheckName: request.CheckName,
+			Start:     request.Start,
+			End:       request.End,
+			Cron:      request.Cron,
+			TimeZone:  request.TimeZone,
+		}
+		if request.Duration != "" {
+			window.Duration, err = time.ParseDuration(request.Duration)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Expected duration like 30m or 2h - "+err.Error())
+				return
+			}
+		}
+		if window.Cron == "" && window.End.IsZero() {
+			if window.Start.IsZero() {
+				window.Start = time.Now()
+			}
+			window.End = window.Start.Add(window.Duration)
+			window.Duration = 0
+		}
+		window, err = s.Maintenance.Add(window)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("[Maintenance] Added window %s (%s) for Cluster: %q, App: %q, Group: %q, Check: %q\n", window.Name, window.ID, window.Cluster, window.App, window.Group, window.CheckName)
+		writeJSON(w, http.StatusCreated, window)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Expected GET or POST")
+	}
+}
+
+// DELETE /api/maintenance/<id> removes a maintenance window that was added through the API
+func (s *APIServer) maintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		writeError(w, http.StatusMethodNotAllowed, "Expected DELETE")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/maintenance/")
+	if !s.Maintenance.Remove(id) {
+		writeError(w, http.StatusNotFound, "No maintenance window added through the API with id "+id)
+		return
+	}
+	log.Printf("[Maintenance] Removed window %s\n", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/acks acks the open alert of an app and check
+func (s *APIServer) acks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Expected POST")
+		return
+	}
+	if !requireJSON(w, r) {
+		return
+	}
+	var request ackRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Unable to parse the ack - "+err.Error())
+		return
+	}
+	if request.App == "" || request.CheckName == "" || request.User == "" {
+		writeError(w, http.StatusBadRequest, "Expected app, check and user for the ack")
+		return
+	}
+	ack, acked := s.AlertManager.Ack(request.Cluster, request.App, request.CheckName, request.User, request.Comment)
+	if !acked {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No open alert for app %s and check %s", request.App, request.CheckName))
+		return
+	}
+	log.Printf("[Ack] %s acked App: %s, Check: %s, Comment: %s\n", ack.By, request.App, request.CheckName, ack.Comment)
+	writeJSON(w, http.StatusCreated, ack)
+}
+
+// GET /api/status lists the latest result of every app and check, with the level of
+// its open alert and the # of results still pending before the alert changes. The
+// cluster, app and check query parameters filter them, and level picks the ones
+// with an open alert of that level (passed for the ones without).
+func (s *APIServer) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Expected GET")
+		return
+	}
+	filter := newCheckFilter(r.URL.Query())
+	level := r.URL.Query().Get("level")
+	statuses := []checkStatus{}
+	for _, state := range s.AlertManager.CheckStates() {
+		alert := checks.CheckStatusToString(state.Alert)
+		if !filter.matches(state.Cluster, state.App, state.CheckName) || (level != "" && !strings.EqualFold(level, alert)) {
+			continue
+		}
+		statuses = append(statuses, checkStatus{
+			Cluster:      state.Cluster,
+			App:          state.App,
+			CheckName:    state.CheckName,
+			Status:       checks.CheckStatusToString(state.Result),
+			Message:      state.Message,
+			Timestamp:    state.Timestamp,
+			Alert:        alert,
+			Pending:      state.Pending,
+			Since:        state.Since,
+			Times:        state.Times,
+			LastNotified: state.LastNotified,
+			Snoozed:      state.Snoozed,
+			Ack:          state.Ack,
+		})
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// GET /api/history lists the transitions of the alerts, oldest first. The cluster,
+// app and check query parameters filter them like in /api/status, and from and to
+// (RFC 3339) limit them to [from, to).
+func (s *APIServer) history(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Expected GET")
+		return
+	}
+	var from, to time.Time
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Expected from like 2006-01-02T15:04:05Z - "+err.Error())
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Expected to like 2006-01-02T15:04:05Z - "+err.Error())
+			return
+		}
+	}
+	filter := newCheckFilter(r.URL.Query())
+	transitions := []transition{}
+	for _, t := range s.AlertManager.Transitions(from, to) {
+		if !filter.matches(t.Cluster, t.App, t.CheckName) {
+			continue
+		}
+		transitions = append(transitions, transition{
+			Cluster:   t.Cluster,
+			App:       t.App,
+			CheckName: t.CheckName,
+			From:      checks.CheckStatusToString(t.From),
+			To:        checks.CheckStatusToString(t.To),
+			Message:   t.Message,
+			Timestamp: t.Timestamp,
+		})
+	}
+	writeJSON(w, http.StatusOK, transitions)
+}
+
+// GET / is the dashboard, an HTML page with the open alerts, every app and check, the
+// snoozes and the maintenance windows
+func (s *APIServer) dashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Expected GET")
+		return
+	}
+	var clusters []AppCheckerStatus
+	for _, appChecker := range s.AppCheckers {
+		clusters = append(clusters, appChecker.Status())
+	}
+	var windows []maintenance.Window
+	if s.Maintenance != nil {
+		windows = s.Maintenance.All()
+	}
+	page := newDashboard(time.Now(), s.AlertManager.CheckStates(), clusters, s.Snoozer.Active(), windows)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, page)
+	if err != nil {
+		log.Printf("Error - Unable to render the dashboard - %v\n", err)
+	}
+}
+
+// GET /metrics exposes all the metrics and the current status of every check for Prometheus
+func (s *APIServer) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WritePrometheusMetrics(w, PrometheusNamespace, metrics.DefaultRegistry)
+	if s.Debug && DebugMetricsRegistry != nil {
+		WritePrometheusDebugMetrics(w, PrometheusNamespace, DebugMetricsRegistry)
+	}
+	if s.AlertManager != nil {
+		WritePrometheusCheckStatus(w, PrometheusNamespace, s.AlertManager.CurrentChecks())
+	}
+}
+
+// requireJSON rejects the request unless its body is JSON. A form on another site
+// can't send JSON without a CORS preflight, so it can't ack or snooze for us.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "Expected a Content-Type of application/json")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/maintenance"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIServerSnoozeLifecycle(t *testing.T) {
+	apiServer := APIServer{Snoozer: NewSnoozer()}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	body := `{"app": "/foo", "check": "min-healthy", "duration": "30m", "reason": "deploying", "author": "ashwanthkumar"}`
+	resp, err := http.Post(server.URL+"/api/snoozes", "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created Snooze
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	assert.Equal(t, "/foo", created.App)
+	assert.Equal(t, "min-healthy", created.CheckName)
+	assert.Equal(t, "ashwanthkumar", created.Author)
+	assert.Equal(t, 30*time.Minute, created.Until.Sub(created.CreatedAt))
+
+	resp, err = http.Get(server.URL + "/api/snoozes")
+	assert.NoError(t, err)
+	var active []Snooze
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&active))
+	resp.Body.Close()
+	assert.Len(t, active, 1)
+	assert.Equal(t, created.ID, active[0].ID)
+
+	req, _ := http.NewRequest("DELETE", server.URL+"/api/snoozes/"+created.ID, nil)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Len(t, apiServer.Snoozer.Active(), 0)
+
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAPIServerRejectsInvalidSnoozes(t *testing.T) {
+	apiServer := APIServer{Snoozer: NewSnoozer()}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	invalidSnoozes := []string{
+		`{"duration": "30m", "reason": "maintenance"}`,
+		`{"duration": "30m", "author": "ashwanthkumar"}`,
+		`{"duration": "forever", "reason": "maintenance", "author": "ashwanthkumar"}`,
+		`{"duration": "-5m", "reason": "maintenance", "author": "ashwanthkumar"}`,
+		`not json`,
+	}
+	for _, body := range invalidSnoozes {
+		resp, err := http.Post(server.URL+"/api/snoozes", "application/json", strings.NewReader(body))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+	}
+	assert.Len(t, apiServer.Snoozer.Active(), 0)
+}
+
+func TestAPIServerMaintenanceLifecycle(t *testing.T) {
+	apiServer := APIServer{Snoozer: NewSnoozer(), Maintenance: NewMaintenanceWindows(nil)}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	body := `{"name": "mesos upgrade", "group": "/payments", "duration": "2h"}`
+	resp, err := http.Post(server.URL+"/api/maintenance", "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created maintenance.Window
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	assert.Equal(t, "/payments", created.Group)
+	assert.Equal(t, 2*time.Hour, created.End.Sub(created.Start))
+
+	body = `{"name": "patching", "cron": "0 22 * * 2", "duration": "4h", "timeZone": "Asia/Kolkata"}`
+	resp, err = http.Post(server.URL+"/api/maintenance", "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/api/maintenance")
+	assert.NoError(t, err)
+	var windows []maintenance.Window
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&windows))
+	resp.Body.Close()
+	assert.Len(t, windows, 2)
+	assert.Equal(t, 4*time.Hour, windows[1].Duration)
+
+	// What we list can be added back as it is
+	listed, err := json.Marshal(windows[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(listed), `"duration":"4h0m0s"`)
+	resp, err = http.Post(server.URL+"/api/maintenance", "application/json", strings.NewReader(string(listed)))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var readded maintenance.Window
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&readded))
+	resp.Body.Close()
+	assert.Equal(t, windows[1].Cron, readded.Cron)
+	assert.Equal(t, windows[1].Duration, readded.Duration)
+	assert.True(t, apiServer.Maintenance.Remove(readded.ID))
+
+	req, _ := http.NewRequest("DELETE", server.URL+"/api/maintenance/"+created.ID, nil)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Len(t, apiServer.Maintenance.All(), 1)
+}
+
+func TestAPIServerRejectsInvalidMaintenanceWindows(t *testing.T) {
+	apiServer := APIServer{Snoozer: NewSnoozer(), Maintenance: NewMaintenanceWindows(nil)}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	invalidWindows := []string{
+		`{"duration": "2h"}`,
+		`{"name": "patching", "duration": "forever"}`,
+		`{"name": "patching", "cron": "0 22 * *", "duration": "4h"}`,
+		`{"name": "patching", "cron": "0 22 * * 2"}`,
+		`not json`,
+	}
+	for _, body := range invalidWindows {
+		resp, err := http.Post(server.URL+"/api/maintenance", "application/json", strings.NewReader(body))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+	}
+	assert.Len(t, apiServer.Maintenance.All(), 0)
+}
+
+func TestAPIServerAcks(t *testing.T) {
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+	}
+	mgr.processCheck(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical})
+	apiServer := APIServer{Snoozer: NewSnoozer(), AlertManager: &mgr}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	body := `{"app": "/foo", "check": "min-healthy", "user": "ashwanthkumar", "comment": "Looking into it"}`
+	resp, err := http.Post(server.URL+"/api/acks", "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+	assert.Equal(t, "Looking into it", mgr.Acks["/foo-min-healthy-1"].Comment)
+
+	body = `{"app": "/bar", "check": "min-healthy", "user": "ashwanthkumar"}`
+	resp, err = http.Post(server.URL+"/api/acks", "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	body = `{"app": "/foo", "check": "min-healthy"}`
+	resp, err = http.Post(server.URL+"/api/acks", "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAPIServerRejectsPostsThatArentJSON(t *testing.T) {
+	apiServer := APIServer{Snoozer: NewSnoozer(), Maintenance: NewMaintenanceWindows(nil), AlertManager: &AlertManager{}}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	body := `{"app": "/foo", "check": "min-healthy", "user": "ashwanthkumar", "duration": "1h", "reason": "deploying", "author": "ashwanthkumar"}`
+	for _, path := range []string{"/api/acks", "/api/snoozes", "/api/maintenance"} {
+		resp, err := http.Post(server.URL+path, "text/plain", strings.NewReader(body))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode, path)
+		resp.Body.Close()
+	}
+	assert.Len(t, apiServer.Snoozer.Active(), 0)
+
+	resp, err := http.Post(server.URL+"/api/snoozes", "application/json; charset=utf-8", strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestAPIServerMetrics(t *testing.T) {
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		LastChecks:  make(map[string]checks.AppCheck),
+	}
+	mgr.processCheck(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Pass})
+	apiServer := APIServer{Snoozer: NewSnoozer(), AlertManager: &mgr}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "marathon_alerts_check_status{app=\"/foo\",check=\"min-healthy\"} 0\n")
+}
+
+func TestAPIServerExposesDebugMetricsOnlyInDebugMode(t *testing.T) {
+	registry := DebugMetricsRegistry
+	defer func() { DebugMetricsRegistry = registry }()
+	DebugMetricsRegistry = metrics.NewPrefixedRegistry(DebugMetricsPrefix)
+	metrics.GetOrRegisterCounter("apps-checker-app-/foo", DebugMetricsRegistry).Inc(1)
+
+	scrape := func(apiServer APIServer) string {
+		server := httptest.NewServer(apiServer.Handler())
+		defer server.Close()
+		resp, err := http.Get(server.URL + "/metrics")
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return string(body)
+	}
+	assert.NotContains(t, scrape(APIServer{Snoozer: NewSnoozer()}), "marathon_alerts_debug_apps_checker_app_foo")
+	assert.Contains(t, scrape(APIServer{Snoozer: NewSnoozer(), Debug: true}), "marathon_alerts_debug_apps_checker_app_foo 1\n")
+}
+
+func TestAPIServerStatus(t *testing.T) {
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		LastChecks:  make(map[string]checks.AppCheck),
+		FailAfter:   3,
+	}
+	mgr.processCheck(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical, Message: "Only 1 healthy"})
+	apiServer := APIServer{Snoozer: NewSnoozer(), AlertManager: &mgr}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/status")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var statuses []checkStatus
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&statuses))
+	assert.Equal(t, []checkStatus{checkStatus{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Status:    "Critical",
+		Message:   "Only 1 healthy",
+		Alert:     "Passed",
+		Pending:   2,
+	}}, statuses)
+}
+
+func TestAPIServerStatusFilters(t *testing.T) {
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		LastChecks:  make(map[string]checks.AppCheck),
+	}
+	mgr.processCheck(checks.AppCheck{App: "/payments/api", CheckName: "min-healthy", Result: checks.Critical})
+	mgr.processCheck(checks.AppCheck{App: "/payments/web", CheckName: "min-healthy", Result: checks.Pass})
+	mgr.processCheck(checks.AppCheck{App: "/search/api", CheckName: "min-healthy", Result: checks.Critical})
+	mgr.Ack("", "/search/api", "min-healthy", "ashwanthkumar", "Scaling up")
+	apiServer := APIServer{Snoozer: NewSnoozer(), AlertManager: &mgr}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/status?app=/payments/*&level=critical")
+	assert.NoError(t, err)
+	var statuses []checkStatus
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&statuses))
+	resp.Body.Close()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "/payments/api", statuses[0].App)
+	assert.Equal(t, 1, statuses[0].Times)
+	assert.Nil(t, statuses[0].Ack)
+
+	resp, err = http.Get(server.URL + "/api/status?level=critical")
+	assert.NoError(t, err)
+	statuses = nil
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&statuses))
+	resp.Body.Close()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "/search/api", statuses[1].App)
+	assert.Equal(t, "ashwanthkumar", statuses[1].Ack.By)
+}
+
+func TestAPIServerHistory(t *testing.T) {
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+	}
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	mgr.processCheck(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical, Timestamp: now})
+	mgr.processCheck(checks.AppCheck{App: "/bar", CheckName: "min-healthy", Result: checks.Warning, Timestamp: now.Add(time.Minute)})
+	mgr.processCheck(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Pass, Timestamp: now.Add(2 * time.Minute)})
+	apiServer := APIServer{Snoozer: NewSnoozer(), AlertManager: &mgr}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/history?app=/foo&from=2017-06-01T10:01:00Z")
+	assert.NoError(t, err)
+	var transitions []transition
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&transitions))
+	resp.Body.Close()
+	assert.Equal(t, []transition{transition{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		From:      "Critical",
+		To:        "Resolved",
+		Timestamp: now.Add(2 * time.Minute),
+	}}, transitions)
+
+	resp, err = http.Get(server.URL + "/api/history?to=yesterday")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAPIServerDashboard(t *testing.T) {
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		LastChecks:  make(map[string]checks.AppCheck),
+	}
+	mgr.processCheck(checks.AppCheck{App: "/payments/api", CheckName: "min-healthy", Result: checks.Critical, Message: "Only 1 healthy", Link: "http://marathon:8080/ui/#/apps/%2Fpayments%2Fapi"})
+	apiServer := APIServer{Snoozer: NewSnoozer(), AlertManager: &mgr}
+	server := httptest.NewServer(apiServer.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), `<span class="check critical">Critical</span>`)
+	assert.Contains(t, string(body), `data-app="/payments/api"`)
+	assert.Contains(t, string(body), `<a href="http://marathon:8080/ui/#/apps/%2Fpayments%2Fapi">/payments/api</a>`)
+
+	resp, err = http.Get(server.URL + "/unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
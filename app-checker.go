@@ -2,6 +2,8 @@ package main
 
 import (
 	"log"
+	"net/url"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -16,57 +18,259 @@ import (
 const (
 	CheckSubscriptionLabel = "alerts.checks.subscribe"
 	SubscribeAllChecks     = "all"
+	// AlertsChannelSize is how many checks can be queued for the AlertManager, they're
+	// drained on shutdown
+	AlertsChannelSize = 100
+	// StreamingResyncTicks is how many CheckIntervals go by between the full checks
+	// we still do while the event stream is up, in case we missed an event
+	StreamingResyncTicks = 10
 )
 
 type AppChecker struct {
-	Client        marathon.Marathon
+	// Cluster is the name every check is tagged with, empty when we watch only one
+	Cluster string
+	Client  marathon.Marathon
+	// AppLink is a text/template of the page of the app the checks link to, executed
+	// with the check. The checks have no link when it's empty.
+	AppLink       string
 	RunWaitGroup  sync.WaitGroup
 	CheckInterval time.Duration
 	stopChannel   chan bool
+	stopped       chan bool // closed once run returns
+	stopOnce      sync.Once
 	Checks        []checks.Checker
+	checksMutex   sync.Mutex
+	// AlertsChannel is created on Start when not set, the AppCheckers of all the
+	// clusters share one
 	AlertsChannel chan checks.AppCheck
-	// Snooze the entire system for some Time
-	// Useful if we don't want to SPAM the notifications
-	// when doing maintenance of mesos cluster
-	// TODO - Enable this feature via API endpoint
-	IsSnoozed  bool
-	SnoozedAt  time.Time
-	SnoozedFor time.Duration
+	// When set we re-check apps as their events arrive on Marathon's
+	// event bus, and poll only while the stream is down
+	EventStream *EventStream
+	// Forgetter is optional, it's told about the removed apps along with the
+	// StatefulCheckers, so it can drop their open alerts
+	Forgetter AppForgetter
+	// Apps we saw on the last full check, the ones missing the next time are
+	// forgotten by the StatefulCheckers and the Forgetter
+	knownApps map[string]bool
+	// What Status reports, updated as we go
+	statusMutex sync.Mutex
+	lastChecked time.Time
+	appCount    int
+	streaming   bool
+}
+
+// AppForgetter keeps state of the apps, it's told about the ones that are gone from
+// Marathon so it can forget them
+type AppForgetter interface {
+	ForgetApp(cluster, appID string)
+}
+
+// AppCheckerStatus is what an AppChecker is up to
+type AppCheckerStatus struct {
+	Cluster string
+	// LastChecked is when all the apps were last checked, Apps is how many there were
+	LastChecked time.Time
+	Apps        int
+	// Streaming is true while the apps are checked off the event stream
+	Streaming bool
 }
 
 func (a *AppChecker) Start() {
-	log.Println("Starting App Checker...")
+	log.Printf("Starting %s...\n", a.name())
 	a.RunWaitGroup.Add(1)
 	a.stopChannel = make(chan bool)
-	a.AlertsChannel = make(chan checks.AppCheck)
-
-	a.IsSnoozed = false
+	a.stopped = make(chan bool)
+	if a.AlertsChannel == nil {
+		a.AlertsChannel = make(chan checks.AppCheck, AlertsChannelSize)
+	}
 
 	go a.run()
-	log.Println("App Checker Started.")
-	log.Printf("App Checker - Checking the status of all the apps every %v\n", a.CheckInterval)
+	log.Printf("%s Started.\n", a.name())
+	if a.EventStream != nil {
+		log.Printf("%s - Checking apps as their events arrive from Marathon's event stream\n", a.name())
+	} else {
+		log.Printf("%s - Checking the status of all the apps every %v\n", a.name(), a.CheckInterval)
+	}
 }
 
+// Stop waits for the app being checked to finish, after which nothing more is sent
+// on AlertsChannel. It's safe to call Stop more than once.
 func (a *AppChecker) Stop() {
-	log.Println("Stopping App Checker...")
-	close(a.stopChannel)
-	a.RunWaitGroup.Done()
+	a.stopOnce.Do(func() {
+		log.Printf("Stopping %s...\n", a.name())
+		close(a.stopChannel)
+		<-a.stopped
+		a.RunWaitGroup.Done()
+		log.Printf("%s Stopped.\n", a.name())
+	})
+}
+
+func (a *AppChecker) Status() AppCheckerStatus {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+	return AppCheckerStatus{
+		Cluster:     a.Cluster,
+		LastChecked: a.lastChecked,
+		Apps:        a.appCount,
+		Streaming:   a.streaming,
+	}
+}
+
+// name is used in the logs to tell the AppCheckers of the clusters apart
+func (a *AppChecker) name() string {
+	if a.Cluster != "" {
+		return "App Checker [" + a.Cluster + "]"
+	}
+	return "App Checker"
+}
+
+func (a *AppChecker) stopping() bool {
+	select {
+	case <-a.stopChannel:
+		return true
+	default:
+		return false
+	}
 }
 
 func (a *AppChecker) run() {
+	defer close(a.stopped)
+	var events chan MarathonEvent
+	var streamStatus chan bool
+	if a.EventStream != nil {
+		events = make(chan MarathonEvent)
+		streamStatus = make(chan bool)
+		go a.subscribe(events, streamStatus)
+	}
+
+	streaming := false
+	ticksWhileStreaming := 0
+	// Set when the last full check failed, so we retry on the next tick even
+	// while streaming
+	retry := false
+	checkAll := func() {
+		ticksWhileStreaming = 0
+		err := a.processChecks()
+		retry = err != nil
+		if err != nil {
+			a.checkAllFailed(err)
+		}
+	}
+	ticker := time.NewTicker(a.CheckInterval)
+	defer ticker.Stop()
 	running := true
 	for running {
 		select {
-		case <-time.After(a.CheckInterval):
-			err := a.processChecks()
-			if err != nil {
-				log.Fatalf("Unexpected error - %v\n", err)
+		case <-ticker.C:
+			if streaming && !retry {
+				ticksWhileStreaming++
+				if ticksWhileStreaming < StreamingResyncTicks {
+					continue
+				}
+			}
+			checkAll()
+		case connected := <-streamStatus:
+			// We might have missed events while (re)connecting, so do a full resync either way
+			streaming = connected
+			a.statusMutex.Lock()
+			a.streaming = connected
+			a.statusMutex.Unlock()
+			checkAll()
+		case event := <-events:
+			metrics.GetOrRegisterCounter("apps-checker-events-received", DebugMetricsRegistry).Inc(1)
+			for _, appID := range event.AppIDs() {
+				if event.EventType == AppTerminatedEvent {
+					a.forgetApp(appID)
+					continue
+				}
+				err := a.processApp(appID)
+				if err != nil {
+					log.Printf("Error - Unable to check %s after %s - %v\n", appID, event.EventType, err)
+				}
 			}
 		case <-a.stopChannel:
 			metrics.GetOrRegisterCounter("apps-checker-stopped", DebugMetricsRegistry).Inc(1)
 			running = false
 		}
-		time.Sleep(1 * time.Second)
+	}
+}
+
+// checkAllFailed logs the error and counts it per cluster, run retries on the next tick
+func (a *AppChecker) checkAllFailed(err error) {
+	name := "apps-checker-failed"
+	if a.Cluster != "" {
+		name += "-" + a.Cluster
+	}
+	metrics.GetOrRegisterCounter(name, nil).Inc(1)
+	log.Printf("Error - %s - Unable to check the apps, retrying in %v - %v\n", a.name(), a.CheckInterval, err)
+}
+
+// subscribe keeps a connection open to the event stream and forwards every app event
+// to events. Every time the stream connects or drops it's reported on status.
+func (a *AppChecker) subscribe(events chan<- MarathonEvent, status chan<- bool) {
+	for {
+		reader, err := a.EventStream.Connect()
+		if err == nil {
+			log.Printf("%s - Connected to Marathon event stream\n", a.name())
+			select {
+			case status <- true:
+			case <-a.stopChannel:
+				reader.Close()
+				return
+			}
+			err = a.readEvents(reader, events)
+			if err == nil {
+				return
+			}
+			select {
+			case status <- false:
+			case <-a.stopChannel:
+				return
+			}
+		}
+		metrics.GetOrRegisterCounter("apps-checker-event-stream-disconnected", DebugMetricsRegistry).Inc(1)
+		log.Printf("%s - Marathon event stream is down, polling every %v until it's back - %v\n", a.name(), a.CheckInterval, err)
+
+		select {
+		case <-time.After(a.EventStream.retryInterval()):
+		case <-a.stopChannel:
+			return
+		}
+	}
+}
+
+// readEvents forwards the app events on the reader until it fails, it returns nil
+// only when the AppChecker was stopped
+func (a *AppChecker) readEvents(reader *EventReader, events chan<- MarathonEvent) error {
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-a.stopChannel:
+			reader.Close()
+		case <-done:
+			reader.Close()
+		}
+	}()
+
+	for {
+		event, err := reader.Next()
+		if err != nil {
+			select {
+			case <-a.stopChannel:
+				return nil
+			default:
+				return err
+			}
+		}
+		if !event.IsAppEvent() {
+			continue
+		}
+		select {
+		case events <- event:
+		case <-a.stopChannel:
+			return nil
+		}
 	}
 }
 
@@ -74,27 +278,142 @@ func (a *AppChecker) processChecks() error {
 	var apps *marathon.Applications
 	var err error
 	metrics.GetOrRegisterTimer("marathon-all-apps-response-time", nil).Time(func() {
-		apps, err = a.Client.Applications(nil)
+		apps, err = a.Client.Applications(a.appsParams())
 	})
 	metrics.GetOrRegisterCounter("apps-checker-marathon-all-apps-api", DebugMetricsRegistry).Inc(1)
 	if err != nil {
 		return err
 	}
+	currentApps := make(map[string]bool)
 	for _, app := range apps.Apps {
-		checksSubscribed := sets.FromSlice(
-			strings.Split(maps.GetString(app.Labels, CheckSubscriptionLabel, SubscribeAllChecks),
-				","))
-		for _, check := range a.Checks {
-			if checksSubscribed.Contains(check.Name()) || checksSubscribed.Contains(SubscribeAllChecks) {
-				result := check.Check(app)
-				a.AlertsChannel <- result
-				metrics.GetOrRegisterCounter("apps-checker-alerts-sent", DebugMetricsRegistry).Inc(1)
-				metrics.GetOrRegisterCounter("apps-checker-check-"+check.Name(), DebugMetricsRegistry).Inc(1)
-				metrics.GetOrRegisterCounter("apps-checker-app-"+app.ID, DebugMetricsRegistry).Inc(1)
-				metrics.GetOrRegisterCounter("apps-checker-"+app.ID+"-"+check.Name(), DebugMetricsRegistry).Inc(1)
-			}
+		currentApps[app.ID] = true
+		if a.stopping() {
+			return nil
+		}
+		a.checkApp(app)
+	}
+	a.forgetRemovedApps(currentApps)
+	a.statusMutex.Lock()
+	a.lastChecked = time.Now()
+	a.appCount = len(apps.Apps)
+	a.statusMutex.Unlock()
+
+	return nil
+}
+
+// appsParams asks /v2/apps to embed what the checks need, nil when they need nothing more
+func (a *AppChecker) appsParams() url.Values {
+	embeds := make(map[string]bool)
+	for _, check := range a.currentChecks() {
+		requester, ok := check.(checks.EmbedRequester)
+		if !ok {
+			continue
+		}
+		for _, embed := range requester.Embeds() {
+			embeds[embed] = true
+		}
+	}
+	if len(embeds) == 0 {
+		return nil
+	}
+	// Marathon drops the fields embedded by default once we ask for any embed
+	embeds["apps.counts"] = true
+	embeds["apps.deployments"] = true
+	var values []string
+	for embed := range embeds {
+		values = append(values, embed)
+	}
+	sort.Strings(values)
+	return url.Values{"embed": values}
+}
+
+func (a *AppChecker) forgetRemovedApps(currentApps map[string]bool) {
+	for appID := range a.knownApps {
+		if !currentApps[appID] {
+			a.forgetApp(appID)
+		}
+	}
+	a.knownApps = currentApps
+}
+
+// forgetApp drops the state the StatefulCheckers and the Forgetter keep of the app
+func (a *AppChecker) forgetApp(appID string) {
+	for _, check := range a.currentChecks() {
+		stateful, ok := check.(checks.StatefulChecker)
+		if ok {
+			stateful.Forget(appID)
 		}
 	}
+	if a.Forgetter != nil {
+		a.Forgetter.ForgetApp(a.Cluster, appID)
+	}
+	delete(a.knownApps, appID)
+}
 
+// processApp re-checks a single app, we use this when an event for the app arrives
+func (a *AppChecker) processApp(appID string) error {
+	var app *marathon.Application
+	var err error
+	metrics.GetOrRegisterTimer("marathon-app-response-time", nil).Time(func() {
+		app, err = a.Client.Application(appID)
+	})
+	metrics.GetOrRegisterCounter("apps-checker-marathon-app-api", DebugMetricsRegistry).Inc(1)
+	if err != nil {
+		return err
+	}
+	a.checkApp(*app)
 	return nil
 }
+
+// SetChecks swaps the checks we run, from the next app we check. The new checks take
+// over the state of the ones of the same name they replace.
+func (a *AppChecker) SetChecks(allChecks []checks.Checker) {
+	a.checksMutex.Lock()
+	defer a.checksMutex.Unlock()
+	for _, check := range allChecks {
+		inheritor, ok := check.(checks.StateInheritor)
+		if !ok {
+			continue
+		}
+		for _, previous := range a.Checks {
+			if previous.Name() == check.Name() {
+				inheritor.InheritState(previous)
+			}
+		}
+	}
+	a.Checks = allChecks
+}
+
+func (a *AppChecker) currentChecks() []checks.Checker {
+	a.checksMutex.Lock()
+	defer a.checksMutex.Unlock()
+	return a.Checks
+}
+
+func (a *AppChecker) checkApp(app marathon.Application) {
+	checksSubscribed := sets.FromSlice(
+		strings.Split(maps.GetString(app.Labels, CheckSubscriptionLabel, SubscribeAllChecks),
+			","))
+	for _, check := range a.currentChecks() {
+		if checksSubscribed.Contains(check.Name()) || checksSubscribed.Contains(SubscribeAllChecks) {
+			result := check.Check(app)
+			result.Cluster = a.Cluster
+			if a.AppLink != "" {
+				link, err := renderLink(a.AppLink, result)
+				if err != nil {
+					log.Printf("Error - Unable to render the link of %s - %v\n", app.ID, err)
+				}
+				result.Link = link
+			}
+			select {
+			case a.AlertsChannel <- result:
+			case <-a.stopChannel:
+				return
+			}
+			metrics.GetOrRegisterCounter("apps-checker-alerts-sent", DebugMetricsRegistry).Inc(1)
+			metrics.GetOrRegisterCounter("apps-checker-check-"+check.Name(), DebugMetricsRegistry).Inc(1)
+			metrics.GetOrRegisterCounter("apps-checker-app-"+app.ID, DebugMetricsRegistry).Inc(1)
+			metrics.GetOrRegisterCounter("apps-checker-"+app.ID+"-"+check.Name(), DebugMetricsRegistry).Inc(1)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 	"time"
 
 	"github.com/ashwanthkumar/marathon-alerts/checks"
 	marathon "github.com/gambol99/go-marathon"
+	"github.com/rcrowley/go-metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -37,6 +41,50 @@ func TestProcessCheckForAllSubscribers(t *testing.T) {
 	assert.Equal(t, actualCheck, expectedCheck)
 }
 
+func TestProcessCheckTagsChecksWithCluster(t *testing.T) {
+	appLabels := make(map[string]string)
+	client := new(MockMarathon)
+	app := marathon.Application{ID: "/foo-app", Labels: appLabels}
+	client.On("Application", "/foo-app").Return(&app, nil)
+
+	alertChan := make(chan checks.AppCheck, 1)
+	check, _ := CreateMockChecker(appLabels)
+
+	appChecker := AppChecker{
+		Cluster:       "prod",
+		Client:        client,
+		AlertsChannel: alertChan,
+		Checks:        []checks.Checker{check},
+	}
+
+	err := appChecker.processApp("/foo-app")
+	assert.Nil(t, err)
+	actualCheck := <-alertChan
+	assert.Equal(t, "prod", actualCheck.Cluster)
+}
+
+func TestProcessCheckLinksToTheApp(t *testing.T) {
+	appLabels := make(map[string]string)
+	client := new(MockMarathon)
+	app := marathon.Application{ID: "/foo-app", Labels: appLabels}
+	client.On("Application", "/foo-app").Return(&app, nil)
+
+	alertChan := make(chan checks.AppCheck, 1)
+	check, _ := CreateMockChecker(appLabels)
+
+	appChecker := AppChecker{
+		Client:        client,
+		AppLink:       "http://marathon:8080" + MarathonAppLink,
+		AlertsChannel: alertChan,
+		Checks:        []checks.Checker{check},
+	}
+
+	err := appChecker.processApp("/foo-app")
+	assert.Nil(t, err)
+	actualCheck := <-alertChan
+	assert.Equal(t, "http://marathon:8080/ui/#/apps/%2Ffoo-app", actualCheck.Link)
+}
+
 func TestProcessCheckForWithNoSubscribers(t *testing.T) {
 	appLabels := make(map[string]string)
 	appLabels["alerts.checks.subscribe"] = "check-that-does-not-exist"
@@ -61,6 +109,312 @@ func TestProcessCheckForWithNoSubscribers(t *testing.T) {
 	assert.Len(t, alertChan, 0)
 }
 
+func TestProcessAppForAllSubscribers(t *testing.T) {
+	appLabels := make(map[string]string)
+	client := new(MockMarathon)
+	app := marathon.Application{ID: "/foo-app", Labels: appLabels}
+	client.On("Application", "/foo-app").Return(&app, nil)
+
+	alertChan := make(chan checks.AppCheck, 1)
+	check, now := CreateMockChecker(appLabels)
+
+	appChecker := AppChecker{
+		Client:        client,
+		AlertsChannel: alertChan,
+		Checks:        []checks.Checker{check},
+	}
+
+	expectedCheck := checks.AppCheck{Result: checks.Critical, Timestamp: now, App: "/foo-app", Labels: appLabels}
+	err := appChecker.processApp("/foo-app")
+	assert.Nil(t, err)
+	assert.Len(t, alertChan, 1)
+	actualCheck := <-alertChan
+	assert.Equal(t, actualCheck, expectedCheck)
+}
+
+func TestAppCheckerChecksAppsFromEventStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "event: event_stream_attached\ndata: {\"eventType\":\"event_stream_attached\"}\n\n")
+		fmt.Fprint(w, "event: status_update_event\ndata: {\"eventType\":\"status_update_event\",\"appId\":\"/foo-app\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-w.(http.CloseNotifier).CloseNotify()
+	}))
+	defer server.Close()
+
+	appLabels := make(map[string]string)
+	client := new(MockMarathon)
+	var urlValues url.Values
+	client.On("Applications", urlValues).Return(&marathon.Applications{}, nil)
+	app := marathon.Application{ID: "/foo-app", Labels: appLabels}
+	client.On("Application", "/foo-app").Return(&app, nil)
+	check, now := CreateMockChecker(appLabels)
+
+	appChecker := AppChecker{
+		Client:        client,
+		CheckInterval: 1 * time.Hour,
+		Checks:        []checks.Checker{check},
+		EventStream:   &EventStream{URLs: []string{server.URL}},
+	}
+	appChecker.Start()
+	defer appChecker.Stop()
+
+	expectedCheck := checks.AppCheck{Result: checks.Critical, Timestamp: now, App: "/foo-app", Labels: appLabels}
+	select {
+	case actualCheck := <-appChecker.AlertsChannel:
+		assert.Equal(t, expectedCheck, actualCheck)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Expected a check for /foo-app from the event stream")
+	}
+	// Full resync when the stream got connected
+	client.AssertCalled(t, "Applications", urlValues)
+}
+
+func TestAppCheckerResyncsWhenEventStreamDrops(t *testing.T) {
+	// Closes the stream right after connecting
+	server := fakeEventStream()
+	defer server.Close()
+
+	resyncs := make(chan bool, 10)
+	client := new(MockMarathon)
+	var urlValues url.Values
+	client.On("Applications", urlValues).Return(&marathon.Applications{}, nil).Run(func(args mock.Arguments) {
+		resyncs <- true
+	})
+
+	appChecker := AppChecker{
+		Client:        client,
+		CheckInterval: 1 * time.Hour,
+		EventStream:   &EventStream{URLs: []string{server.URL}, RetryInterval: 1 * time.Hour},
+	}
+	appChecker.Start()
+	defer appChecker.Stop()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-resyncs:
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "Expected a full resync when the event stream connects and drops")
+		}
+	}
+}
+
+func TestAppCheckerResyncsWhileStreaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "event: event_stream_attached\ndata: {\"eventType\":\"event_stream_attached\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-w.(http.CloseNotifier).CloseNotify()
+	}))
+	defer server.Close()
+
+	resyncs := make(chan bool, 10)
+	client := new(MockMarathon)
+	var urlValues url.Values
+	client.On("Applications", urlValues).Return(&marathon.Applications{}, nil).Run(func(args mock.Arguments) {
+		resyncs <- true
+	})
+
+	appChecker := AppChecker{
+		Client:        client,
+		CheckInterval: 10 * time.Millisecond,
+		EventStream:   &EventStream{URLs: []string{server.URL}},
+	}
+	appChecker.Start()
+	defer appChecker.Stop()
+
+	// Once when the stream connects and then every StreamingResyncTicks
+	for i := 0; i < 2; i++ {
+		select {
+		case <-resyncs:
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "Expected a full resync every now and then while streaming")
+		}
+	}
+	assert.True(t, appChecker.Status().Streaming)
+}
+
+func TestAppCheckerForgetsTerminatedApps(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "event: event_stream_attached\ndata: {\"eventType\":\"event_stream_attached\"}\n\n")
+		fmt.Fprint(w, "event: app_terminated_event\ndata: {\"eventType\":\"app_terminated_event\",\"appId\":\"/foo\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-w.(http.CloseNotifier).CloseNotify()
+	}))
+	defer server.Close()
+
+	client := new(MockMarathon)
+	params := url.Values{"embed": []string{"apps.counts", "apps.deployments", "apps.tasks"}}
+	client.On("Applications", params).Return(&marathon.Applications{
+		Apps: []marathon.Application{marathon.Application{ID: "/foo"}},
+	}, nil)
+	forgotten := make(chan string, 1)
+	forgetter := &notifyingForgetter{forgotten: forgotten}
+
+	appChecker := AppChecker{
+		Cluster:       "prod",
+		Client:        client,
+		CheckInterval: 1 * time.Hour,
+		Checks:        []checks.Checker{&mockStatefulChecker{}},
+		Forgetter:     forgetter,
+		EventStream:   &EventStream{URLs: []string{server.URL}},
+	}
+	appChecker.Start()
+	defer appChecker.Stop()
+
+	select {
+	case appID := <-forgotten:
+		assert.Equal(t, "prod:/foo", appID)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Expected /foo to be forgotten after its app_terminated_event")
+	}
+	client.AssertNotCalled(t, "Application", "/foo")
+}
+
+func TestAppCheckerRetriesWhenMarathonFails(t *testing.T) {
+	failed := metrics.GetOrRegisterCounter("apps-checker-failed-prod", nil)
+	failedBefore := failed.Count()
+	checked := make(chan bool, 10)
+	client := new(MockMarathon)
+	var urlValues url.Values
+	client.On("Applications", urlValues).Return(nil, fmt.Errorf("Marathon is down")).Once()
+	client.On("Applications", urlValues).Return(&marathon.Applications{}, nil).Run(func(args mock.Arguments) {
+		checked <- true
+	})
+
+	appChecker := AppChecker{
+		Cluster:       "prod",
+		Client:        client,
+		CheckInterval: 10 * time.Millisecond,
+	}
+	appChecker.Start()
+	defer appChecker.Stop()
+
+	select {
+	case <-checked:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Expected the apps to be checked again after Marathon failed")
+	}
+	assert.Equal(t, failedBefore+1, failed.Count())
+}
+
+func TestAppCheckerStopWhileAlertsChannelIsFull(t *testing.T) {
+	appLabels := make(map[string]string)
+	var apps []marathon.Application
+	for i := 0; i < AlertsChannelSize+10; i++ {
+		apps = append(apps, marathon.Application{Labels: appLabels})
+	}
+	client := new(MockMarathon)
+	var urlValues url.Values
+	client.On("Applications", urlValues).Return(&marathon.Applications{Apps: apps}, nil)
+	check, _ := CreateMockChecker(appLabels)
+
+	appChecker := AppChecker{
+		Client:        client,
+		CheckInterval: 10 * time.Millisecond,
+		Checks:        []checks.Checker{check},
+	}
+	appChecker.Start()
+	// Nobody reads the channel, so the checker blocks once it's full
+	for len(appChecker.AlertsChannel) < AlertsChannelSize {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	stopped := make(chan bool)
+	go func() {
+		appChecker.Stop()
+		// Safe to call again
+		appChecker.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Expected Stop to return even when nobody reads the AlertsChannel")
+	}
+	assert.Len(t, appChecker.AlertsChannel, AlertsChannelSize)
+}
+
+type mockStatefulChecker struct {
+	forgotten []string
+}
+
+func (m *mockStatefulChecker) Name() string {
+	return "mock-stateful-check"
+}
+
+func (m *mockStatefulChecker) Check(app marathon.Application) checks.AppCheck {
+	return checks.AppCheck{App: app.ID, CheckName: m.Name(), Result: checks.Pass}
+}
+
+func (m *mockStatefulChecker) Forget(appID string) {
+	m.forgotten = append(m.forgotten, appID)
+}
+
+func (m *mockStatefulChecker) Embeds() []string {
+	return []string{"apps.tasks"}
+}
+
+type mockForgetter struct {
+	forgotten []string
+}
+
+func (m *mockForgetter) ForgetApp(cluster, appID string) {
+	m.forgotten = append(m.forgotten, cluster+":"+appID)
+}
+
+type notifyingForgetter struct {
+	forgotten chan string
+}
+
+func (n *notifyingForgetter) ForgetApp(cluster, appID string) {
+	n.forgotten <- cluster + ":" + appID
+}
+
+func TestProcessChecksForgetsRemovedApps(t *testing.T) {
+	client := new(MockMarathon)
+	params := url.Values{"embed": []string{"apps.counts", "apps.deployments", "apps.tasks"}}
+	client.On("Applications", params).Return(&marathon.Applications{
+		Apps: []marathon.Application{marathon.Application{ID: "/foo"}, marathon.Application{ID: "/bar"}},
+	}, nil).Once()
+	client.On("Applications", params).Return(&marathon.Applications{
+		Apps: []marathon.Application{marathon.Application{ID: "/foo"}},
+	}, nil).Once()
+	check := &mockStatefulChecker{}
+	forgetter := &mockForgetter{}
+
+	appChecker := AppChecker{
+		Cluster:       "prod",
+		Client:        client,
+		AlertsChannel: make(chan checks.AppCheck, 10),
+		Checks:        []checks.Checker{check},
+		Forgetter:     forgetter,
+	}
+	assert.Nil(t, appChecker.processChecks())
+	assert.Len(t, check.forgotten, 0)
+	assert.Len(t, forgetter.forgotten, 0)
+	assert.Nil(t, appChecker.processChecks())
+	assert.Equal(t, []string{"/bar"}, check.forgotten)
+	assert.Equal(t, []string{"prod:/bar"}, forgetter.forgotten)
+}
+
+func TestSetChecksKeepsTheStateOfTheChecks(t *testing.T) {
+	app := func(taskIDs ...string) marathon.Application {
+		app := marathon.Application{ID: "/foo", Instances: len(taskIDs)}
+		for _, id := range taskIDs {
+			app.Tasks = append(app.Tasks, &marathon.Task{ID: id, AppID: "/foo", Version: "v1"})
+		}
+		return app
+	}
+	previous := &checks.TaskFlapping{DefaultWindow: 10 * time.Minute, DefaultWarningThreshold: 2, DefaultCriticalThreshold: 3}
+	previous.Check(app("t1", "t2"))
+	previous.Check(app("t3", "t2"))
+	appChecker := AppChecker{Checks: []checks.Checker{&checks.SuspendedCheck{}, previous}}
+
+	// Like on a reload, with a lower threshold
+	reloaded := &checks.TaskFlapping{DefaultWindow: 10 * time.Minute, DefaultWarningThreshold: 1, DefaultCriticalThreshold: 3}
+	appChecker.SetChecks([]checks.Checker{&checks.SuspendedCheck{}, reloaded})
+	assert.Equal(t, checks.Warning, reloaded.Check(app("t3", "t2")).Result)
+}
+
 func CreateMockChecker(appLabels map[string]string) (checks.Checker, time.Time) {
 	now := time.Now()
 	check := new(MockChecker)
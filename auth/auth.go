@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ResolveSecret reads secrets from `file:<path>` or `env:<name>`, so they don't have
+// to be passed on the command line. Any other value is returned as is.
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "file:"):
+		content, err := ioutil.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(content)), nil
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret := os.Getenv(name)
+		if secret == "" {
+			return "", fmt.Errorf("Expected the environment variable %s to be set", name)
+		}
+		return secret, nil
+	default:
+		return value, nil
+	}
+}
+
+// TLSConfig trusts the CAs in caFile on top of the system ones and presents the
+// client certificate in certFile / keyFile, it returns nil when none of them are set
+func TLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	if caFile == "" && certFile == "" {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Expected PEM encoded certificates in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Transport authenticates every request to Marathon, either with basic auth or with
+// a DC/OS token. A DC/OS token rejected with a 401 is refreshed and the request is
+// tried once more.
+type Transport struct {
+	Base     http.RoundTripper
+	Username string
+	Password string
+	Tokens   *DCOSTokenSource
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Tokens == nil {
+		authenticated := cloneRequest(req)
+		if t.Username != "" {
+			authenticated.SetBasicAuth(t.Username, t.Password)
+		}
+		return t.base().RoundTrip(authenticated)
+	}
+
+	token, err := t.Tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base().RoundTrip(withToken(req, token))
+	// We can't replay a body that's already been read
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || req.Body != nil {
+		return resp, err
+	}
+	resp.Body.Close()
+	t.Tokens.Invalidate(token)
+	token, err = t.Tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	return t.base().RoundTrip(withToken(req, token))
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func withToken(req *http.Request, token string) *http.Request {
+	authenticated := cloneRequest(req)
+	authenticated.Header.Set("Authorization", "token="+token)
+	return authenticated
+}
+
+// cloneRequest copies the request and its headers, RoundTrippers shouldn't modify the
+// request they're given
+func cloneRequest(req *http.Request) *http.Request {
+	clone := new(http.Request)
+	*clone = *req
+	clone.Header = make(http.Header)
+	for name, values := range req.Header {
+		clone.Header[name] = append([]string(nil), values...)
+	}
+	return clone
+}
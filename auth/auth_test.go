@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSecret(t *testing.T) {
+	file, err := ioutil.TempFile("", "marathon-alerts-secret")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString("from-file\n")
+	file.Close()
+	os.Setenv("MARATHON_ALERTS_TEST_SECRET", "from-env")
+	defer os.Unsetenv("MARATHON_ALERTS_TEST_SECRET")
+
+	secret, err := ResolveSecret("file:" + file.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "from-file", secret)
+	secret, err = ResolveSecret("env:MARATHON_ALERTS_TEST_SECRET")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", secret)
+	secret, err = ResolveSecret("s3cr3t")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", secret)
+
+	_, err = ResolveSecret("env:MARATHON_ALERTS_TEST_MISSING")
+	assert.EqualError(t, err, "Expected the environment variable MARATHON_ALERTS_TEST_MISSING to be set")
+	_, err = ResolveSecret("file:/non/existent/secret")
+	assert.Error(t, err)
+}
+
+func TestTLSConfigWithoutFiles(t *testing.T) {
+	config, err := TLSConfig("", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+}
+
+func TestTLSConfigFailsOnInvalidCA(t *testing.T) {
+	file, err := ioutil.TempFile("", "marathon-alerts-ca")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString("not a certificate")
+	file.Close()
+
+	_, err = TLSConfig(file.Name(), "", "")
+	assert.EqualError(t, err, "Expected PEM encoded certificates in "+file.Name())
+}
+
+func TestTransportWithBasicAuth(t *testing.T) {
+	var username, password string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ = r.BasicAuth()
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{Username: "alerts", Password: "s3cr3t"}}
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "alerts", username)
+	assert.Equal(t, "s3cr3t", password)
+}
+
+func TestTransportRetriesWithNewTokenOnUnauthorized(t *testing.T) {
+	logins := 0
+	loginServer := newLoginServer(t, func() string {
+		logins++
+		if logins == 1 {
+			return "expired"
+		}
+		return "fresh"
+	})
+	defer loginServer.Close()
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "token=fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	tokens := &DCOSTokenSource{LoginURL: loginServer.URL, UID: "marathon-alerts", PrivateKey: testKey(t)}
+	client := &http.Client{Transport: &Transport{Tokens: tokens}}
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"token=expired", "token=fresh"}, authorizations)
+	assert.Equal(t, 2, logins)
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DefaultDCOSTokenExpiry = 1 * time.Hour
+
+// DCOSTokenSource logs in to DC/OS IAM as a service account and hands out the
+// token, which is refreshed once 80% of its lifetime is over. The login is a JWT with
+// the uid, signed with the private key of the service account using RS256.
+type DCOSTokenSource struct {
+	// LoginURL is like https://dcos.example.com/acs/api/v1/auth/login
+	LoginURL   string
+	UID        string
+	PrivateKey *rsa.PrivateKey
+	// Expiry of the tokens we ask for, defaults to DefaultDCOSTokenExpiry
+	Expiry time.Duration
+	Client *http.Client
+
+	mutex     sync.Mutex
+	token     string
+	refreshAt time.Time
+}
+
+type dcosLoginRequest struct {
+	UID   string `json:"uid"`
+	Token string `json:"token"`
+}
+
+type dcosLoginResponse struct {
+	Token string `json:"token"`
+}
+
+// Token returns the current token, logging in again when it's due for a refresh
+func (d *DCOSTokenSource) Token() (string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.token != "" && time.Now().Before(d.refreshAt) {
+		return d.token, nil
+	}
+
+	expiry := d.Expiry
+	if expiry <= 0 {
+		expiry = DefaultDCOSTokenExpiry
+	}
+	issuedAt := time.Now()
+	token, err := d.login(issuedAt.Add(expiry))
+	if err != nil {
+		return "", err
+	}
+	d.token = token
+	d.refreshAt = issuedAt.Add(expiry * 4 / 5)
+	return d.token, nil
+}
+
+// Invalidate makes the next call to Token login again, unless the token was
+// already refreshed by someone else
+func (d *DCOSTokenSource) Invalidate(token string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.token == token {
+		d.token = ""
+	}
+}
+
+func (d *DCOSTokenSource) login(expiresAt time.Time) (string, error) {
+	loginToken, err := SignJWT(map[string]interface{}{
+		"uid": d.UID,
+		"exp": expiresAt.Unix(),
+	}, d.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(dcosLoginRequest{UID: d.UID, Token: loginToken})
+	if err != nil {
+		return "", err
+	}
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(d.LoginURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Expected 200 from DC/OS login for %s but got %d", d.UID, resp.StatusCode)
+	}
+	var response dcosLoginResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return "", err
+	}
+	if response.Token == "" {
+		return "", fmt.Errorf("Expected a token from DC/OS login for %s but found none", d.UID)
+	}
+	return response.Token, nil
+}
+
+// SignJWT creates a JWT with the claims, signed using RS256
+func SignJWT(claims map[string]interface{}, key *rsa.PrivateKey) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ParsePrivateKey parses a PEM encoded RSA private key, in either PKCS#1 or PKCS#8
+func ParsePrivateKey(content []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("Expected a PEM encoded private key but found none")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Expected an RSA private key but %T found", parsed)
+	}
+	return key, nil
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	return key
+}
+
+// newLoginServer responds to every DC/OS login with the token from nextToken
+func newLoginServer(t *testing.T, nextToken func() string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var login dcosLoginRequest
+		err := json.NewDecoder(r.Body).Decode(&login)
+		assert.NoError(t, err)
+		assert.Equal(t, "marathon-alerts", login.UID)
+		json.NewEncoder(w).Encode(dcosLoginResponse{Token: nextToken()})
+	}))
+}
+
+func TestDCOSTokenSourceReusesTokenUntilRefresh(t *testing.T) {
+	logins := 0
+	server := newLoginServer(t, func() string {
+		logins++
+		return "token"
+	})
+	defer server.Close()
+
+	tokens := &DCOSTokenSource{LoginURL: server.URL, UID: "marathon-alerts", PrivateKey: testKey(t)}
+	token, err := tokens.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token)
+	tokens.Token()
+	assert.Equal(t, 1, logins)
+
+	tokens.refreshAt = time.Now().Add(-1 * time.Second)
+	tokens.Token()
+	assert.Equal(t, 2, logins)
+
+	tokens.Invalidate("some-other-token")
+	tokens.Token()
+	assert.Equal(t, 2, logins)
+	tokens.Invalidate("token")
+	tokens.Token()
+	assert.Equal(t, 3, logins)
+}
+
+func TestDCOSTokenSourceFailsOnLoginError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tokens := &DCOSTokenSource{LoginURL: server.URL, UID: "marathon-alerts", PrivateKey: testKey(t)}
+	_, err := tokens.Token()
+	assert.EqualError(t, err, "Expected 200 from DC/OS login for marathon-alerts but got 401")
+}
+
+func TestSignJWT(t *testing.T) {
+	key := testKey(t)
+	token, err := SignJWT(map[string]interface{}{"uid": "marathon-alerts"}, key)
+	assert.NoError(t, err)
+
+	parts := strings.Split(token, ".")
+	assert.Len(t, parts, 3)
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"uid": "marathon-alerts"}`, string(payload))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NoError(t, err)
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature))
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key := testKey(t)
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	parsed, err := ParsePrivateKey(pkcs1)
+	assert.NoError(t, err)
+	assert.Equal(t, key.D, parsed.D)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	parsed, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	assert.NoError(t, err)
+	assert.Equal(t, key.D, parsed.D)
+
+	_, err = ParsePrivateKey([]byte("not a key"))
+	assert.EqualError(t, err, "Expected a PEM encoded private key but found none")
+}
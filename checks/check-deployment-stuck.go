@@ -0,0 +1,154 @@
+package checks
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gambol99/go-marathon"
+)
+
+const DefaultDeploymentsCacheDuration = 10 * time.Second
+
+// Deployments is the part of the Marathon client DeploymentStuck needs
+type Deployments interface {
+	Deployments() ([]*marathon.Deployment, error)
+}
+
+// Checks for deployments of an app that have been running for too long, like the ones
+// waiting for capacity or for the new tasks to turn healthy while the old ones are up
+type DeploymentStuck struct {
+	Client Deployments
+	// DefaultWarningThreshold - overriden using alerts.deployment-stuck.warn.threshold
+	DefaultWarningThreshold time.Duration
+	// DefaultCriticalThreshold - overriden using alerts.deployment-stuck.critical.threshold
+	DefaultCriticalThreshold time.Duration
+	// CacheDuration is how long we reuse the deployments from Marathon, so a round of
+	// checks over all the apps calls /v2/deployments only once
+	CacheDuration time.Duration
+
+	mutex       sync.Mutex
+	deployments map[string]*marathon.Deployment
+	fetchedAt   time.Time
+}
+
+func (d *DeploymentStuck) Name() string {
+	return "deployment-stuck"
+}
+
+func (d *DeploymentStuck) Check(app marathon.Application) AppCheck {
+	failThreshold := durationLabel(app.Labels, "alerts.deployment-stuck.critical.threshold", d.DefaultCriticalThreshold)
+	warnThreshold := durationLabel(app.Labels, "alerts.deployment-stuck.warn.threshold", d.DefaultWarningThreshold)
+	result := Pass
+	message := fmt.Sprintf("No deployment of %s is running for long", app.ID)
+
+	deployment, runningFor := d.oldestDeployment(app)
+	if deployment != nil {
+		if runningFor >= failThreshold {
+			result = Critical
+		} else if runningFor >= warnThreshold {
+			result = Warning
+		}
+		if result != Pass {
+			message = fmt.Sprintf("Deployment %s has been running for %v, at step %d of %d with %s",
+				deployment.ID, time.Duration(runningFor.Seconds())*time.Second,
+				deployment.CurrentStep, deployment.TotalSteps, d.currentActions(deployment))
+		}
+	}
+
+	return AppCheck{
+		App:       app.ID,
+		Labels:    app.Labels,
+		CheckName: d.Name(),
+		Result:    result,
+		Message:   message,
+		Timestamp: time.Now(),
+	}
+}
+
+// InheritState copies the deployments the previous DeploymentStuck fetched
+func (d *DeploymentStuck) InheritState(previous Checker) {
+	previousStuck, ok := previous.(*DeploymentStuck)
+	if !ok || previousStuck == d {
+		return
+	}
+	deployments := make(map[string]*marathon.Deployment)
+	previousStuck.mutex.Lock()
+	for id, deployment := range previousStuck.deployments {
+		deployments[id] = deployment
+	}
+	fetchedAt := previousStuck.fetchedAt
+	previousStuck.mutex.Unlock()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.deployments = deployments
+	d.fetchedAt = fetchedAt
+}
+
+// oldestDeployment returns the longest running deployment of the app, we don't call
+// Marathon for apps that aren't being deployed
+func (d *DeploymentStuck) oldestDeployment(app marathon.Application) (*marathon.Deployment, time.Duration) {
+	var oldest *marathon.Deployment
+	var runningFor time.Duration
+	for _, appDeployment := range app.Deployments {
+		deployment := d.deployment(appDeployment["id"])
+		if deployment == nil {
+			continue
+		}
+		startedAt, err := time.Parse(time.RFC3339Nano, deployment.Version)
+		if err != nil {
+			log.Printf("Error - Unable to parse the version of deployment %s - %v\n", deployment.ID, err)
+			continue
+		}
+		if oldest == nil || time.Since(startedAt) > runningFor {
+			oldest = deployment
+			runningFor = time.Since(startedAt)
+		}
+	}
+
+	return oldest, runningFor
+}
+
+func (d *DeploymentStuck) deployment(id string) *marathon.Deployment {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	cacheDuration := d.CacheDuration
+	if cacheDuration <= 0 {
+		cacheDuration = DefaultDeploymentsCacheDuration
+	}
+	deployment, present := d.deployments[id]
+	// A deployment we don't know of yet started after we fetched them last
+	if !present || time.Since(d.fetchedAt) > cacheDuration {
+		d.fetch()
+		deployment = d.deployments[id]
+	}
+	return deployment
+}
+
+// fetch refreshes the deployments, on errors we keep using what we had
+func (d *DeploymentStuck) fetch() {
+	deployments, err := d.Client.Deployments()
+	if err != nil {
+		log.Printf("Error - Unable to fetch the deployments from Marathon - %v\n", err)
+		return
+	}
+	d.deployments = make(map[string]*marathon.Deployment)
+	for _, deployment := range deployments {
+		d.deployments[deployment.ID] = deployment
+	}
+	d.fetchedAt = time.Now()
+}
+
+func (d *DeploymentStuck) currentActions(deployment *marathon.Deployment) string {
+	if len(deployment.CurrentActions) == 0 {
+		return "no current actions"
+	}
+	var actions []string
+	for _, action := range deployment.CurrentActions {
+		actions = append(actions, fmt.Sprintf("%s %s", action.Action, action.App))
+	}
+	return "current actions " + strings.Join(actions, ", ")
+}
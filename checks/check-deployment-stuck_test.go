@@ -0,0 +1,143 @@
+package checks
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gambol99/go-marathon"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDeployments struct {
+	deployments []*marathon.Deployment
+	err         error
+	calls       int
+}
+
+func (f *fakeDeployments) Deployments() ([]*marathon.Deployment, error) {
+	f.calls++
+	return f.deployments, f.err
+}
+
+func deploymentStartedAgo(id string, ago time.Duration) *marathon.Deployment {
+	return &marathon.Deployment{
+		ID:          id,
+		Version:     time.Now().Add(-ago).UTC().Format(time.RFC3339Nano),
+		CurrentStep: 2,
+		TotalSteps:  3,
+		CurrentActions: []*marathon.DeploymentStep{
+			&marathon.DeploymentStep{Action: "ScaleApplication", App: "/foo"},
+		},
+	}
+}
+
+func appBeingDeployed(ids ...string) marathon.Application {
+	app := marathon.Application{ID: "/foo"}
+	for _, id := range ids {
+		app.Deployments = append(app.Deployments, map[string]string{"id": id})
+	}
+	return app
+}
+
+func TestDeploymentStuckWhenNoDeploymentIsRunning(t *testing.T) {
+	client := &fakeDeployments{}
+	check := DeploymentStuck{
+		Client:                   client,
+		DefaultWarningThreshold:  15 * time.Minute,
+		DefaultCriticalThreshold: 30 * time.Minute,
+	}
+
+	appCheck := check.Check(appBeingDeployed())
+	assert.Equal(t, Pass, appCheck.Result)
+	assert.Equal(t, "deployment-stuck", appCheck.CheckName)
+	assert.Equal(t, "/foo", appCheck.App)
+	assert.Equal(t, 0, client.calls)
+}
+
+func TestDeploymentStuckWhenDeploymentIsRecent(t *testing.T) {
+	check := DeploymentStuck{
+		Client:                   &fakeDeployments{deployments: []*marathon.Deployment{deploymentStartedAgo("d1", 1*time.Minute)}},
+		DefaultWarningThreshold:  15 * time.Minute,
+		DefaultCriticalThreshold: 30 * time.Minute,
+	}
+
+	appCheck := check.Check(appBeingDeployed("d1"))
+	assert.Equal(t, Pass, appCheck.Result)
+}
+
+func TestDeploymentStuckWhenWarningThresholdIsMet(t *testing.T) {
+	check := DeploymentStuck{
+		Client:                   &fakeDeployments{deployments: []*marathon.Deployment{deploymentStartedAgo("d1", 20*time.Minute)}},
+		DefaultWarningThreshold:  15 * time.Minute,
+		DefaultCriticalThreshold: 30 * time.Minute,
+	}
+
+	appCheck := check.Check(appBeingDeployed("d1"))
+	assert.Equal(t, Warning, appCheck.Result)
+	assert.Equal(t, "Deployment d1 has been running for 20m0s, at step 2 of 3 with current actions ScaleApplication /foo", appCheck.Message)
+}
+
+func TestDeploymentStuckWhenCriticalThresholdIsMet(t *testing.T) {
+	check := DeploymentStuck{
+		Client: &fakeDeployments{deployments: []*marathon.Deployment{
+			deploymentStartedAgo("d1", 20*time.Minute),
+			deploymentStartedAgo("d2", 45*time.Minute),
+		}},
+		DefaultWarningThreshold:  15 * time.Minute,
+		DefaultCriticalThreshold: 30 * time.Minute,
+	}
+
+	appCheck := check.Check(appBeingDeployed("d1", "d2"))
+	assert.Equal(t, Critical, appCheck.Result)
+	assert.Contains(t, appCheck.Message, "Deployment d2 has been running for 45m0s")
+}
+
+func TestDeploymentStuckWhenThresholdsAreOverridenFromAppLabels(t *testing.T) {
+	check := DeploymentStuck{
+		Client:                   &fakeDeployments{deployments: []*marathon.Deployment{deploymentStartedAgo("d1", 20*time.Minute)}},
+		DefaultWarningThreshold:  15 * time.Minute,
+		DefaultCriticalThreshold: 30 * time.Minute,
+	}
+	app := appBeingDeployed("d1")
+	app.Labels = map[string]string{
+		"alerts.deployment-stuck.warn.threshold":     "1h",
+		"alerts.deployment-stuck.critical.threshold": "2h",
+	}
+
+	appCheck := check.Check(app)
+	assert.Equal(t, Pass, appCheck.Result)
+}
+
+func TestDeploymentStuckFetchesDeploymentsOncePerCacheDuration(t *testing.T) {
+	client := &fakeDeployments{deployments: []*marathon.Deployment{deploymentStartedAgo("d1", 20*time.Minute)}}
+	check := DeploymentStuck{
+		Client:                   client,
+		DefaultWarningThreshold:  15 * time.Minute,
+		DefaultCriticalThreshold: 30 * time.Minute,
+		CacheDuration:            1 * time.Hour,
+	}
+
+	check.Check(appBeingDeployed("d1"))
+	check.Check(appBeingDeployed("d1"))
+	assert.Equal(t, 1, client.calls)
+	// A deployment we haven't seen yet
+	check.Check(appBeingDeployed("d2"))
+	assert.Equal(t, 2, client.calls)
+}
+
+func TestDeploymentStuckKeepsLastDeploymentsWhenMarathonFails(t *testing.T) {
+	client := &fakeDeployments{deployments: []*marathon.Deployment{deploymentStartedAgo("d1", 45*time.Minute)}}
+	check := DeploymentStuck{
+		Client:                   client,
+		DefaultWarningThreshold:  15 * time.Minute,
+		DefaultCriticalThreshold: 30 * time.Minute,
+		CacheDuration:            1 * time.Millisecond,
+	}
+	assert.Equal(t, Critical, check.Check(appBeingDeployed("d1")).Result)
+
+	time.Sleep(5 * time.Millisecond)
+	client.deployments = nil
+	client.err = errors.New("marathon is down")
+	assert.Equal(t, Critical, check.Check(appBeingDeployed("d1")).Result)
+}
@@ -0,0 +1,177 @@
+package checks
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gambol99/go-marathon"
+)
+
+// Checks for apps whose tasks keep restarting. A crash looping app can look healthy
+// when we poll it, so we track the tasks across checks and count the ones that got
+// replaced by a new task of the same version, within a window. Scaling up and
+// deployments don't count as restarts.
+type TaskFlapping struct {
+	// DefaultWindow - overriden using alerts.task-flapping.window
+	DefaultWindow time.Duration
+	// DefaultWarningThreshold is the # of restarts in the window - overriden using alerts.task-flapping.warn.threshold
+	DefaultWarningThreshold int
+	// DefaultCriticalThreshold is the # of restarts in the window - overriden using alerts.task-flapping.critical.threshold
+	DefaultCriticalThreshold int
+
+	mutex sync.Mutex
+	apps  map[string]*taskHistory
+}
+
+type taskHistory struct {
+	// Task ID -> Version of the tasks we saw on the last check
+	tasks map[string]string
+	// When the tasks restarted, oldest first
+	restarts    []time.Time
+	lastFailure string
+}
+
+func (h *taskHistory) copy() *taskHistory {
+	tasks := make(map[string]string)
+	for id, version := range h.tasks {
+		tasks[id] = version
+	}
+	restarts := make([]time.Time, len(h.restarts))
+	copy(restarts, h.restarts)
+	return &taskHistory{tasks: tasks, restarts: restarts, lastFailure: h.lastFailure}
+}
+
+func (f *TaskFlapping) Name() string {
+	return "task-flapping"
+}
+
+func (f *TaskFlapping) Embeds() []string {
+	return []string{"apps.tasks", "apps.lastTaskFailure"}
+}
+
+func (f *TaskFlapping) Forget(appID string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.apps, appID)
+}
+
+// InheritState copies the tasks and restarts the previous TaskFlapping has seen, which
+// may still be checking an app while we're reloaded
+func (f *TaskFlapping) InheritState(previous Checker) {
+	previousFlapping, ok := previous.(*TaskFlapping)
+	if !ok || previousFlapping == f {
+		return
+	}
+	apps := make(map[string]*taskHistory)
+	previousFlapping.mutex.Lock()
+	for appID, history := range previousFlapping.apps {
+		apps[appID] = history.copy()
+	}
+	previousFlapping.mutex.Unlock()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.apps = apps
+}
+
+func (f *TaskFlapping) Check(app marathon.Application) AppCheck {
+	window := durationLabel(app.Labels, "alerts.task-flapping.window", f.DefaultWindow)
+	failThreshold := intLabel(app.Labels, "alerts.task-flapping.critical.threshold", f.DefaultCriticalThreshold)
+	warnThreshold := intLabel(app.Labels, "alerts.task-flapping.warn.threshold", f.DefaultWarningThreshold)
+
+	restarts := f.record(app, window)
+	result := Pass
+	if restarts >= failThreshold {
+		result = Critical
+	} else if restarts >= warnThreshold {
+		result = Warning
+	}
+	message := fmt.Sprintf("%d restarts in the last %v", restarts, window)
+	if result != Pass && app.LastTaskFailure != nil {
+		failure := app.LastTaskFailure
+		message = fmt.Sprintf("%s, last failure %s on %s at %s - %s", message, failure.State, failure.Host, failure.Timestamp, failure.Message)
+	}
+
+	return AppCheck{
+		App:       app.ID,
+		Labels:    app.Labels,
+		CheckName: f.Name(),
+		Result:    result,
+		Message:   message,
+		Timestamp: time.Now(),
+	}
+}
+
+// record updates the history of the app with its current tasks, and returns the #
+// of restarts within the window
+func (f *TaskFlapping) record(app marathon.Application, window time.Duration) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.apps == nil {
+		f.apps = make(map[string]*taskHistory)
+	}
+	now := time.Now()
+	current := make(map[string]string)
+	for _, task := range app.Tasks {
+		current[task.ID] = task.Version
+	}
+	lastFailure := ""
+	if app.LastTaskFailure != nil {
+		lastFailure = app.LastTaskFailure.TaskID + "@" + app.LastTaskFailure.Timestamp
+	}
+
+	history, present := f.apps[app.ID]
+	if !present {
+		// Nothing to compare with on the first check
+		f.apps[app.ID] = &taskHistory{tasks: current, lastFailure: lastFailure}
+		return 0
+	}
+
+	// Versions of the tasks that are gone since the last check
+	gone := make(map[string]int)
+	for id, version := range history.tasks {
+		if _, present := current[id]; !present {
+			gone[version]++
+		}
+	}
+	replaced := 0
+	for _, task := range app.Tasks {
+		if _, seen := history.tasks[task.ID]; seen || gone[task.Version] == 0 {
+			continue
+		}
+		gone[task.Version]--
+		replaced++
+		history.restarts = append(history.restarts, taskStartedAt(task, now))
+	}
+	// Tasks can fail and be replaced more than once between two checks, we count at
+	// least the failure Marathon tells us about
+	if replaced == 0 && lastFailure != "" && lastFailure != history.lastFailure {
+		failedAt, err := time.Parse(time.RFC3339Nano, app.LastTaskFailure.Timestamp)
+		if err != nil {
+			failedAt = now
+		}
+		history.restarts = append(history.restarts, failedAt)
+	}
+	history.tasks = current
+	history.lastFailure = lastFailure
+
+	var recent []time.Time
+	for _, restartedAt := range history.restarts {
+		if now.Sub(restartedAt) <= window {
+			recent = append(recent, restartedAt)
+		}
+	}
+	history.restarts = recent
+	return len(recent)
+}
+
+func taskStartedAt(task *marathon.Task, defaultValue time.Time) time.Time {
+	for _, value := range []string{task.StartedAt, task.StagedAt} {
+		startedAt, err := time.Parse(time.RFC3339Nano, value)
+		if err == nil {
+			return startedAt
+		}
+	}
+	return defaultValue
+}
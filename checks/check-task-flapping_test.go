@@ -0,0 +1,138 @@
+package checks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gambol99/go-marathon"
+	"github.com/stretchr/testify/assert"
+)
+
+func appWithTasks(version string, ids ...string) marathon.Application {
+	app := marathon.Application{ID: "/foo", Instances: len(ids)}
+	for _, id := range ids {
+		app.Tasks = append(app.Tasks, &marathon.Task{
+			ID:        id,
+			AppID:     "/foo",
+			Version:   version,
+			StartedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		})
+	}
+	return app
+}
+
+func newTaskFlapping() *TaskFlapping {
+	return &TaskFlapping{
+		DefaultWindow:            10 * time.Minute,
+		DefaultWarningThreshold:  2,
+		DefaultCriticalThreshold: 3,
+	}
+}
+
+func TestTaskFlappingWhenTasksAreStable(t *testing.T) {
+	check := newTaskFlapping()
+	check.Check(appWithTasks("v1", "t1", "t2"))
+	appCheck := check.Check(appWithTasks("v1", "t1", "t2"))
+	assert.Equal(t, Pass, appCheck.Result)
+	assert.Equal(t, "task-flapping", appCheck.CheckName)
+	assert.Equal(t, "/foo", appCheck.App)
+	assert.Equal(t, "0 restarts in the last 10m0s", appCheck.Message)
+}
+
+func TestTaskFlappingWhenTasksKeepRestarting(t *testing.T) {
+	check := newTaskFlapping()
+	assert.Equal(t, Pass, check.Check(appWithTasks("v1", "t1", "t2")).Result)
+	assert.Equal(t, Pass, check.Check(appWithTasks("v1", "t3", "t2")).Result)
+	assert.Equal(t, Warning, check.Check(appWithTasks("v1", "t4", "t2")).Result)
+
+	app := appWithTasks("v1", "t5", "t2")
+	app.LastTaskFailure = &marathon.LastTaskFailure{
+		AppID:     "/foo",
+		Host:      "slave-1",
+		Message:   "Command exited with status 137",
+		State:     "TASK_FAILED",
+		TaskID:    "t4",
+		Timestamp: "2016-03-17T06:43:18.117Z",
+	}
+	appCheck := check.Check(app)
+	assert.Equal(t, Critical, appCheck.Result)
+	assert.Equal(t, "3 restarts in the last 10m0s, last failure TASK_FAILED on slave-1 at 2016-03-17T06:43:18.117Z - Command exited with status 137", appCheck.Message)
+}
+
+func TestTaskFlappingIgnoresScalingAndDeployments(t *testing.T) {
+	check := newTaskFlapping()
+	check.Check(appWithTasks("v1", "t1"))
+	// Scaled up
+	check.Check(appWithTasks("v1", "t1", "t2", "t3"))
+	// Deployed a new version
+	appCheck := check.Check(appWithTasks("v2", "t4", "t5", "t6"))
+	assert.Equal(t, Pass, appCheck.Result)
+	assert.Equal(t, "0 restarts in the last 10m0s", appCheck.Message)
+}
+
+func TestTaskFlappingCountsNewFailuresBetweenChecks(t *testing.T) {
+	check := newTaskFlapping()
+	app := appWithTasks("v1", "t1")
+	check.Check(app)
+	for i := 0; i < 2; i++ {
+		app.LastTaskFailure = &marathon.LastTaskFailure{
+			TaskID:    "t1",
+			State:     "TASK_KILLED",
+			Timestamp: time.Now().Add(time.Duration(i) * time.Second).UTC().Format(time.RFC3339Nano),
+		}
+		check.Check(app)
+	}
+	assert.Equal(t, Warning, check.Check(app).Result)
+}
+
+func TestTaskFlappingForgetsRestartsOutsideTheWindow(t *testing.T) {
+	check := newTaskFlapping()
+	app := appWithTasks("v1", "t1")
+	app.Labels = map[string]string{"alerts.task-flapping.window": "50ms"}
+	check.Check(app)
+	check.Check(appWithTasks("v1", "t2"))
+	app = appWithTasks("v1", "t3")
+	app.Labels = map[string]string{"alerts.task-flapping.window": "50ms"}
+	assert.Equal(t, Warning, check.Check(app).Result)
+
+	time.Sleep(100 * time.Millisecond)
+	appCheck := check.Check(app)
+	assert.Equal(t, Pass, appCheck.Result)
+	assert.Equal(t, "0 restarts in the last 50ms", appCheck.Message)
+}
+
+func TestTaskFlappingWhenThresholdsAreOverridenFromAppLabels(t *testing.T) {
+	check := newTaskFlapping()
+	labels := map[string]string{
+		"alerts.task-flapping.warn.threshold":     "5",
+		"alerts.task-flapping.critical.threshold": "10",
+	}
+	for _, id := range []string{"t1", "t2", "t3", "t4"} {
+		app := appWithTasks("v1", id)
+		app.Labels = labels
+		assert.Equal(t, Pass, check.Check(app).Result)
+	}
+}
+
+func TestTaskFlappingInheritsTheStateOfThePreviousOne(t *testing.T) {
+	previous := newTaskFlapping()
+	previous.Check(appWithTasks("v1", "t1", "t2"))
+	previous.Check(appWithTasks("v1", "t3", "t2"))
+
+	check := newTaskFlapping()
+	check.DefaultWarningThreshold = 1
+	check.InheritState(previous)
+	// The previous one can still be checking while we're reloaded, it keeps its own state
+	assert.Equal(t, Warning, previous.Check(appWithTasks("v1", "t4", "t2")).Result)
+	assert.Equal(t, Warning, check.Check(appWithTasks("v1", "t3", "t2")).Result)
+}
+
+func TestTaskFlappingForget(t *testing.T) {
+	check := newTaskFlapping()
+	check.Check(appWithTasks("v1", "t1"))
+	check.Check(appWithTasks("v1", "t2"))
+	check.Forget("/foo")
+	// We start afresh once the app is forgotten
+	check.Check(appWithTasks("v1", "t3"))
+	assert.Equal(t, Pass, check.Check(appWithTasks("v1", "t4")).Result)
+}
@@ -1,12 +1,17 @@
 package checks
 
 import (
+	"log"
+	"strconv"
 	"time"
 
+	maps "github.com/ashwanthkumar/golang-utils/maps"
 	"github.com/gambol99/go-marathon"
 )
 
 type AppCheck struct {
+	// Cluster is the name of the Marathon cluster the App runs on, empty when we watch only one
+	Cluster   string
 	App       string
 	CheckName string
 	Result    CheckStatus
@@ -14,6 +19,16 @@ type AppCheck struct {
 	Timestamp time.Time
 	Labels    map[string]string
 	Times     int
+	// AckedBy and AckComment are set by AlertManager once someone acks the open alert
+	AckedBy    string
+	AckComment string
+	// Link is the page of the App on the Marathon (or DC/OS) UI, set by the AppChecker
+	Link string
+	// Runbook is what to do about the check, set by AlertManager on the checks it notifies
+	Runbook string
+	// OpenedAt is when the alert of the check was opened, set by AlertManager on the
+	// checks it notifies
+	OpenedAt time.Time
 }
 
 type Checker interface {
@@ -21,6 +36,26 @@ type Checker interface {
 	Check(marathon.Application) AppCheck
 }
 
+// StatefulChecker is a Checker that keeps history of the apps between checks, it's
+// told about the apps that are gone from Marathon so it can forget them
+type StatefulChecker interface {
+	Checker
+	Forget(appID string)
+}
+
+// StateInheritor is a Checker that keeps state between checks. When the checks are
+// rebuilt, like on a config reload, the new one takes over the state of the Checker
+// of the same name it replaces.
+type StateInheritor interface {
+	InheritState(previous Checker)
+}
+
+// EmbedRequester is a Checker that needs more than the default fields of the apps,
+// like their tasks. Embeds are the values for the embed param of /v2/apps.
+type EmbedRequester interface {
+	Embeds() []string
+}
+
 type CheckStatus uint8
 
 const (
@@ -47,3 +82,21 @@ func CheckStatusToString(result CheckStatus) string {
 
 	return value
 }
+
+func durationLabel(labels map[string]string, label string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(maps.GetString(labels, label, defaultValue.String()))
+	if err != nil {
+		log.Printf("Error - Expected a duration like 30m for %s but %s found\n", label, labels[label])
+		return defaultValue
+	}
+	return value
+}
+
+func intLabel(labels map[string]string, label string, defaultValue int) int {
+	value, err := strconv.Atoi(maps.GetString(labels, label, strconv.Itoa(defaultValue)))
+	if err != nil {
+		log.Printf("Error - Expected a number for %s but %s found\n", label, labels[label])
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,784 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/auth"
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/deadletter"
+	"github.com/ashwanthkumar/marathon-alerts/maintenance"
+	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+	"github.com/ashwanthkumar/marathon-alerts/routes"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is everything marathon-alerts can be configured with. It's read from the
+// --config file (YAML or JSON) and the flags set on the command line override it.
+type Config struct {
+	Marathon MarathonConfig `yaml:"marathon"`
+	// Clusters are used instead of Marathon to watch more than one Marathon cluster
+	Clusters  []ClusterConfig  `yaml:"clusters"`
+	Checks    ChecksConfig     `yaml:"checks"`
+	Alerts    AlertsConfig     `yaml:"alerts"`
+	Notifiers []NotifierConfig `yaml:"notifiers"`
+	// Escalations are picked by name in alerts.escalation or the alerts.escalation label
+	Escalations []EscalationPolicy `yaml:"escalations"`
+	// Maintenance windows, more can be added at runtime through the API
+	Maintenance []maintenance.Window `yaml:"maintenance"`
+	HTTPAddress string               `yaml:"http-address"`
+	PidFile     string               `yaml:"pid"`
+	Debug       bool                 `yaml:"debug"`
+	// ShutdownTimeout is how long we wait for in-flight notifications on SIGTERM / SIGINT
+	ShutdownTimeout time.Duration `yaml:"shutdown-timeout"`
+	// Dispatch configures how the notifications are sent and retried
+	Dispatch DispatchConfig `yaml:"dispatch"`
+}
+
+// DispatchConfig configures the Dispatcher, failed notifications are written to the
+// DeadLetterFile (if set) to be sent again with the replay command
+type DispatchConfig struct {
+	QueueSize      int           `yaml:"queue-size"`
+	Timeout        time.Duration `yaml:"timeout"`
+	MaxRetries     int           `yaml:"max-retries"`
+	RetryBackoff   time.Duration `yaml:"retry-backoff"`
+	DeadLetterFile string        `yaml:"dead-letter-file"`
+}
+
+type MarathonConfig struct {
+	URI           string        `yaml:"uri"`
+	CheckInterval time.Duration `yaml:"check-interval"`
+	EventStream   bool          `yaml:"event-stream"`
+	// AppLink is a text/template of the page of the app the checks link to, it
+	// defaults to the app on the Marathon UI at the first URI
+	AppLink    string `yaml:"app-link"`
+	AuthConfig `yaml:",inline"`
+}
+
+// ClusterConfig is a named Marathon cluster, every check from it is tagged with the
+// Name. CheckInterval and AppLink default to the ones in MarathonConfig.
+type ClusterConfig struct {
+	Name          string        `yaml:"name"`
+	URI           string        `yaml:"uri"`
+	CheckInterval time.Duration `yaml:"check-interval"`
+	EventStream   bool          `yaml:"event-stream"`
+	AppLink       string        `yaml:"app-link"`
+	AuthConfig    `yaml:",inline"`
+}
+
+// AuthConfig is how we authenticate to Marathon, either with basic auth or as a
+// DC/OS service account, and the TLS settings to talk to it. Password and
+// DCOSPrivateKey can be read from `file:<path>` or `env:<name>`.
+type AuthConfig struct {
+	Username       string `yaml:"username"`
+	Password       string `yaml:"password"`
+	DCOSUID        string `yaml:"dcos-uid"`
+	DCOSPrivateKey string `yaml:"dcos-private-key"`
+	// DCOSLoginURL defaults to /acs/api/v1/auth/login on the host of the first URI
+	DCOSLoginURL string `yaml:"dcos-login-url"`
+	CACert       string `yaml:"ca-cert"`
+	ClientCert   string `yaml:"client-cert"`
+	ClientKey    string `yaml:"client-key"`
+}
+
+type ChecksConfig struct {
+	MinHealthy      ThresholdConfig         `yaml:"min-healthy"`
+	MinInstances    ThresholdConfig         `yaml:"min-instances"`
+	DeploymentStuck DurationThresholdConfig `yaml:"deployment-stuck"`
+	TaskFlapping    TaskFlappingConfig      `yaml:"task-flapping"`
+}
+
+type ThresholdConfig struct {
+	WarnThreshold     float32 `yaml:"warn-threshold"`
+	CriticalThreshold float32 `yaml:"critical-threshold"`
+}
+
+// DurationThresholdConfig is for checks that alert when something takes too long
+type DurationThresholdConfig struct {
+	WarnThreshold     time.Duration `yaml:"warn-threshold"`
+	CriticalThreshold time.Duration `yaml:"critical-threshold"`
+}
+
+// TaskFlappingConfig has the # of restarts within the Window to alert on
+type TaskFlappingConfig struct {
+	Window            time.Duration `yaml:"window"`
+	WarnThreshold     int           `yaml:"warn-threshold"`
+	CriticalThreshold int           `yaml:"critical-threshold"`
+}
+
+type AlertsConfig struct {
+	SuppressDuration time.Duration `yaml:"suppress-duration"`
+	// Routes is the routing table of every app, the alerts.routes label of an app
+	// overrides it or extends it (when the label starts with a `+`)
+	Routes    RouteTable `yaml:"routes"`
+	StateFile string     `yaml:"state-file"`
+	// Escalation is the policy for apps without an alerts.escalation label, alerts are
+	// re-notified every SuppressDuration when empty
+	Escalation string `yaml:"escalation"`
+	// Flapping checks are notified when they start and stop flapping, not on every change
+	Flapping FlapDetection `yaml:"flapping"`
+	// FailAfter consecutive failures open an alert and ResolveAfter consecutive passes
+	// resolve it, the alerts.<check>.fail-after and resolve-after labels override them
+	FailAfter    int `yaml:"fail-after"`
+	ResolveAfter int `yaml:"resolve-after"`
+	// Notifications within GroupWindow are sent as one digest per GroupBy, 0 disables it
+	GroupWindow time.Duration `yaml:"group-window"`
+	GroupBy     string        `yaml:"group-by"`
+	// HistorySize is the # of transitions of every check kept for the history API
+	HistorySize int `yaml:"history-size"`
+	// Runbook is a text/template of the runbook link of the apps without an
+	// alerts.runbook label
+	Runbook string `yaml:"runbook"`
+}
+
+// RouteTable is a `;` separated list of routes, in the config file it can also be a
+// list with a route per item
+type RouteTable string
+
+func (r *RouteTable) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var table []string
+	err := unmarshal(&table)
+	if err == nil {
+		*r = RouteTable(strings.Join(table, ";"))
+		return nil
+	}
+	var routes string
+	err = unmarshal(&routes)
+	if err != nil {
+		return fmt.Errorf("Expected alerts.routes to be a string or a list of routes")
+	}
+	*r = RouteTable(routes)
+	return nil
+}
+
+// NotifierConfig configures a single notifier instance. Name is what routes match
+// against, so there can be more than one notifier of a Type. Only the fields of
+// the notifier's Type are used.
+type NotifierConfig struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// slack
+	Webhook string `yaml:"webhook"`
+	Channel string `yaml:"channel"`
+	Owners  string `yaml:"owners"`
+	// pagerduty
+	RoutingKey string `yaml:"routing-key"`
+	// webhook
+	URLs       string            `yaml:"urls"`
+	Headers    map[string]string `yaml:"headers"`
+	HMACSecret string            `yaml:"hmac-secret"`
+	// email
+	SMTPServer   string `yaml:"smtp-server"`
+	SMTPTLS      string `yaml:"smtp-tls"`
+	SMTPUsername string `yaml:"smtp-username"`
+	SMTPPassword string `yaml:"smtp-password"`
+	From         string `yaml:"from"`
+	To           string `yaml:"to"`
+	// slack, pagerduty and email
+	Templates notifiers.Templates `yaml:"templates"`
+}
+
+var NotifierTypes = []string{"slack", "pagerduty", "webhook", "email"}
+
+// flagOverrides copy the value of a flag into the config, we apply them only for
+// the flags that were set on the command line
+var flagOverrides = map[string]func(c *Config){
+	"uri":                                       func(c *Config) { c.Marathon.URI = marathonURI },
+	"check-interval":                            func(c *Config) { c.Marathon.CheckInterval = checkInterval },
+	"event-stream":                              func(c *Config) { c.Marathon.EventStream = eventStreamEnabled },
+	"app-link":                                  func(c *Config) { c.Marathon.AppLink = appLink },
+	"marathon-username":                         func(c *Config) { c.Marathon.Username = marathonUsername },
+	"marathon-password":                         func(c *Config) { c.Marathon.Password = marathonPassword },
+	"dcos-uid":                                  func(c *Config) { c.Marathon.DCOSUID = dcosUID },
+	"dcos-private-key":                          func(c *Config) { c.Marathon.DCOSPrivateKey = dcosPrivateKey },
+	"dcos-login-url":                            func(c *Config) { c.Marathon.DCOSLoginURL = dcosLoginURL },
+	"marathon-ca-cert":                          func(c *Config) { c.Marathon.CACert = marathonCACert },
+	"marathon-client-cert":                      func(c *Config) { c.Marathon.ClientCert = marathonClientCert },
+	"marathon-client-key":                       func(c *Config) { c.Marathon.ClientKey = marathonClientKey },
+	"check-min-healthy-warn-threshold":          func(c *Config) { c.Checks.MinHealthy.WarnThreshold = minHealthyWarningThreshold },
+	"check-min-healthy-critical-threshold":      func(c *Config) { c.Checks.MinHealthy.CriticalThreshold = minHealthyCriticalThreshold },
+	"check-min-instances-warn-threshold":        func(c *Config) { c.Checks.MinInstances.WarnThreshold = minInstancesWarningThreshold },
+	"check-min-instances-critical-threshold":    func(c *Config) { c.Checks.MinInstances.CriticalThreshold = minInstancesCriticalThreshold },
+	"check-deployment-stuck-warn-threshold":     func(c *Config) { c.Checks.DeploymentStuck.WarnThreshold = deploymentStuckWarningThreshold },
+	"check-deployment-stuck-critical-threshold": func(c *Config) { c.Checks.DeploymentStuck.CriticalThreshold = deploymentStuckCriticalThreshold },
+	"check-task-flapping-window":                func(c *Config) { c.Checks.TaskFlapping.Window = taskFlappingWindow },
+	"check-task-flapping-warn-threshold":        func(c *Config) { c.Checks.TaskFlapping.WarnThreshold = taskFlappingWarningThreshold },
+	"check-task-flapping-critical-threshold":    func(c *Config) { c.Checks.TaskFlapping.CriticalThreshold = taskFlappingCriticalThreshold },
+	"alerts-suppress-duration":                  func(c *Config) { c.Alerts.SuppressDuration = alertSuppressDuration },
+	"alerts-routes":                             func(c *Config) { c.Alerts.Routes = RouteTable(alertRoutes) },
+	"alerts-escalation":                         func(c *Config) { c.Alerts.Escalation = alertEscalation },
+	"alerts-flap-history":                       func(c *Config) { c.Alerts.Flapping.History = flapHistory },
+	"alerts-flap-high-threshold":                func(c *Config) { c.Alerts.Flapping.HighThreshold = flapHighThreshold },
+	"alerts-flap-low-threshold":                 func(c *Config) { c.Alerts.Flapping.LowThreshold = flapLowThreshold },
+	"alerts-fail-after":                         func(c *Config) { c.Alerts.FailAfter = alertFailAfter },
+	"alerts-resolve-after":                      func(c *Config) { c.Alerts.ResolveAfter = alertResolveAfter },
+	"alerts-group-window":                       func(c *Config) { c.Alerts.GroupWindow = alertGroupWindow },
+	"alerts-group-by":                           func(c *Config) { c.Alerts.GroupBy = alertGroupBy },
+	"alerts-history-size":                       func(c *Config) { c.Alerts.HistorySize = alertHistorySize },
+	"alerts-runbook":                            func(c *Config) { c.Alerts.Runbook = alertRunbook },
+	"state-file":                                func(c *Config) { c.Alerts.StateFile = stateFile },
+	"http-address":                              func(c *Config) { c.HTTPAddress = httpAddress },
+	"pid":                                       func(c *Config) { c.PidFile = pidFile },
+	"debug":                                     func(c *Config) { c.Debug = debugMode },
+	"shutdown-timeout":                          func(c *Config) { c.ShutdownTimeout = shutdownTimeout },
+	"notify-queue-size":                         func(c *Config) { c.Dispatch.QueueSize = notifyQueueSize },
+	"notify-timeout":                            func(c *Config) { c.Dispatch.Timeout = notifyTimeout },
+	"notify-max-retries":                        func(c *Config) { c.Dispatch.MaxRetries = notifyMaxRetries },
+	"notify-retry-backoff":                      func(c *Config) { c.Dispatch.RetryBackoff = notifyRetryBackoff },
+	"dead-letter-file":                          func(c *Config) { c.Dispatch.DeadLetterFile = deadLetterFile },
+	"slack-webhook":                             func(c *Config) { c.notifier("slack").Webhook = slackWebhooks },
+	"slack-channel":                             func(c *Config) { c.notifier("slack").Channel = slackChannel },
+	"slack-owner":                               func(c *Config) { c.notifier("slack").Owners = slackOwners },
+	"pagerduty-routing-key":                     func(c *Config) { c.notifier("pagerduty").RoutingKey = pagerDutyRoutingKey },
+	"webhook-url":                               func(c *Config) { c.notifier("webhook").URLs = webhookURLs },
+	"webhook-hmac-secret":                       func(c *Config) { c.notifier("webhook").HMACSecret = webhookSecret },
+	"email-smtp-server":                         func(c *Config) { c.notifier("email").SMTPServer = emailSMTPServer },
+	"email-smtp-tls":                            func(c *Config) { c.notifier("email").SMTPTLS = emailSMTPTLS },
+	"email-smtp-username":                       func(c *Config) { c.notifier("email").SMTPUsername = emailSMTPUsername },
+	"email-smtp-password":                       func(c *Config) { c.notifier("email").SMTPPassword = emailSMTPPassword },
+	"email-from":                                func(c *Config) { c.notifier("email").From = emailFrom },
+	"email-to":                                  func(c *Config) { c.notifier("email").To = emailTo },
+	"webhook-header": func(c *Config) {
+		headers, err := notifiers.ParseWebhookHeaders(webhookHeaders)
+		if err == nil {
+			c.notifier("webhook").Headers = headers
+		}
+	},
+}
+
+// LoadConfig reads the config file (if any) over the default values of the flags,
+// and then applies the flags that were set on the command line
+func LoadConfig(path string, flags *flag.FlagSet) (*Config, error) {
+	config, err := configFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		err = yaml.UnmarshalStrict(content, config)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse %s - %v", path, err)
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		override, present := flagOverrides[f.Name]
+		if present {
+			override(config)
+		}
+	})
+
+	return config, config.Validate()
+}
+
+func configFromFlags() (*Config, error) {
+	headers, err := notifiers.ParseWebhookHeaders(webhookHeaders)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		Marathon: MarathonConfig{
+			URI:           marathonURI,
+			CheckInterval: checkInterval,
+			EventStream:   eventStreamEnabled,
+			AppLink:       appLink,
+			AuthConfig: AuthConfig{
+				Username:       marathonUsername,
+				Password:       marathonPassword,
+				DCOSUID:        dcosUID,
+				DCOSPrivateKey: dcosPrivateKey,
+				DCOSLoginURL:   dcosLoginURL,
+				CACert:         marathonCACert,
+				ClientCert:     marathonClientCert,
+				ClientKey:      marathonClientKey,
+			},
+		},
+		Checks: ChecksConfig{
+			MinHealthy: ThresholdConfig{
+				WarnThreshold:     minHealthyWarningThreshold,
+				CriticalThreshold: minHealthyCriticalThreshold,
+			},
+			MinInstances: ThresholdConfig{
+				WarnThreshold:     minInstancesWarningThreshold,
+				CriticalThreshold: minInstancesCriticalThreshold,
+			},
+			DeploymentStuck: DurationThresholdConfig{
+				WarnThreshold:     deploymentStuckWarningThreshold,
+				CriticalThreshold: deploymentStuckCriticalThreshold,
+			},
+			TaskFlapping: TaskFlappingConfig{
+				Window:            taskFlappingWindow,
+				WarnThreshold:     taskFlappingWarningThreshold,
+				CriticalThreshold: taskFlappingCriticalThreshold,
+			},
+		},
+		Alerts: AlertsConfig{
+			SuppressDuration: alertSuppressDuration,
+			Routes:           RouteTable(alertRoutes),
+			StateFile:        stateFile,
+			Escalation:       alertEscalation,
+			Flapping: FlapDetection{
+				History:       flapHistory,
+				HighThreshold: flapHighThreshold,
+				LowThreshold:  flapLowThreshold,
+			},
+			FailAfter:    alertFailAfter,
+			ResolveAfter: alertResolveAfter,
+			GroupWindow:  alertGroupWindow,
+			GroupBy:      alertGroupBy,
+			HistorySize:  alertHistorySize,
+			Runbook:      alertRunbook,
+		},
+		Notifiers: []NotifierConfig{
+			NotifierConfig{Name: "slack", Type: "slack", Webhook: slackWebhooks, Channel: slackChannel, Owners: slackOwners},
+			NotifierConfig{Name: "pagerduty", Type: "pagerduty", RoutingKey: pagerDutyRoutingKey},
+			NotifierConfig{Name: "webhook", Type: "webhook", URLs: webhookURLs, Headers: headers, HMACSecret: webhookSecret},
+			NotifierConfig{Name: "email", Type: "email", SMTPServer: emailSMTPServer, SMTPTLS: emailSMTPTLS, SMTPUsername: emailSMTPUsername,
+				SMTPPassword: emailSMTPPassword, From: emailFrom, To: emailTo},
+		},
+		HTTPAddress:     httpAddress,
+		PidFile:         pidFile,
+		Debug:           debugMode,
+		ShutdownTimeout: shutdownTimeout,
+		Dispatch: DispatchConfig{
+			QueueSize:      notifyQueueSize,
+			Timeout:        notifyTimeout,
+			MaxRetries:     notifyMaxRetries,
+			RetryBackoff:   notifyRetryBackoff,
+			DeadLetterFile: deadLetterFile,
+		},
+	}, nil
+}
+
+// notifier returns the notifier with the name of its type which the notifier flags
+// configure, adding one if the config file didn't have it
+func (c *Config) notifier(notifierType string) *NotifierConfig {
+	for i := range c.Notifiers {
+		if c.Notifiers[i].Name == notifierType {
+			return &c.Notifiers[i]
+		}
+	}
+	c.Notifiers = append(c.Notifiers, NotifierConfig{Name: notifierType, Type: notifierType})
+	return &c.Notifiers[len(c.Notifiers)-1]
+}
+
+// AllClusters returns the clusters to watch, the one in MarathonConfig when there
+// are no named Clusters
+func (c *Config) AllClusters() []ClusterConfig {
+	if len(c.Clusters) == 0 {
+		return []ClusterConfig{ClusterConfig{
+			URI:           c.Marathon.URI,
+			CheckInterval: c.Marathon.CheckInterval,
+			EventStream:   c.Marathon.EventStream,
+			AppLink:       defaultAppLink(c.Marathon.AppLink, c.Marathon.URI),
+			AuthConfig:    c.Marathon.AuthConfig,
+		}}
+	}
+	var clusters []ClusterConfig
+	for _, cluster := range c.Clusters {
+		if cluster.CheckInterval == 0 {
+			cluster.CheckInterval = c.Marathon.CheckInterval
+		}
+		if cluster.AppLink == "" {
+			cluster.AppLink = c.Marathon.AppLink
+		}
+		cluster.AppLink = defaultAppLink(cluster.AppLink, cluster.URI)
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// defaultAppLink is the link, or the app on the Marathon UI at the first of the uris
+func defaultAppLink(link, uris string) string {
+	if link != "" || uris == "" {
+		return link
+	}
+	return strings.TrimRight(strings.Split(uris, ",")[0], "/") + MarathonAppLink
+}
+
+func (c *Config) Validate() error {
+	if c.Marathon.URI == "" && len(c.Clusters) == 0 {
+		return fmt.Errorf("Expected marathon.uri (or --uri) or clusters to be set")
+	}
+	if c.Marathon.URI != "" && len(c.Clusters) > 0 {
+		return fmt.Errorf("Expected either marathon.uri (or --uri) or clusters to be set but found both")
+	}
+	if c.Marathon.CheckInterval <= 0 {
+		return fmt.Errorf("Expected a positive marathon.check-interval but %v found", c.Marathon.CheckInterval)
+	}
+	err := c.Marathon.AuthConfig.validate("marathon")
+	if err != nil {
+		return err
+	}
+	clusterNames := make(map[string]bool)
+	for _, cluster := range c.Clusters {
+		if cluster.Name == "" || cluster.URI == "" {
+			return fmt.Errorf("Expected every cluster to have a name and uri")
+		}
+		if clusterNames[cluster.Name] {
+			return fmt.Errorf("Expected unique cluster names but %s is used more than once", cluster.Name)
+		}
+		clusterNames[cluster.Name] = true
+		if cluster.CheckInterval < 0 {
+			return fmt.Errorf("Expected a positive check-interval for cluster %s but %v found", cluster.Name, cluster.CheckInterval)
+		}
+		err = cluster.AuthConfig.validate("cluster " + cluster.Name)
+		if err != nil {
+			return err
+		}
+	}
+	for _, cluster := range c.AllClusters() {
+		name := "marathon.app-link"
+		if cluster.Name != "" {
+			name = "app-link of cluster " + cluster.Name
+		}
+		err = validateLink(name, cluster.AppLink)
+		if err != nil {
+			return err
+		}
+	}
+	err = validateLink("alerts.runbook", c.Alerts.Runbook)
+	if err != nil {
+		return err
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("Expected a positive shutdown-timeout but %v found", c.ShutdownTimeout)
+	}
+	if c.Dispatch.QueueSize <= 0 {
+		return fmt.Errorf("Expected a positive dispatch.queue-size but %d found", c.Dispatch.QueueSize)
+	}
+	if c.Dispatch.Timeout <= 0 {
+		return fmt.Errorf("Expected a positive dispatch.timeout but %v found", c.Dispatch.Timeout)
+	}
+	if c.Dispatch.MaxRetries < 0 {
+		return fmt.Errorf("Expected a non-negative dispatch.max-retries but %d found", c.Dispatch.MaxRetries)
+	}
+	if c.Dispatch.RetryBackoff <= 0 {
+		return fmt.Errorf("Expected a positive dispatch.retry-backoff but %v found", c.Dispatch.RetryBackoff)
+	}
+	if c.Alerts.SuppressDuration < 0 {
+		return fmt.Errorf("Expected a non-negative alerts.suppress-duration but %v found", c.Alerts.SuppressDuration)
+	}
+	err = c.Checks.MinHealthy.validate("min-healthy")
+	if err != nil {
+		return err
+	}
+	err = c.Checks.MinInstances.validate("min-instances")
+	if err != nil {
+		return err
+	}
+	err = c.Checks.DeploymentStuck.validate("deployment-stuck")
+	if err != nil {
+		return err
+	}
+	err = c.Checks.TaskFlapping.validate()
+	if err != nil {
+		return err
+	}
+	_, err = routes.ParseRoutes(string(c.Alerts.Routes))
+	if err != nil {
+		return fmt.Errorf("Invalid alerts.routes - %v", err)
+	}
+	err = c.Alerts.Flapping.Validate()
+	if err != nil {
+		return err
+	}
+	if c.Alerts.FailAfter < 1 || c.Alerts.ResolveAfter < 1 {
+		return fmt.Errorf("Expected alerts.fail-after (%d) and alerts.resolve-after (%d) to be at least 1", c.Alerts.FailAfter, c.Alerts.ResolveAfter)
+	}
+	if c.Alerts.HistorySize <= 0 {
+		return fmt.Errorf("Expected a positive alerts.history-size but %d found", c.Alerts.HistorySize)
+	}
+	if c.Alerts.GroupWindow < 0 {
+		return fmt.Errorf("Expected a non-negative alerts.group-window but %v found", c.Alerts.GroupWindow)
+	}
+	if !isOneOf(c.Alerts.GroupBy, GroupByOptions) {
+		return fmt.Errorf("Expected alerts.group-by to be one of %v but %s found", GroupByOptions, c.Alerts.GroupBy)
+	}
+
+	escalations := make(map[string]bool)
+	for _, escalation := range c.Escalations {
+		err = escalation.Validate()
+		if err != nil {
+			return err
+		}
+		if escalations[escalation.Name] {
+			return fmt.Errorf("Expected unique escalation policy names but %s is used more than once", escalation.Name)
+		}
+		escalations[escalation.Name] = true
+	}
+	if c.Alerts.Escalation != "" && !escalations[c.Alerts.Escalation] {
+		return fmt.Errorf("Expected alerts.escalation to be one of the escalation policies but %s found", c.Alerts.Escalation)
+	}
+
+	for _, window := range c.Maintenance {
+		err = window.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, notifier := range c.Notifiers {
+		if notifier.Name == "" {
+			return fmt.Errorf("Expected every notifier to have a name")
+		}
+		if names[notifier.Name] {
+			return fmt.Errorf("Expected unique notifier names but %s is used more than once", notifier.Name)
+		}
+		names[notifier.Name] = true
+		if !isOneOf(notifier.Type, NotifierTypes) {
+			return fmt.Errorf("Expected notifier %s to be of type one of %v but %s found", notifier.Name, NotifierTypes, notifier.Type)
+		}
+		hasTemplates := notifier.Templates.Title != "" || notifier.Templates.Body != "" || len(notifier.Templates.Fields) > 0
+		if hasTemplates && notifier.Type == "webhook" {
+			return fmt.Errorf("Expected templates only on slack, pagerduty or email notifiers but %s is a webhook", notifier.Name)
+		}
+		if notifier.Type == "email" {
+			err = notifier.validateEmail()
+			if err != nil {
+				return err
+			}
+		}
+		err = notifier.Templates.Validate()
+		if err != nil {
+			return fmt.Errorf("Expected valid templates for notifier %s - %v", notifier.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (n NotifierConfig) validateEmail() error {
+	if n.SMTPTLS != "" && !isOneOf(n.SMTPTLS, notifiers.EmailTLSModes) {
+		return fmt.Errorf("Expected smtp-tls of notifier %s to be one of %v but %s found", n.Name, notifiers.EmailTLSModes, n.SMTPTLS)
+	}
+	if n.SMTPServer == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(n.SMTPServer); err != nil {
+		return fmt.Errorf("Expected smtp-server of notifier %s to be a host:port but %s found", n.Name, n.SMTPServer)
+	}
+	if n.From == "" {
+		return fmt.Errorf("Expected notifier %s to have a from address", n.Name)
+	}
+	return nil
+}
+
+func (a *AuthConfig) validate(name string) error {
+	if a.Username != "" && a.DCOSUID != "" {
+		return fmt.Errorf("Expected either username or dcos-uid for %s but found both", name)
+	}
+	if a.DCOSUID != "" && a.DCOSPrivateKey == "" {
+		return fmt.Errorf("Expected a dcos-private-key for the dcos-uid of %s", name)
+	}
+	if (a.ClientCert == "") != (a.ClientKey == "") {
+		return fmt.Errorf("Expected both client-cert and client-key for %s or neither", name)
+	}
+	return nil
+}
+
+func (t *ThresholdConfig) validate(check string) error {
+	if t.WarnThreshold < 0 || t.WarnThreshold > 1 || t.CriticalThreshold < 0 || t.CriticalThreshold > 1 {
+		return fmt.Errorf("Expected checks.%s thresholds to be between 0 and 1", check)
+	}
+	if t.CriticalThreshold > t.WarnThreshold {
+		return fmt.Errorf("Expected checks.%s critical-threshold (%v) to be less than or equal to warn-threshold (%v)", check, t.CriticalThreshold, t.WarnThreshold)
+	}
+	return nil
+}
+
+func (t *DurationThresholdConfig) validate(check string) error {
+	if t.WarnThreshold <= 0 || t.CriticalThreshold <= 0 {
+		return fmt.Errorf("Expected checks.%s thresholds to be positive", check)
+	}
+	if t.CriticalThreshold < t.WarnThreshold {
+		return fmt.Errorf("Expected checks.%s critical-threshold (%v) to be greater than or equal to warn-threshold (%v)", check, t.CriticalThreshold, t.WarnThreshold)
+	}
+	return nil
+}
+
+func (t *TaskFlappingConfig) validate() error {
+	if t.Window <= 0 {
+		return fmt.Errorf("Expected a positive checks.task-flapping.window but %v found", t.Window)
+	}
+	if t.WarnThreshold <= 0 || t.CriticalThreshold <= 0 {
+		return fmt.Errorf("Expected checks.task-flapping thresholds to be positive")
+	}
+	if t.CriticalThreshold < t.WarnThreshold {
+		return fmt.Errorf("Expected checks.task-flapping critical-threshold (%d) to be greater than or equal to warn-threshold (%d)", t.CriticalThreshold, t.WarnThreshold)
+	}
+	return nil
+}
+
+func isOneOf(value string, options []string) bool {
+	for _, option := range options {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildChecks creates all the checks we run on every app
+func (c *Config) BuildChecks(client checks.Deployments) []checks.Checker {
+	minHealthyTasks := &checks.MinHealthyTasks{
+		DefaultCriticalThreshold: c.Checks.MinHealthy.CriticalThreshold,
+		DefaultWarningThreshold:  c.Checks.MinHealthy.WarnThreshold,
+	}
+	minInstances := &checks.MinInstances{
+		DefaultCriticalThreshold: c.Checks.MinInstances.CriticalThreshold,
+		DefaultWarningThreshold:  c.Checks.MinInstances.WarnThreshold,
+	}
+	suspendedCheck := &checks.SuspendedCheck{}
+	deploymentStuck := &checks.DeploymentStuck{
+		Client:                   client,
+		DefaultCriticalThreshold: c.Checks.DeploymentStuck.CriticalThreshold,
+		DefaultWarningThreshold:  c.Checks.DeploymentStuck.WarnThreshold,
+	}
+	taskFlapping := &checks.TaskFlapping{
+		DefaultWindow:            c.Checks.TaskFlapping.Window,
+		DefaultCriticalThreshold: c.Checks.TaskFlapping.CriticalThreshold,
+		DefaultWarningThreshold:  c.Checks.TaskFlapping.WarnThreshold,
+	}
+	return []checks.Checker{minHealthyTasks, minInstances, suspendedCheck, deploymentStuck, taskFlapping}
+}
+
+// BuildEscalations returns the escalation policies by name
+func (c *Config) BuildEscalations() map[string]EscalationPolicy {
+	escalations := make(map[string]EscalationPolicy)
+	for _, escalation := range c.Escalations {
+		escalations[escalation.Name] = escalation
+	}
+	return escalations
+}
+
+// BuildDispatcher creates the Dispatcher of the notifications
+func (c *Config) BuildDispatcher() *Dispatcher {
+	dispatcher := &Dispatcher{
+		QueueSize:    c.Dispatch.QueueSize,
+		Timeout:      c.Dispatch.Timeout,
+		MaxRetries:   c.Dispatch.MaxRetries,
+		RetryBackoff: c.Dispatch.RetryBackoff,
+	}
+	if c.Dispatch.DeadLetterFile != "" {
+		dispatcher.DeadLetters = &deadletter.Log{Path: c.Dispatch.DeadLetterFile}
+	}
+	return dispatcher
+}
+
+// BuildNotifiers creates every notifier in the config
+func (c *Config) BuildNotifiers() []notifiers.Notifier {
+	var allNotifiers []notifiers.Notifier
+	for _, notifier := range c.Notifiers {
+		switch notifier.Type {
+		case "slack":
+			allNotifiers = append(allNotifiers, &notifiers.Slack{
+				Alias:     notifier.Name,
+				Webhook:   notifier.Webhook,
+				Channel:   notifier.Channel,
+				Owners:    notifier.Owners,
+				Templates: notifier.Templates,
+			})
+		case "pagerduty":
+			allNotifiers = append(allNotifiers, &notifiers.PagerDuty{
+				Alias:      notifier.Name,
+				RoutingKey: notifier.RoutingKey,
+				Templates:  notifier.Templates,
+				Client: &http.Client{
+					Timeout: (30 * time.Second),
+				},
+			})
+		case "email":
+			allNotifiers = append(allNotifiers, &notifiers.Email{
+				Alias:     notifier.Name,
+				Server:    notifier.SMTPServer,
+				TLS:       notifier.SMTPTLS,
+				Username:  notifier.SMTPUsername,
+				Password:  notifier.SMTPPassword,
+				From:      notifier.From,
+				To:        notifier.To,
+				Templates: notifier.Templates,
+			})
+		case "webhook":
+			allNotifiers = append(allNotifiers, &notifiers.Webhook{
+				Alias:   notifier.Name,
+				URLs:    notifier.URLs,
+				Headers: notifier.Headers,
+				Secret:  notifier.HMACSecret,
+				Client: &http.Client{
+					Timeout: (30 * time.Second),
+				},
+			})
+		}
+	}
+	return allNotifiers
+}
+
+// BuildTransport creates the http.RoundTripper that authenticates every request to
+// the cluster, it's shared by the Marathon client and the event stream
+func (c ClusterConfig) BuildTransport() (http.RoundTripper, error) {
+	tlsConfig, err := auth.TLSConfig(c.CACert, c.ClientCert, c.ClientKey)
+	if err != nil {
+		return nil, err
+	}
+	transport := &auth.Transport{Username: c.Username}
+	if tlsConfig != nil {
+		transport.Base = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+	}
+	transport.Password, err = auth.ResolveSecret(c.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.DCOSUID != "" {
+		pem, err := auth.ResolveSecret(c.DCOSPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := auth.ParsePrivateKey([]byte(pem))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid dcos-private-key - %v", err)
+		}
+		loginURL := c.DCOSLoginURL
+		if loginURL == "" {
+			loginURL, err = defaultDCOSLoginURL(c.URI)
+			if err != nil {
+				return nil, err
+			}
+		}
+		transport.Tokens = &auth.DCOSTokenSource{
+			LoginURL:   loginURL,
+			UID:        c.DCOSUID,
+			PrivateKey: privateKey,
+			Client: &http.Client{
+				Transport: transport.Base,
+				Timeout:   (30 * time.Second),
+			},
+		}
+	}
+	return transport, nil
+}
+
+// defaultDCOSLoginURL is the DC/OS IAM login on the host of the first of the uris
+func defaultDCOSLoginURL(uris string) (string, error) {
+	first, err := url.Parse(strings.Split(uris, ",")[0])
+	if err != nil {
+		return "", err
+	}
+	if first.Scheme == "" || first.Host == "" {
+		return "", fmt.Errorf("Expected dcos-login-url to be set, we can't find it from %s", uris)
+	}
+	return first.Scheme + "://" + first.Host + "/acs/api/v1/auth/login", nil
+}
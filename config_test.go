@@ -0,0 +1,465 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/maintenance"
+	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+	"github.com/ashwanthkumar/marathon-alerts/routes"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func testFlags(t *testing.T, args ...string) *flag.FlagSet {
+	flags := flag.NewFlagSet("marathon-alerts", flag.ContinueOnError)
+	defineFlags(flags)
+	err := flags.Parse(args)
+	assert.NoError(t, err)
+	return flags
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "marathon-alerts-config")
+	assert.NoError(t, err)
+	_, err = file.WriteString(content)
+	assert.NoError(t, err)
+	file.Close()
+	return file.Name()
+}
+
+func TestLoadConfigFromFlags(t *testing.T) {
+	flags := testFlags(t, "--uri", "http://marathon:8080", "--slack-webhook", "https://hooks.slack.com/foo")
+	config, err := LoadConfig("", flags)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://marathon:8080", config.Marathon.URI)
+	assert.Equal(t, 60*time.Second, config.Marathon.CheckInterval)
+	assert.Equal(t, 30*time.Minute, config.Alerts.SuppressDuration)
+	assert.Equal(t, RouteTable(routes.DefaultRoutes), config.Alerts.Routes)
+	assert.Equal(t, "https://hooks.slack.com/foo", config.notifier("slack").Webhook)
+	assert.Equal(t, FlapDetection{History: 0, HighThreshold: 50, LowThreshold: 25}, config.Alerts.Flapping)
+	assert.Equal(t, 1, config.Alerts.FailAfter)
+	assert.Equal(t, 1, config.Alerts.ResolveAfter)
+	assert.Equal(t, time.Duration(0), config.Alerts.GroupWindow)
+	assert.Equal(t, GroupByCluster, config.Alerts.GroupBy)
+	assert.Equal(t, DispatchConfig{QueueSize: 100, Timeout: 30 * time.Second, MaxRetries: 3, RetryBackoff: time.Second}, config.Dispatch)
+}
+
+func TestLoadConfigFromYAML(t *testing.T) {
+	path := writeConfigFile(t, `
+marathon:
+  uri: http://marathon:8080
+  check-interval: 15s
+checks:
+  min-healthy:
+    warn-threshold: 0.9
+    critical-threshold: 0.6
+alerts:
+  suppress-duration: 5m
+  routes: "*/critical/oncall"
+notifiers:
+  - name: oncall
+    type: pagerduty
+    routing-key: key
+  - name: audit
+    type: webhook
+    urls: http://audit/alerts
+    headers:
+      X-Token: t0k3n
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path, testFlags(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "http://marathon:8080", config.Marathon.URI)
+	assert.Equal(t, 15*time.Second, config.Marathon.CheckInterval)
+	assert.Equal(t, float32(0.9), config.Checks.MinHealthy.WarnThreshold)
+	assert.Equal(t, float32(0.6), config.Checks.MinHealthy.CriticalThreshold)
+	// Not in the file, so we keep the flag's default
+	assert.Equal(t, float32(0.75), config.Checks.MinInstances.WarnThreshold)
+	assert.Equal(t, 5*time.Minute, config.Alerts.SuppressDuration)
+	assert.Equal(t, RouteTable("*/critical/oncall"), config.Alerts.Routes)
+	assert.Len(t, config.Notifiers, 2)
+	assert.Equal(t, "key", config.Notifiers[0].RoutingKey)
+	assert.Equal(t, map[string]string{"X-Token": "t0k3n"}, config.Notifiers[1].Headers)
+}
+
+func TestLoadConfigWithRoutingTable(t *testing.T) {
+	path := writeConfigFile(t, `
+marathon:
+  uri: http://marathon:8080
+alerts:
+  routes:
+    - "*/critical/oncall?app=/payments/*&stop"
+    - "*/warning/slack"
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path, testFlags(t))
+	assert.NoError(t, err)
+	assert.Equal(t, RouteTable("*/critical/oncall?app=/payments/*&stop;*/warning/slack"), config.Alerts.Routes)
+}
+
+func TestLoadConfigWithEscalations(t *testing.T) {
+	path := writeConfigFile(t, `
+marathon:
+  uri: http://marathon:8080
+alerts:
+  escalation: oncall
+escalations:
+  - name: oncall
+    steps:
+      - notifiers: slack
+        repeat: 15m
+      - after: 30m
+        notifiers: pagerduty
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path, testFlags(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "oncall", config.Alerts.Escalation)
+	assert.Equal(t, map[string]EscalationPolicy{"oncall": testEscalationPolicy()}, config.BuildEscalations())
+}
+
+func TestLoadConfigWithMaintenanceWindows(t *testing.T) {
+	path := writeConfigFile(t, `
+marathon:
+  uri: http://marathon:8080
+maintenance:
+  - name: patching
+    check: min-healthy
+    cron: "0 22 * * 2"
+    duration: 4h
+    time-zone: Asia/Kolkata
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path, testFlags(t))
+	assert.NoError(t, err)
+	assert.Equal(t, []maintenance.Window{
+		maintenance.Window{Name: "patching", CheckName: "min-healthy", Cron: "0 22 * * 2", Duration: 4 * time.Hour, TimeZone: "Asia/Kolkata"},
+	}, config.Maintenance)
+
+	config.Maintenance[0].Duration = 0
+	assert.EqualError(t, config.Validate(), "Expected a positive duration for maintenance window patching but 0s found")
+}
+
+func TestLoadConfigFromJSON(t *testing.T) {
+	path := writeConfigFile(t, `{"marathon": {"uri": "http://marathon:8080", "check-interval": "10s"}, "http-address": ":8000"}`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path, testFlags(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "http://marathon:8080", config.Marathon.URI)
+	assert.Equal(t, 10*time.Second, config.Marathon.CheckInterval)
+	assert.Equal(t, ":8000", config.HTTPAddress)
+}
+
+func TestLoadConfigWithClusters(t *testing.T) {
+	path := writeConfigFile(t, `
+marathon:
+  check-interval: 15s
+clusters:
+  - name: prod
+    uri: http://prod-1:8080,http://prod-2:8080
+    event-stream: true
+    username: alerts
+    password: s3cr3t
+  - name: staging
+    uri: http://staging:8080
+    check-interval: 2m
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path, testFlags(t))
+	assert.NoError(t, err)
+	clusters := config.AllClusters()
+	assert.Len(t, clusters, 2)
+	assert.Equal(t, ClusterConfig{
+		Name:          "prod",
+		URI:           "http://prod-1:8080,http://prod-2:8080",
+		CheckInterval: 15 * time.Second,
+		EventStream:   true,
+		AppLink:       "http://prod-1:8080/ui/#/apps/{{urlquery .App}}",
+		AuthConfig:    AuthConfig{Username: "alerts", Password: "s3cr3t"},
+	}, clusters[0])
+	assert.Equal(t, 2*time.Minute, clusters[1].CheckInterval)
+}
+
+func TestAllClustersWithoutClusters(t *testing.T) {
+	config, err := LoadConfig("", testFlags(t, "--uri", "http://marathon:8080", "--event-stream"))
+	assert.NoError(t, err)
+	clusters := config.AllClusters()
+	assert.Len(t, clusters, 1)
+	assert.Equal(t, ClusterConfig{URI: "http://marathon:8080", CheckInterval: 60 * time.Second, EventStream: true, AppLink: "http://marathon:8080/ui/#/apps/{{urlquery .App}}"}, clusters[0])
+}
+
+func TestAllClustersWithAppLink(t *testing.T) {
+	path := writeConfigFile(t, `
+marathon:
+  app-link: "https://{{.Cluster}}.dcos.example.com/#/services/detail/{{urlquery .App}}"
+clusters:
+  - name: prod
+    uri: http://prod:8080
+  - name: staging
+    uri: http://staging:8080
+    app-link: "http://staging:8080/ui/#/apps/{{urlquery .App}}/configuration"
+`)
+	defer os.Remove(path)
+
+	config, err := LoadConfig(path, testFlags(t))
+	assert.NoError(t, err)
+	clusters := config.AllClusters()
+	assert.Equal(t, "https://{{.Cluster}}.dcos.example.com/#/services/detail/{{urlquery .App}}", clusters[0].AppLink)
+	assert.Equal(t, "http://staging:8080/ui/#/apps/{{urlquery .App}}/configuration", clusters[1].AppLink)
+}
+
+func TestLoadConfigWithMarathonAuthFlags(t *testing.T) {
+	config, err := LoadConfig("", testFlags(t, "--uri", "https://dcos.example.com/service/marathon", "--dcos-uid", "marathon-alerts",
+		"--dcos-private-key", "file:/etc/marathon-alerts/key.pem", "--marathon-ca-cert", "/etc/marathon-alerts/ca.pem"))
+	assert.NoError(t, err)
+	assert.Equal(t, AuthConfig{
+		DCOSUID:        "marathon-alerts",
+		DCOSPrivateKey: "file:/etc/marathon-alerts/key.pem",
+		CACert:         "/etc/marathon-alerts/ca.pem",
+	}, config.AllClusters()[0].AuthConfig)
+}
+
+func TestDefaultDCOSLoginURL(t *testing.T) {
+	loginURL, err := defaultDCOSLoginURL("https://dcos.example.com/service/marathon,https://dcos2.example.com/service/marathon")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dcos.example.com/acs/api/v1/auth/login", loginURL)
+
+	_, err = defaultDCOSLoginURL("marathon:8080")
+	assert.Error(t, err)
+}
+
+func TestLoadConfigFlagsOverrideFile(t *testing.T) {
+	path := writeConfigFile(t, `
+marathon:
+  uri: http://marathon:8080
+  check-interval: 15s
+notifiers:
+  - name: slack
+    type: slack
+    webhook: https://hooks.slack.com/from-file
+    channel: "#ops"
+`)
+	defer os.Remove(path)
+
+	flags := testFlags(t, "--check-interval", "45s", "--slack-webhook", "https://hooks.slack.com/from-flag")
+	config, err := LoadConfig(path, flags)
+	assert.NoError(t, err)
+	assert.Equal(t, 45*time.Second, config.Marathon.CheckInterval)
+	assert.Equal(t, "http://marathon:8080", config.Marathon.URI)
+	assert.Len(t, config.Notifiers, 1)
+	assert.Equal(t, "https://hooks.slack.com/from-flag", config.Notifiers[0].Webhook)
+	assert.Equal(t, "#ops", config.Notifiers[0].Channel)
+}
+
+func TestLoadConfigFailsOnUnknownField(t *testing.T) {
+	path := writeConfigFile(t, `
+marathon:
+  uri: http://marathon:8080
+  check-intervl: 15s
+`)
+	defer os.Remove(path)
+
+	_, err := LoadConfig(path, testFlags(t))
+	assert.Error(t, err)
+}
+
+func TestLoadConfigFailsOnMissingFile(t *testing.T) {
+	_, err := LoadConfig("/non/existent/config.yml", testFlags(t))
+	assert.Error(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := func() *Config {
+		config, err := LoadConfig("", testFlags(t, "--uri", "http://marathon:8080"))
+		assert.NoError(t, err)
+		return config
+	}
+
+	config := valid()
+	config.Marathon.URI = ""
+	assert.EqualError(t, config.Validate(), "Expected marathon.uri (or --uri) or clusters to be set")
+
+	config = valid()
+	config.Clusters = []ClusterConfig{ClusterConfig{Name: "prod", URI: "http://prod:8080"}}
+	assert.EqualError(t, config.Validate(), "Expected either marathon.uri (or --uri) or clusters to be set but found both")
+
+	config = valid()
+	config.Marathon.URI = ""
+	config.Clusters = []ClusterConfig{ClusterConfig{Name: "prod", URI: "http://prod:8080"}, ClusterConfig{Name: "prod", URI: "http://prod2:8080"}}
+	assert.EqualError(t, config.Validate(), "Expected unique cluster names but prod is used more than once")
+
+	config = valid()
+	config.Alerts.GroupBy = "app"
+	assert.EqualError(t, config.Validate(), "Expected alerts.group-by to be one of [cluster group check] but app found")
+
+	config = valid()
+	config.Dispatch.QueueSize = 0
+	assert.EqualError(t, config.Validate(), "Expected a positive dispatch.queue-size but 0 found")
+
+	config = valid()
+	config.Dispatch.MaxRetries = -1
+	assert.EqualError(t, config.Validate(), "Expected a non-negative dispatch.max-retries but -1 found")
+
+	config = valid()
+	config.Alerts.FailAfter = 0
+	assert.EqualError(t, config.Validate(), "Expected alerts.fail-after (0) and alerts.resolve-after (1) to be at least 1")
+
+	config = valid()
+	config.Alerts.Flapping.History = 21
+	config.Alerts.Flapping.LowThreshold = 0
+	assert.EqualError(t, config.Validate(), "Expected 0 < alerts.flapping.low-threshold (0) <= high-threshold (50) <= 100")
+
+	config = valid()
+	config.Marathon.CheckInterval = 0
+	assert.Error(t, config.Validate())
+
+	config = valid()
+	config.Marathon.Username = "alerts"
+	config.Marathon.DCOSUID = "marathon-alerts"
+	assert.EqualError(t, config.Validate(), "Expected either username or dcos-uid for marathon but found both")
+
+	config = valid()
+	config.Marathon.URI = ""
+	config.Clusters = []ClusterConfig{ClusterConfig{Name: "prod", URI: "http://prod:8080", AuthConfig: AuthConfig{DCOSUID: "marathon-alerts"}}}
+	assert.EqualError(t, config.Validate(), "Expected a dcos-private-key for the dcos-uid of cluster prod")
+
+	config = valid()
+	config.Marathon.ClientCert = "client.pem"
+	assert.EqualError(t, config.Validate(), "Expected both client-cert and client-key for marathon or neither")
+
+	config = valid()
+	config.Checks.MinHealthy.CriticalThreshold = 0.9
+	assert.EqualError(t, config.Validate(), "Expected checks.min-healthy critical-threshold (0.9) to be less than or equal to warn-threshold (0.75)")
+
+	config = valid()
+	config.Checks.MinInstances.WarnThreshold = 1.5
+	assert.EqualError(t, config.Validate(), "Expected checks.min-instances thresholds to be between 0 and 1")
+
+	config = valid()
+	config.Checks.DeploymentStuck.CriticalThreshold = 10 * time.Minute
+	assert.EqualError(t, config.Validate(), "Expected checks.deployment-stuck critical-threshold (10m0s) to be greater than or equal to warn-threshold (15m0s)")
+
+	config = valid()
+	config.Checks.TaskFlapping.Window = 0
+	assert.EqualError(t, config.Validate(), "Expected a positive checks.task-flapping.window but 0s found")
+
+	config = valid()
+	config.Alerts.Routes = "min-healthy/critical"
+	assert.Error(t, config.Validate())
+
+	config = valid()
+	config.Notifiers = append(config.Notifiers, NotifierConfig{Name: "slack", Type: "slack"})
+	assert.EqualError(t, config.Validate(), "Expected unique notifier names but slack is used more than once")
+
+	config = valid()
+	config.Alerts.Escalation = "oncall"
+	assert.EqualError(t, config.Validate(), "Expected alerts.escalation to be one of the escalation policies but oncall found")
+
+	config = valid()
+	config.Escalations = []EscalationPolicy{testEscalationPolicy(), testEscalationPolicy()}
+	assert.EqualError(t, config.Validate(), "Expected unique escalation policy names but oncall is used more than once")
+
+	config = valid()
+	config.Notifiers = append(config.Notifiers, NotifierConfig{Name: "sms", Type: "sms"})
+	assert.EqualError(t, config.Validate(), "Expected notifier sms to be of type one of [slack pagerduty webhook email] but sms found")
+
+	config = valid()
+	config.notifier("email").SMTPTLS = "ssl"
+	assert.EqualError(t, config.Validate(), "Expected smtp-tls of notifier email to be one of [starttls tls none] but ssl found")
+
+	config = valid()
+	config.notifier("email").SMTPServer = "smtp.example.com"
+	assert.EqualError(t, config.Validate(), "Expected smtp-server of notifier email to be a host:port but smtp.example.com found")
+
+	config = valid()
+	config.notifier("email").SMTPServer = "smtp.example.com:587"
+	assert.EqualError(t, config.Validate(), "Expected notifier email to have a from address")
+
+	config = valid()
+	config.Notifiers[0].Templates = notifiers.Templates{Title: "{{.Owners"}
+	assert.Error(t, config.Validate())
+
+	config = valid()
+	config.Notifiers[0].Templates = notifiers.Templates{Body: "{{.Instances}}"}
+	assert.Error(t, config.Validate())
+
+	config = valid()
+	config.Notifiers = append(config.Notifiers, NotifierConfig{Name: "audit", Type: "webhook", Templates: notifiers.Templates{Title: "{{.App}}"}})
+	assert.EqualError(t, config.Validate(), "Expected templates only on slack, pagerduty or email notifiers but audit is a webhook")
+
+	config = valid()
+	config.Marathon.AppLink = "{{.Application}}"
+	assert.Error(t, config.Validate())
+
+	config = valid()
+	config.Alerts.Runbook = "https://wiki.example.com/{{.CheckName"
+	assert.Error(t, config.Validate())
+}
+
+func TestBuildChecksUsesTheirOwnThresholds(t *testing.T) {
+	config, err := LoadConfig("", testFlags(t, "--uri", "http://marathon:8080", "--check-min-instances-warn-threshold", "0.6"))
+	assert.NoError(t, err)
+	allChecks := config.BuildChecks(new(MockMarathon))
+	assert.Len(t, allChecks, 5)
+	assert.Equal(t, float32(0.75), allChecks[0].(*checks.MinHealthyTasks).DefaultWarningThreshold)
+	assert.Equal(t, float32(0.6), allChecks[1].(*checks.MinInstances).DefaultWarningThreshold)
+	assert.Equal(t, 15*time.Minute, allChecks[3].(*checks.DeploymentStuck).DefaultWarningThreshold)
+	assert.Equal(t, 30*time.Minute, allChecks[3].(*checks.DeploymentStuck).DefaultCriticalThreshold)
+	assert.Equal(t, 10*time.Minute, allChecks[4].(*checks.TaskFlapping).DefaultWindow)
+	assert.Equal(t, 3, allChecks[4].(*checks.TaskFlapping).DefaultWarningThreshold)
+}
+
+func TestBuildNotifiersWithNames(t *testing.T) {
+	config := &Config{
+		Notifiers: []NotifierConfig{
+			NotifierConfig{Name: "team-a", Type: "slack", Webhook: "https://hooks.slack.com/a"},
+			NotifierConfig{Name: "team-b", Type: "slack", Webhook: "https://hooks.slack.com/b"},
+			NotifierConfig{Name: "oncall", Type: "pagerduty", RoutingKey: "key"},
+			NotifierConfig{Name: "audit", Type: "webhook", URLs: "http://audit"},
+			NotifierConfig{Name: "team-a-email", Type: "email", SMTPServer: "smtp.example.com:587", From: "alerts@example.com", To: "team-a@example.com"},
+		},
+	}
+	allNotifiers := config.BuildNotifiers()
+	assert.Len(t, allNotifiers, 5)
+	assert.Equal(t, "team-a", allNotifiers[0].Name())
+	assert.Equal(t, "https://hooks.slack.com/a", allNotifiers[0].(*notifiers.Slack).Webhook)
+	assert.Equal(t, "team-b", allNotifiers[1].Name())
+	assert.Equal(t, "oncall", allNotifiers[2].Name())
+	assert.Equal(t, "key", allNotifiers[2].(*notifiers.PagerDuty).RoutingKey)
+	assert.Equal(t, "audit", allNotifiers[3].Name())
+	assert.Equal(t, "http://audit", allNotifiers[3].(*notifiers.Webhook).URLs)
+	assert.Equal(t, "team-a-email", allNotifiers[4].Name())
+	assert.Equal(t, "team-a@example.com", allNotifiers[4].(*notifiers.Email).To)
+}
+
+func TestLoadConfigWithWebhookHeadersThatHaveCommas(t *testing.T) {
+	config, err := LoadConfig("", testFlags(t, "--uri", "http://marathon:8080", "--webhook-url", "http://audit",
+		"--webhook-header", "Accept: application/json, text/plain", "--webhook-header", "X-Team: payments"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Accept": "application/json, text/plain", "X-Team": "payments"}, config.notifier("webhook").Headers)
+
+	config, err = LoadConfig("", testFlags(t, "--uri", "http://marathon:8080"))
+	assert.NoError(t, err)
+	assert.Len(t, config.notifier("webhook").Headers, 0)
+}
+
+func TestLoadConfigWithEmailFlags(t *testing.T) {
+	config, err := LoadConfig("", testFlags(t, "--uri", "http://marathon:8080", "--email-smtp-server", "smtp.example.com:465",
+		"--email-smtp-tls", "tls", "--email-from", "alerts@example.com", "--email-to", "ops@example.com"))
+	assert.NoError(t, err)
+	email := config.notifier("email")
+	assert.Equal(t, "smtp.example.com:465", email.SMTPServer)
+	assert.Equal(t, notifiers.EmailTLSImplicit, email.SMTPTLS)
+	assert.Equal(t, "alerts@example.com", email.From)
+	assert.Equal(t, "ops@example.com", email.To)
+}
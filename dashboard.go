@@ -0,0 +1,232 @@
+package main
+
+import (
+	"html/template"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/maintenance"
+)
+
+// dashboard is what the dashboard shows, as of Now
+type dashboard struct {
+	Now         time.Time
+	Clusters    []AppCheckerStatus
+	OpenAlerts  []CheckState // most severe and oldest first
+	Groups      []dashboardGroup
+	Snoozes     []Snooze
+	Maintenance []dashboardWindow
+}
+
+// dashboardGroup is a Marathon group of a cluster, with the checks of its apps
+type dashboardGroup struct {
+	Cluster string
+	Name    string
+	Apps    []dashboardApp
+}
+
+type dashboardApp struct {
+	ID     string
+	Checks []CheckState
+}
+
+type dashboardWindow struct {
+	maintenance.Window
+	Active bool
+}
+
+// newDashboard groups the states by cluster, Marathon group and app. The states are
+// expected to be sorted by cluster, app and check like CheckStates returns them.
+func newDashboard(now time.Time, states []CheckState, clusters []AppCheckerStatus, snoozes []Snooze, windows []maintenance.Window) dashboard {
+	d := dashboard{Now: now, Clusters: clusters, Snoozes: snoozes}
+	groups := make(map[string]*dashboardGroup)
+	var groupKeys []string
+	for _, state := range states {
+		if state.Alert != checks.Pass {
+			d.OpenAlerts = append(d.OpenAlerts, state)
+		}
+		groupKey := state.Cluster + ":" + path.Dir(state.App)
+		group, present := groups[groupKey]
+		if !present {
+			group = &dashboardGroup{Cluster: state.Cluster, Name: path.Dir(state.App)}
+			groups[groupKey] = group
+			groupKeys = append(groupKeys, groupKey)
+		}
+		if len(group.Apps) == 0 || group.Apps[len(group.Apps)-1].ID != state.App {
+			group.Apps = append(group.Apps, dashboardApp{ID: state.App})
+		}
+		app := &group.Apps[len(group.Apps)-1]
+		app.Checks = append(app.Checks, state)
+	}
+	sort.Strings(groupKeys)
+	for _, groupKey := range groupKeys {
+		d.Groups = append(d.Groups, *groups[groupKey])
+	}
+	sort.Stable(alertsBySeverity(d.OpenAlerts))
+	for _, window := range windows {
+		d.Maintenance = append(d.Maintenance, dashboardWindow{Window: window, Active: window.IsActive(now)})
+	}
+	return d
+}
+
+type alertsBySeverity []CheckState
+
+func (a alertsBySeverity) Len() int      { return len(a) }
+func (a alertsBySeverity) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a alertsBySeverity) Less(i, j int) bool {
+	// Critical is 1 and Warning is 2
+	if a[i].Alert != a[j].Alert {
+		return a[i].Alert < a[j].Alert
+	}
+	return a[i].Since.Before(a[j].Since)
+}
+
+// age is how long ago t was, to the second
+func age(now, t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return (now.Sub(t) / time.Second * time.Second).String()
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"status": checks.CheckStatusToString,
+	"statusClass": func(status checks.CheckStatus) string {
+		return strings.ToLower(checks.CheckStatusToString(status))
+	},
+	"age": age,
+}).Parse(dashboardHTML))
+
+// dashboardHTML has no external dependencies, the buttons call the JSON API
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>marathon-alerts</title>
+<style>
+body { font-family: sans-serif; margin: 20px; color: #333; }
+h2 { border-bottom: 1px solid #ddd; padding-bottom: 4px; }
+table { border-collapse: collapse; margin-bottom: 16px; }
+th, td { text-align: left; padding: 4px 10px; border-bottom: 1px solid #eee; }
+.check { display: inline-block; padding: 2px 6px; margin: 2px; border-radius: 3px; color: #fff; }
+.passed, .resolved { background: #2e7d32; }
+.warning { background: #ef6c00; }
+.critical { background: #c62828; }
+.muted { color: #999; }
+button { font-size: 0.8em; }
+</style>
+</head>
+<body>
+<h1>marathon-alerts</h1>
+<p class="muted">As of {{.Now.Format "2006-01-02 15:04:05 MST"}}, refreshes every 30s.
+{{range .Clusters}} {{if .Cluster}}{{.Cluster}} - {{end}}{{.Apps}} apps checked {{age $.Now .LastChecked}} ago{{if .Streaming}} (event stream){{end}}.{{end}}</p>
+
+<h2>Open Alerts</h2>
+{{if .OpenAlerts}}
+<table>
+<tr><th>Alert</th><th>App</th><th>Check</th><th>Message</th><th>Since</th><th>Times</th><th></th></tr>
+{{range .OpenAlerts}}
+<tr>
+<td><span class="check {{statusClass .Alert}}">{{status .Alert}}</span></td>
+<td>{{if .Link}}<a href="{{.Link}}">{{if .Cluster}}{{.Cluster}}:{{end}}{{.App}}</a>{{else}}{{if .Cluster}}{{.Cluster}}:{{end}}{{.App}}{{end}}</td>
+<td>{{.CheckName}}</td>
+<td>{{.Message}}</td>
+<td>{{age $.Now .Since}}</td>
+<td>{{.Times}}</td>
+<td>{{if .Ack}}Acked by {{.Ack.By}}{{if .Ack.Comment}} - {{.Ack.Comment}}{{end}}{{else}}<button data-cluster="{{.Cluster}}" data-app="{{.App}}" data-check="{{.CheckName}}" onclick="ack(this)">Ack</button>{{end}}
+{{if .Snoozed}}Snoozed{{else}}<button data-cluster="{{.Cluster}}" data-app="{{.App}}" data-check="{{.CheckName}}" onclick="snooze(this)">Snooze</button>{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>Nothing is broken.</p>
+{{end}}
+
+<h2>Apps</h2>
+{{range .Groups}}
+<h3>{{if .Cluster}}{{.Cluster}}:{{end}}{{.Name}}</h3>
+<table>
+{{range .Apps}}
+<tr>
+<td>{{.ID}}</td>
+<td>{{range .Checks}}<span class="check {{statusClass .Result}}" title="{{.Message}}">{{.CheckName}}</span>{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p class="muted">No apps checked yet.</p>
+{{end}}
+
+<h2>Snoozes</h2>
+{{if .Snoozes}}
+<table>
+<tr><th>Cluster</th><th>App</th><th>Check</th><th>Until</th><th>Reason</th><th>By</th><th></th></tr>
+{{range .Snoozes}}
+<tr>
+<td>{{or .Cluster "*"}}</td><td>{{or .App "*"}}</td><td>{{or .CheckName "*"}}</td>
+<td>{{.Until.Format "2006-01-02 15:04 MST"}}</td><td>{{.Reason}}</td><td>{{.Author}}</td>
+<td><button data-id="{{.ID}}" onclick="cancelSnooze(this)">Cancel</button></td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p class="muted">No active snoozes.</p>
+{{end}}
+
+<h2>Maintenance Windows</h2>
+{{if .Maintenance}}
+<table>
+<tr><th>Name</th><th>Cluster</th><th>App</th><th>Group</th><th>Check</th><th>When</th><th></th></tr>
+{{range .Maintenance}}
+<tr>
+<td>{{.Name}}</td><td>{{or .Cluster "*"}}</td><td>{{or .App "*"}}</td><td>{{or .Group "*"}}</td><td>{{or .CheckName "*"}}</td>
+<td>{{if .Cron}}{{.Cron}} for {{.Duration}} {{.TimeZone}}{{else}}{{.Start.Format "2006-01-02 15:04 MST"}} - {{.End.Format "2006-01-02 15:04 MST"}}{{end}}</td>
+<td>{{if .Active}}<span class="check warning">Active</span>{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p class="muted">No maintenance windows.</p>
+{{end}}
+
+<script>
+function request(method, url, body) {
+  var xhr = new XMLHttpRequest();
+  xhr.open(method, url);
+  xhr.setRequestHeader("Content-Type", "application/json");
+  xhr.onload = function() {
+    if (xhr.status >= 300) {
+      alert(JSON.parse(xhr.responseText).error);
+    }
+    location.reload();
+  };
+  xhr.send(body ? JSON.stringify(body) : null);
+}
+function ack(button) {
+  var user = prompt("Who is acking " + button.dataset.check + " on " + button.dataset.app + "?");
+  if (!user) { return; }
+  var comment = prompt("What are you doing about it?") || "";
+  request("POST", "api/acks", {cluster: button.dataset.cluster, app: button.dataset.app, check: button.dataset.check, user: user, comment: comment});
+}
+function snooze(button) {
+  var duration = prompt("Snooze " + button.dataset.check + " on " + button.dataset.app + " for how long? Like 30m or 2h", "1h");
+  if (!duration) { return; }
+  var reason = prompt("Why?");
+  if (!reason) { return; }
+  var author = prompt("Who are you?");
+  if (!author) { return; }
+  request("POST", "api/snoozes", {cluster: button.dataset.cluster, app: button.dataset.app, check: button.dataset.check, duration: duration, reason: reason, author: author});
+}
+function cancelSnooze(button) {
+  if (confirm("Cancel the snooze?")) {
+    request("DELETE", "api/snoozes/" + button.dataset.id);
+  }
+}
+</script>
+</body>
+</html>
+`
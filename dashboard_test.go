@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/maintenance"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDashboardGroupsAppsAndSortsOpenAlerts(t *testing.T) {
+	now := time.Now()
+	states := []CheckState{
+		CheckState{AppCheck: checks.AppCheck{App: "/payments/api", CheckName: "min-healthy", Result: checks.Warning}, Alert: checks.Warning, Since: now.Add(-time.Hour)},
+		CheckState{AppCheck: checks.AppCheck{App: "/payments/api", CheckName: "min-instances", Result: checks.Critical}, Alert: checks.Critical, Since: now.Add(-time.Minute)},
+		CheckState{AppCheck: checks.AppCheck{App: "/payments/web", CheckName: "min-healthy", Result: checks.Critical}, Alert: checks.Critical, Since: now.Add(-time.Hour)},
+		CheckState{AppCheck: checks.AppCheck{App: "/search", CheckName: "min-healthy", Result: checks.Pass}, Alert: checks.Pass},
+	}
+	windows := []maintenance.Window{maintenance.Window{Name: "upgrade", Start: now.Add(-time.Minute), End: now.Add(time.Hour)}}
+
+	d := newDashboard(now, states, nil, nil, windows)
+	assert.Len(t, d.Groups, 2)
+	assert.Equal(t, "/", d.Groups[0].Name)
+	assert.Equal(t, "/search", d.Groups[0].Apps[0].ID)
+	assert.Equal(t, "/payments", d.Groups[1].Name)
+	assert.Len(t, d.Groups[1].Apps, 2)
+	assert.Len(t, d.Groups[1].Apps[0].Checks, 2)
+
+	assert.Len(t, d.OpenAlerts, 3)
+	assert.Equal(t, "/payments/web", d.OpenAlerts[0].App)
+	assert.Equal(t, "min-instances", d.OpenAlerts[1].CheckName)
+	assert.Equal(t, checks.Warning, d.OpenAlerts[2].Alert)
+	assert.True(t, d.Maintenance[0].Active)
+}
+
+func TestAge(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, "1m30s", age(now, now.Add(-90*time.Second-300*time.Millisecond)))
+	assert.Equal(t, "-", age(now, time.Time{}))
+}
@@ -0,0 +1,87 @@
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+)
+
+// Letter is a notification we gave up on, it has either a Check or a Digest. The
+// Destination is set when it was for one of the destinations of the notifier only.
+type Letter struct {
+	Notifier    string            `json:"notifier"`
+	Destination string            `json:"destination,omitempty"`
+	Check       *checks.AppCheck  `json:"check,omitempty"`
+	Digest      *notifiers.Digest `json:"digest,omitempty"`
+	Error       string            `json:"error"`
+	Attempts    int               `json:"attempts"`
+	FailedAt    time.Time         `json:"failedAt"`
+}
+
+// Log keeps the Letters as JSON, one per line, in a local file. The file is opened
+// for every Append, so it can be taken away while we're running.
+type Log struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+func (l *Log) Append(letter Letter) error {
+	content, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	file, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(content, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Take moves the log out of the way and returns the Letters that were in it, none if
+// there's no log. Letters appended meanwhile go to a new log, so they're never lost.
+func (l *Log) Take() ([]Letter, error) {
+	taken := fmt.Sprintf("%s.%d", l.Path, time.Now().UnixNano())
+	err := os.Rename(l.Path, taken)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(taken)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var letters []Letter
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var letter Letter
+		err = json.Unmarshal(scanner.Bytes(), &letter)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse line %d of %s, it's left there - %v", line, taken, err)
+		}
+		letters = append(letters, letter)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read %s, it's left there - %v", taken, err)
+	}
+	return letters, os.Remove(taken)
+}
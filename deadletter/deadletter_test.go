@@ -0,0 +1,66 @@
+package deadletter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+	"github.com/stretchr/testify/assert"
+)
+
+func tempLog(t *testing.T) (*Log, func()) {
+	dir, err := ioutil.TempDir("", "marathon-alerts-dead-letters")
+	assert.NoError(t, err)
+	return &Log{Path: filepath.Join(dir, "dead-letters.json")}, func() { os.RemoveAll(dir) }
+}
+
+func TestLogTakeWhenNothingWasAppended(t *testing.T) {
+	log, cleanup := tempLog(t)
+	defer cleanup()
+
+	letters, err := log.Take()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 0)
+}
+
+func TestLogAppendAndTake(t *testing.T) {
+	log, cleanup := tempLog(t)
+	defer cleanup()
+
+	failedAt := time.Date(2016, 3, 10, 15, 36, 4, 0, time.UTC)
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical, Times: 1}
+	letter := Letter{Notifier: "slack", Check: &check, Error: "Got 500", Attempts: 4, FailedAt: failedAt}
+	digest := Letter{
+		Notifier: "slack",
+		Digest:   &notifiers.Digest{GroupBy: "cluster", Group: "prod", Checks: []checks.AppCheck{check, check}},
+		Error:    "Timed out",
+		Attempts: 4,
+		FailedAt: failedAt,
+	}
+	assert.NoError(t, log.Append(letter))
+	assert.NoError(t, log.Append(digest))
+
+	letters, err := log.Take()
+	assert.NoError(t, err)
+	assert.Equal(t, []Letter{letter, digest}, letters)
+
+	// The log is gone once it's taken
+	letters, err = log.Take()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 0)
+}
+
+func TestLogTakeLeavesACorruptLogAlone(t *testing.T) {
+	log, cleanup := tempLog(t)
+	defer cleanup()
+
+	assert.NoError(t, ioutil.WriteFile(log.Path, []byte("{not json\n"), 0644))
+	_, err := log.Take()
+	assert.Error(t, err)
+	taken, _ := filepath.Glob(log.Path + ".*")
+	assert.Len(t, taken, 1)
+}
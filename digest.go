@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+)
+
+// What the notifications within a group window can be grouped by
+const (
+	GroupByCluster = "cluster"
+	GroupByGroup   = "group"
+	GroupByCheck   = "check"
+)
+
+var GroupByOptions = []string{GroupByCluster, GroupByGroup, GroupByCheck}
+
+// pendingDigest is a digest still collecting checks, it's sent once it's due
+type pendingDigest struct {
+	notifier notifiers.DigestNotifier
+	digest   notifiers.Digest
+	due      time.Time
+}
+
+// add adds the check to the digest, replacing the earlier one of the same app and check
+func (p *pendingDigest) add(check checks.AppCheck) {
+	for i, existing := range p.digest.Checks {
+		if existing.Cluster == check.Cluster && existing.App == check.App && existing.CheckName == check.CheckName {
+			p.digest.Checks[i] = check
+			return
+		}
+	}
+	p.digest.Checks = append(p.digest.Checks, check)
+}
+
+// groupOf returns what the check is grouped on, the Marathon group for group is the
+// parent of the app ID, like /payments for /payments/api
+func groupOf(check checks.AppCheck, groupBy string) string {
+	switch groupBy {
+	case GroupByGroup:
+		return path.Dir(check.App)
+	case GroupByCheck:
+		return check.CheckName
+	default:
+		return check.Cluster
+	}
+}
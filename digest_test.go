@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupOf(t *testing.T) {
+	check := checks.AppCheck{Cluster: "prod", App: "/payments/api", CheckName: "min-healthy"}
+	assert.Equal(t, "prod", groupOf(check, GroupByCluster))
+	assert.Equal(t, "/payments", groupOf(check, GroupByGroup))
+	assert.Equal(t, "min-healthy", groupOf(check, GroupByCheck))
+	assert.Equal(t, "/", groupOf(checks.AppCheck{App: "/foo"}, GroupByGroup))
+}
+
+func TestPendingDigestKeepsTheLatestOfEveryAppAndCheck(t *testing.T) {
+	pending := pendingDigest{}
+	pending.add(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Warning})
+	pending.add(checks.AppCheck{App: "/bar", CheckName: "min-healthy", Result: checks.Critical})
+	pending.add(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical})
+	assert.Equal(t, []checks.AppCheck{
+		checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical},
+		checks.AppCheck{App: "/bar", CheckName: "min-healthy", Result: checks.Critical},
+	}, pending.digest.Checks)
+}
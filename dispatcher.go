@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/deadletter"
+	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	DefaultDispatchQueueSize    = 100
+	DefaultDispatchTimeout      = 30 * time.Second
+	DefaultDispatchRetryBackoff = 1 * time.Second
+)
+
+// notification is a check, or a digest of checks, to send to a notifier. The
+// destination is set when it goes to one of the destinations of the notifier only.
+type notification struct {
+	notifier    notifiers.Notifier
+	check       *checks.AppCheck
+	digest      *notifiers.Digest
+	destination string
+}
+
+func (n notification) send() error {
+	if n.digest != nil {
+		digestNotifier, takesDigests := n.notifier.(notifiers.DigestNotifier)
+		if !takesDigests {
+			return fmt.Errorf("Notifier %s doesn't take digests", n.notifier.Name())
+		}
+		if n.destination == "" {
+			return digestNotifier.NotifyDigest(*n.digest)
+		}
+		destinationNotifier, hasDestinations := n.notifier.(notifiers.DigestDestinationNotifier)
+		if !hasDestinations {
+			return fmt.Errorf("Notifier %s doesn't have destinations", n.notifier.Name())
+		}
+		return destinationNotifier.NotifyDigestDestination(*n.digest, n.destination)
+	}
+	if n.destination == "" {
+		return n.notifier.Notify(*n.check)
+	}
+	destinationNotifier, hasDestinations := n.notifier.(notifiers.DestinationNotifier)
+	if !hasDestinations {
+		return fmt.Errorf("Notifier %s doesn't have destinations", n.notifier.Name())
+	}
+	return destinationNotifier.NotifyDestination(*n.check, n.destination)
+}
+
+// perDestination splits the notification into one for every destination of the
+// notifier, when it has them
+func (n notification) perDestination() []notification {
+	if n.destination != "" {
+		return []notification{n}
+	}
+	var destinations []string
+	if n.digest != nil {
+		destinationNotifier, hasDestinations := n.notifier.(notifiers.DigestDestinationNotifier)
+		if !hasDestinations {
+			return []notification{n}
+		}
+		destinations = destinationNotifier.DigestDestinations(*n.digest)
+	} else {
+		destinationNotifier, hasDestinations := n.notifier.(notifiers.DestinationNotifier)
+		if !hasDestinations {
+			return []notification{n}
+		}
+		destinations = destinationNotifier.Destinations(*n.check)
+	}
+	var split []notification
+	for _, destination := range destinations {
+		n.destination = destination
+		split = append(split, n)
+	}
+	return split
+}
+
+// Dispatcher sends the notifications of every notifier from a queue of its own, so a
+// slow notifier holds up neither the AlertManager nor the other notifiers. Every
+// attempt is given up on after Timeout, and failed ones are retried MaxRetries times
+// with an exponential backoff, unless the error is permanent. A notification to a
+// notifier with many destinations, like the URLs of a webhook, is sent and retried to
+// every destination on its own. Notifications that still fail, or don't fit in the
+// queue, are written to the DeadLetters (when set) to be replayed later.
+type Dispatcher struct {
+	QueueSize    int // per notifier, defaults to DefaultDispatchQueueSize
+	Timeout      time.Duration
+	MaxRetries   int
+	RetryBackoff time.Duration
+	DeadLetters  *deadletter.Log // optional, failed notifications are only logged without it
+	queues       map[string]chan notification
+	workers      sync.WaitGroup
+	mutex        sync.Mutex
+	closed       bool
+}
+
+// Dispatch queues the notification without waiting for it to be sent
+func (d *Dispatcher) Dispatch(n notification) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, split := range n.perDestination() {
+		d.enqueue(split)
+	}
+}
+
+// enqueue queues the notification to its notifier. Callers should hold mutex.
+func (d *Dispatcher) enqueue(n notification) {
+	if d.closed {
+		d.giveUp(n, fmt.Errorf("Dispatcher is closed"), 0)
+		return
+	}
+	if d.queues == nil {
+		d.queues = make(map[string]chan notification)
+	}
+	queue, present := d.queues[n.notifier.Name()]
+	if !present {
+		queueSize := d.QueueSize
+		if queueSize <= 0 {
+			queueSize = DefaultDispatchQueueSize
+		}
+		queue = make(chan notification, queueSize)
+		d.queues[n.notifier.Name()] = queue
+		d.workers.Add(1)
+		go d.work(queue)
+	}
+	select {
+	case queue <- n:
+	default:
+		metrics.GetOrRegisterCounter("notifications-queue-full", nil).Inc(int64(1))
+		d.giveUp(n, fmt.Errorf("Queue of %s is full", n.notifier.Name()), 0)
+	}
+}
+
+// Close waits for the queued notifications to be sent, including their retries
+func (d *Dispatcher) Close() {
+	d.mutex.Lock()
+	d.closed = true
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.mutex.Unlock()
+	d.workers.Wait()
+}
+
+func (d *Dispatcher) work(queue chan notification) {
+	defer d.workers.Done()
+	for n := range queue {
+		d.deliver(n)
+	}
+}
+
+func (d *Dispatcher) deliver(n notification) {
+	backoff := d.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultDispatchRetryBackoff
+	}
+	var err error
+	attempts := 0
+	for attempts <= d.MaxRetries {
+		if attempts > 0 {
+			metrics.GetOrRegisterCounter("notifications-retried", nil).Inc(int64(1))
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		attempts++
+		started := time.Now()
+		err = d.attempt(n)
+		metrics.GetOrRegisterTimer("notifier-"+n.notifier.Name()+"-latency", DebugMetricsRegistry).UpdateSince(started)
+		if err == nil {
+			metrics.GetOrRegisterCounter("notifications-delivered", nil).Inc(int64(1))
+			return
+		}
+		log.Printf("Error - Attempt %d of %d to notify %s failed - %v\n", attempts, d.MaxRetries+1, n.notifier.Name(), err)
+		if notifiers.IsPermanent(err) {
+			break
+		}
+	}
+	d.giveUp(n, err, attempts)
+}
+
+// attempt sends the notification once, giving up after Timeout. The notifier is left
+// to finish on its own when it times out, they've timeouts of their own.
+func (d *Dispatcher) attempt(n notification) error {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDispatchTimeout
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- n.send()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		metrics.GetOrRegisterCounter("notifications-timed-out", nil).Inc(int64(1))
+		return fmt.Errorf("Timed out after %v", timeout)
+	}
+}
+
+// giveUp writes the notification to the DeadLetters
+func (d *Dispatcher) giveUp(n notification, err error, attempts int) {
+	metrics.GetOrRegisterCounter("notifications-failed", nil).Inc(int64(1))
+	if d.DeadLetters == nil {
+		log.Printf("Error - Gave up on notifying %s - %v\n", n.notifier.Name(), err)
+		return
+	}
+	letterErr := d.DeadLetters.Append(deadletter.Letter{
+		Notifier:    n.notifier.Name(),
+		Destination: n.destination,
+		Check:       n.check,
+		Digest:      n.digest,
+		Error:       err.Error(),
+		Attempts:    attempts,
+		FailedAt:    time.Now(),
+	})
+	if letterErr != nil {
+		log.Printf("Error - Unable to write the notification to %s, it's lost - %v\n", d.DeadLetters.Path, letterErr)
+		return
+	}
+	metrics.GetOrRegisterCounter("notifications-dead-lettered", nil).Inc(int64(1))
+	log.Printf("Error - Gave up on notifying %s, wrote it to %s - %v\n", n.notifier.Name(), d.DeadLetters.Path, err)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/deadletter"
+	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func testDeadLetters(t *testing.T) *deadletter.Log {
+	dir, err := ioutil.TempDir("", "marathon-alerts-dead-letters")
+	assert.NoError(t, err)
+	return &deadletter.Log{Path: dir + "/dead-letters"}
+}
+
+func TestDispatcherRetriesFailedNotifications(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("slack")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(errors.New("Slack is down")).Once()
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	deadLetters := testDeadLetters(t)
+	defer os.RemoveAll(path.Dir(deadLetters.Path))
+	dispatcher := Dispatcher{MaxRetries: 2, RetryBackoff: time.Millisecond, DeadLetters: deadLetters}
+
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical}
+	dispatcher.Dispatch(notification{notifier: mockNotifier, check: &check})
+	dispatcher.Close()
+
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 2)
+	letters, err := deadLetters.Take()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 0)
+}
+
+func TestDispatcherDeadLettersNotificationsThatKeepFailing(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("slack")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(errors.New("Slack is down"))
+	deadLetters := testDeadLetters(t)
+	defer os.RemoveAll(path.Dir(deadLetters.Path))
+	dispatcher := Dispatcher{MaxRetries: 2, RetryBackoff: time.Millisecond, DeadLetters: deadLetters}
+
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical}
+	dispatcher.Dispatch(notification{notifier: mockNotifier, check: &check})
+	dispatcher.Close()
+
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 3)
+	letters, err := deadLetters.Take()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "slack", letters[0].Notifier)
+	assert.Equal(t, "/foo", letters[0].Check.App)
+	assert.Equal(t, "Slack is down", letters[0].Error)
+	assert.Equal(t, 3, letters[0].Attempts)
+}
+
+func TestDispatcherTimesOutSlowNotifiers(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("slack")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil).Run(func(mock.Arguments) {
+		time.Sleep(time.Second)
+	})
+	deadLetters := testDeadLetters(t)
+	defer os.RemoveAll(path.Dir(deadLetters.Path))
+	dispatcher := Dispatcher{Timeout: 10 * time.Millisecond, DeadLetters: deadLetters}
+
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical}
+	dispatcher.Dispatch(notification{notifier: mockNotifier, check: &check})
+	dispatcher.Close()
+
+	letters, err := deadLetters.Take()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "Timed out after 10ms", letters[0].Error)
+}
+
+func TestDispatcherDeadLettersOnceClosed(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("slack")
+	deadLetters := testDeadLetters(t)
+	defer os.RemoveAll(path.Dir(deadLetters.Path))
+	dispatcher := Dispatcher{DeadLetters: deadLetters}
+	dispatcher.Close()
+
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical}
+	dispatcher.Dispatch(notification{notifier: mockNotifier, check: &check})
+
+	mockNotifier.AssertNotCalled(t, "Notify", mock.AnythingOfType("AppCheck"))
+	letters, err := deadLetters.Take()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "Dispatcher is closed", letters[0].Error)
+}
+
+func TestDispatcherRetriesOnlyTheWebhookURLsThatFailed(t *testing.T) {
+	var mutex sync.Mutex
+	posts := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		posts[r.URL.Path]++
+		if r.URL.Path == "/flaky" && posts[r.URL.Path] == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	deadLetters := testDeadLetters(t)
+	defer os.RemoveAll(path.Dir(deadLetters.Path))
+	dispatcher := Dispatcher{MaxRetries: 2, RetryBackoff: time.Millisecond, DeadLetters: deadLetters}
+
+	webhook := &notifiers.Webhook{URLs: server.URL + "/ok," + server.URL + "/flaky"}
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical}
+	dispatcher.Dispatch(notification{notifier: webhook, check: &check})
+	dispatcher.Close()
+
+	assert.Equal(t, map[string]int{"/ok": 1, "/flaky": 2}, posts)
+	letters, err := deadLetters.Take()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 0)
+}
+
+func TestDispatcherDoesNotRetryPermanentFailures(t *testing.T) {
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	deadLetters := testDeadLetters(t)
+	defer os.RemoveAll(path.Dir(deadLetters.Path))
+	dispatcher := Dispatcher{MaxRetries: 2, RetryBackoff: time.Millisecond, DeadLetters: deadLetters}
+
+	webhook := &notifiers.Webhook{URLs: server.URL + "/gone"}
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical}
+	dispatcher.Dispatch(notification{notifier: webhook, check: &check})
+	dispatcher.Close()
+
+	assert.Equal(t, 1, posts)
+	letters, err := deadLetters.Take()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, server.URL+"/gone", letters[0].Destination)
+	assert.Equal(t, 1, letters[0].Attempts)
+	assert.Equal(t, "Got 404 from "+server.URL+"/gone", letters[0].Error)
+}
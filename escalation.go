@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ryanuber/go-glob"
+)
+
+const AppEscalationLabel = "alerts.escalation"
+
+// EscalationPolicy decides who is notified of an open alert and how often, as long as
+// it stays at the same level. Apps pick a policy by name with the alerts.escalation
+// label. Notifications still go only to the notifiers the routes allow.
+type EscalationPolicy struct {
+	Name  string           `yaml:"name"`
+	Steps []EscalationStep `yaml:"steps"`
+}
+
+// EscalationStep notifies the Notifiers (comma list of globs on the notifier names)
+// once the alert has been open for After, and then every Repeat if it's set
+type EscalationStep struct {
+	After     time.Duration `yaml:"after"`
+	Notifiers string        `yaml:"notifiers"`
+	Repeat    time.Duration `yaml:"repeat"`
+}
+
+func (p *EscalationPolicy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("Expected every escalation policy to have a name")
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("Expected escalation policy %s to have at least one step", p.Name)
+	}
+	for _, step := range p.Steps {
+		if step.After < 0 || step.Repeat < 0 {
+			return fmt.Errorf("Expected non-negative after and repeat in escalation policy %s", p.Name)
+		}
+		if step.Notifiers == "" {
+			return fmt.Errorf("Expected every step of escalation policy %s to have notifiers", p.Name)
+		}
+	}
+	return nil
+}
+
+// Immediate returns the notifiers to notify as soon as an alert is opened
+func (p *EscalationPolicy) Immediate() []string {
+	var notifierPatterns []string
+	for _, step := range p.Steps {
+		if step.After == 0 {
+			notifierPatterns = append(notifierPatterns, step.notifierPatterns()...)
+		}
+	}
+	return notifierPatterns
+}
+
+// Reached returns the notifiers of the steps that have been notified by now for an
+// alert opened on openedOn, they're the ones who should hear it's resolved
+func (p *EscalationPolicy) Reached(openedOn, now time.Time) []string {
+	var notifierPatterns []string
+	for _, step := range p.Steps {
+		if !openedOn.Add(step.After).After(now) {
+			notifierPatterns = append(notifierPatterns, step.notifierPatterns()...)
+		}
+	}
+	return notifierPatterns
+}
+
+// Due returns the notifiers of the steps that are due to notify in (since, now] for
+// an alert opened on openedOn. The notifications on openedOn itself are left to
+// Immediate.
+func (p *EscalationPolicy) Due(openedOn, since, now time.Time) []string {
+	if since.Before(openedOn) {
+		since = openedOn
+	}
+	var notifierPatterns []string
+	for _, step := range p.Steps {
+		next := openedOn.Add(step.After)
+		if !next.After(since) {
+			if step.Repeat <= 0 {
+				continue
+			}
+			repeats := int64(since.Sub(next)/step.Repeat) + 1
+			next = next.Add(time.Duration(repeats) * step.Repeat)
+		}
+		if !next.After(now) {
+			notifierPatterns = append(notifierPatterns, step.notifierPatterns()...)
+		}
+	}
+	return notifierPatterns
+}
+
+func (s *EscalationStep) notifierPatterns() []string {
+	var notifierPatterns []string
+	for _, pattern := range strings.Split(s.Notifiers, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			notifierPatterns = append(notifierPatterns, pattern)
+		}
+	}
+	return notifierPatterns
+}
+
+// matchesAnyNotifier tells if the notifier name matches one of the patterns
+func matchesAnyNotifier(notifierPatterns []string, notifier string) bool {
+	for _, pattern := range notifierPatterns {
+		if glob.Glob(pattern, notifier) {
+			return true
+		}
+	}
+	return false
+}
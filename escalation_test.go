@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscalationPolicyImmediate(t *testing.T) {
+	policy := testEscalationPolicy()
+	assert.Equal(t, []string{"slack"}, policy.Immediate())
+}
+
+func TestEscalationPolicyDue(t *testing.T) {
+	policy := testEscalationPolicy()
+	openedOn := time.Now()
+	at := func(minutes int) time.Time {
+		return openedOn.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	assert.Nil(t, policy.Due(openedOn, openedOn, at(5)))
+	assert.Equal(t, []string{"slack"}, policy.Due(openedOn, at(5), at(15)))
+	assert.Nil(t, policy.Due(openedOn, at(15), at(20)))
+	assert.Equal(t, []string{"slack", "pagerduty"}, policy.Due(openedOn, at(20), at(30)))
+	assert.Nil(t, policy.Due(openedOn, at(30), at(44)))
+	assert.Equal(t, []string{"slack"}, policy.Due(openedOn, at(44), at(46)))
+	// Everything since the alert was opened, when we last escalated before that
+	assert.Equal(t, []string{"slack", "pagerduty"}, policy.Due(openedOn, at(-5), at(35)))
+}
+
+func TestEscalationPolicyReached(t *testing.T) {
+	policy := testEscalationPolicy()
+	openedOn := time.Now()
+	assert.Equal(t, []string{"slack"}, policy.Reached(openedOn, openedOn.Add(10*time.Minute)))
+	assert.Equal(t, []string{"slack", "pagerduty"}, policy.Reached(openedOn, openedOn.Add(30*time.Minute)))
+}
+
+func TestEscalationPolicyValidate(t *testing.T) {
+	policy := testEscalationPolicy()
+	assert.NoError(t, policy.Validate())
+
+	policy.Steps = nil
+	assert.EqualError(t, policy.Validate(), "Expected escalation policy oncall to have at least one step")
+
+	policy = testEscalationPolicy()
+	policy.Steps[1].Notifiers = ""
+	assert.EqualError(t, policy.Validate(), "Expected every step of escalation policy oncall to have notifiers")
+
+	policy = testEscalationPolicy()
+	policy.Steps[0].Repeat = -1 * time.Minute
+	assert.EqualError(t, policy.Validate(), "Expected non-negative after and repeat in escalation policy oncall")
+}
+
+func TestMatchesAnyNotifier(t *testing.T) {
+	assert.True(t, matchesAnyNotifier([]string{"slack-*", "pagerduty"}, "slack-ops"))
+	assert.True(t, matchesAnyNotifier([]string{"slack-*", "pagerduty"}, "pagerduty"))
+	assert.False(t, matchesAnyNotifier([]string{"slack-*"}, "webhook"))
+	assert.False(t, matchesAnyNotifier(nil, "webhook"))
+}
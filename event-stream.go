@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultEventStreamRetryInterval = 10 * time.Second
+	AppTerminatedEvent              = "app_terminated_event"
+)
+
+// AppEvents are the Marathon event types after which we re-check the affected apps,
+// or forget them when they're terminated
+var AppEvents = []string{
+	AppTerminatedEvent,
+	"status_update_event",
+	"health_status_changed_event",
+	"deployment_info",
+	"deployment_success",
+	"deployment_failed",
+	"deployment_step_success",
+	"deployment_step_failure",
+}
+
+// MarathonEvent is the subset of a message on Marathon's event bus that we need to
+// find out which apps it affects.
+type MarathonEvent struct {
+	EventType   string          `json:"eventType"`
+	AppID       string          `json:"appId"`
+	Plan        *deploymentPlan `json:"plan"`
+	CurrentStep *deploymentStep `json:"currentStep"`
+}
+
+type deploymentPlan struct {
+	Steps []deploymentStep `json:"steps"`
+}
+
+type deploymentStep struct {
+	Actions []deploymentAction `json:"actions"`
+}
+
+type deploymentAction struct {
+	App string `json:"app"`
+}
+
+// IsAppEvent tells if the event is one of AppEvents
+func (e *MarathonEvent) IsAppEvent() bool {
+	for _, eventType := range AppEvents {
+		if e.EventType == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// AppIDs returns the unique list of apps affected by the event
+func (e *MarathonEvent) AppIDs() []string {
+	var appIDs []string
+	seen := make(map[string]bool)
+	add := func(appID string) {
+		if appID != "" && !seen[appID] {
+			seen[appID] = true
+			appIDs = append(appIDs, appID)
+		}
+	}
+
+	add(e.AppID)
+	if e.CurrentStep != nil {
+		for _, action := range e.CurrentStep.Actions {
+			add(action.App)
+		}
+	}
+	if e.Plan != nil {
+		for _, step := range e.Plan.Steps {
+			for _, action := range step.Actions {
+				add(action.App)
+			}
+		}
+	}
+	return appIDs
+}
+
+// EventStream connects to Marathon's server-sent event stream at /v2/events.
+// When more than one Marathon URL is given, every new connection tries the next one.
+type EventStream struct {
+	URLs []string
+	// Client is expected to take care of authenticating to Marathon
+	Client        *http.Client
+	RetryInterval time.Duration
+	next          int
+}
+
+// Connect opens a new connection to the event stream
+func (s *EventStream) Connect() (*EventReader, error) {
+	if len(s.URLs) == 0 {
+		return nil, fmt.Errorf("No Marathon URL to connect the event stream to")
+	}
+	url := strings.TrimSuffix(s.URLs[s.next%len(s.URLs)], "/") + "/v2/events"
+	s.next++
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Expected 200 from %s but got %d", url, resp.StatusCode)
+	}
+
+	return &EventReader{body: resp.Body, reader: bufio.NewReader(resp.Body)}, nil
+}
+
+func (s *EventStream) retryInterval() time.Duration {
+	if s.RetryInterval > 0 {
+		return s.RetryInterval
+	}
+	return DefaultEventStreamRetryInterval
+}
+
+// EventReader reads events off an open event stream connection
+type EventReader struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+// Next blocks until the next event arrives on the stream. Events are not filtered,
+// callers should check for IsAppEvent.
+func (r *EventReader) Next() (MarathonEvent, error) {
+	var eventType string
+	var data []string
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil {
+			return MarathonEvent{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var event MarathonEvent
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &event); err != nil {
+				return MarathonEvent{}, fmt.Errorf("Unable to parse event %s - %v", eventType, err)
+			}
+			if event.EventType == "" {
+				event.EventType = eventType
+			}
+			return event, nil
+		case strings.HasPrefix(line, ":"):
+			// comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+// Close closes the underlying connection, unblocking any pending Next
+func (r *EventReader) Close() error {
+	return r.body.Close()
+}
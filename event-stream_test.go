@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeEventStream(events ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/events" || r.Header.Get("Accept") != "text/event-stream" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprint(w, event)
+		}
+		w.(http.Flusher).Flush()
+	}))
+}
+
+func TestEventReaderNext(t *testing.T) {
+	server := fakeEventStream(
+		": keep-alive\n\n",
+		"event: status_update_event\ndata: {\"eventType\":\"status_update_event\",\"appId\":\"/foo\"}\n\n",
+		"event: deployment_info\r\ndata: {\"eventType\":\"deployment_info\",\r\ndata: \"currentStep\":{\"actions\":[{\"action\":\"ScaleApplication\",\"app\":\"/bar\"}]}}\r\n\r\n",
+	)
+	defer server.Close()
+
+	stream := EventStream{URLs: []string{server.URL + "/"}}
+	reader, err := stream.Connect()
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	event, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "status_update_event", event.EventType)
+	assert.Equal(t, []string{"/foo"}, event.AppIDs())
+
+	event, err = reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "deployment_info", event.EventType)
+	assert.Equal(t, []string{"/bar"}, event.AppIDs())
+
+	_, err = reader.Next()
+	assert.Error(t, err)
+}
+
+func TestEventStreamConnectTriesNextURL(t *testing.T) {
+	server := fakeEventStream()
+	defer server.Close()
+
+	stream := EventStream{URLs: []string{server.URL + "/not-marathon", server.URL}}
+	_, err := stream.Connect()
+	assert.Error(t, err)
+	reader, err := stream.Connect()
+	assert.NoError(t, err)
+	reader.Close()
+}
+
+func TestEventStreamConnectWithoutURLs(t *testing.T) {
+	stream := EventStream{}
+	_, err := stream.Connect()
+	assert.Error(t, err)
+}
+
+func TestDeploymentEventAppIDs(t *testing.T) {
+	event := MarathonEvent{
+		EventType: "deployment_success",
+		Plan: &deploymentPlan{
+			Steps: []deploymentStep{
+				deploymentStep{Actions: []deploymentAction{deploymentAction{App: "/foo"}, deploymentAction{App: "/bar"}}},
+				deploymentStep{Actions: []deploymentAction{deploymentAction{App: "/foo"}}},
+			},
+		},
+	}
+	assert.True(t, event.IsAppEvent())
+	assert.Equal(t, []string{"/foo", "/bar"}, event.AppIDs())
+}
+
+func TestIsAppEvent(t *testing.T) {
+	event := MarathonEvent{EventType: "health_status_changed_event", AppID: "/foo"}
+	assert.True(t, event.IsAppEvent())
+	event = MarathonEvent{EventType: "event_stream_attached"}
+	assert.False(t, event.IsAppEvent())
+	assert.Len(t, event.AppIDs(), 0)
+}
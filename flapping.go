@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+)
+
+// FlapDetection marks a check as flapping, like Nagios does, when its result changed
+// in more than HighThreshold percent of the last History checks, and as no longer
+// flapping once it's below LowThreshold. Recent changes weigh more than the older
+// ones. A zero History disables it.
+type FlapDetection struct {
+	History       int     `yaml:"history"`
+	HighThreshold float64 `yaml:"high-threshold"`
+	LowThreshold  float64 `yaml:"low-threshold"`
+}
+
+func (f *FlapDetection) Validate() error {
+	if f.History == 0 {
+		return nil
+	}
+	if f.History < 3 {
+		return fmt.Errorf("Expected alerts.flapping.history to be at least 3 but %d found", f.History)
+	}
+	if f.LowThreshold <= 0 || f.HighThreshold > 100 || f.LowThreshold > f.HighThreshold {
+		return fmt.Errorf("Expected 0 < alerts.flapping.low-threshold (%v) <= high-threshold (%v) <= 100", f.LowThreshold, f.HighThreshold)
+	}
+	return nil
+}
+
+func (f *FlapDetection) Enabled() bool {
+	return f.History > 0
+}
+
+// Record appends the result to the history, keeping only the last History results.
+// A new history starts out full of the result, so it takes History changes for a
+// check to flap and not just the first couple of them.
+func (f *FlapDetection) Record(history []checks.CheckStatus, result checks.CheckStatus) []checks.CheckStatus {
+	if len(history) == 0 {
+		for i := 0; i < f.History; i++ {
+			history = append(history, result)
+		}
+		return history
+	}
+	history = append(history, result)
+	if len(history) > f.History {
+		history = history[len(history)-f.History:]
+	}
+	return history
+}
+
+// PercentStateChange is the weighted % of the results in the history that changed
+// from the one before, the oldest change weighs 0.8 and the latest 1.2
+func (f *FlapDetection) PercentStateChange(history []checks.CheckStatus) float64 {
+	transitions := len(history) - 1
+	if transitions < 1 {
+		return 0
+	}
+	changed := 0.0
+	for i := 1; i < len(history); i++ {
+		if history[i] == history[i-1] {
+			continue
+		}
+		weight := 1.0
+		if transitions > 1 {
+			weight = 0.8 + 0.4*float64(i-1)/float64(transitions-1)
+		}
+		changed += weight
+	}
+	return changed * 100 / float64(transitions)
+}
+
+// IsFlapping tells if a check with the history is flapping, given whether it was
+// already flapping. Between the thresholds it stays the way it was.
+func (f *FlapDetection) IsFlapping(history []checks.CheckStatus, wasFlapping bool) bool {
+	percent := f.PercentStateChange(history)
+	if wasFlapping {
+		return percent >= f.LowThreshold
+	}
+	return percent > f.HighThreshold
+}
+
+// worstLevel returns the most severe failure in the history, Warning if it has none
+func worstLevel(history []checks.CheckStatus) checks.CheckStatus {
+	worst := checks.Warning
+	for _, result := range history {
+		if result == checks.Critical {
+			worst = checks.Critical
+		}
+	}
+	return worst
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlapDetectionRecord(t *testing.T) {
+	flapDetection := FlapDetection{History: 3}
+	history := flapDetection.Record(nil, checks.Pass)
+	assert.Equal(t, []checks.CheckStatus{checks.Pass, checks.Pass, checks.Pass}, history)
+	history = flapDetection.Record(history, checks.Warning)
+	assert.Equal(t, []checks.CheckStatus{checks.Pass, checks.Pass, checks.Warning}, history)
+	history = flapDetection.Record(history, checks.Critical)
+	assert.Equal(t, []checks.CheckStatus{checks.Pass, checks.Warning, checks.Critical}, history)
+}
+
+func TestFlapDetectionPercentStateChange(t *testing.T) {
+	flapDetection := FlapDetection{History: 5}
+	w, p := checks.Warning, checks.Pass
+	assert.Equal(t, 0.0, flapDetection.PercentStateChange([]checks.CheckStatus{w, w, w, w, w}))
+	assert.InDelta(t, 100.0, flapDetection.PercentStateChange([]checks.CheckStatus{w, p, w, p, w}), 0.001)
+	// The latest change weighs more than the oldest
+	assert.InDelta(t, 30.0, flapDetection.PercentStateChange([]checks.CheckStatus{w, w, w, w, p}), 0.001)
+	assert.InDelta(t, 20.0, flapDetection.PercentStateChange([]checks.CheckStatus{p, w, w, w, w}), 0.001)
+}
+
+func TestFlapDetectionIsFlapping(t *testing.T) {
+	flapDetection := FlapDetection{History: 5, HighThreshold: 50, LowThreshold: 25}
+	w, p := checks.Warning, checks.Pass
+	// 30% is between the thresholds, it stays the way it was
+	history := []checks.CheckStatus{w, w, w, w, p}
+	assert.False(t, flapDetection.IsFlapping(history, false))
+	assert.True(t, flapDetection.IsFlapping(history, true))
+	assert.True(t, flapDetection.IsFlapping([]checks.CheckStatus{w, p, w, p, w}, false))
+	assert.False(t, flapDetection.IsFlapping([]checks.CheckStatus{p, w, w, w, w}, true))
+}
+
+func TestFlapDetectionValidate(t *testing.T) {
+	flapDetection := FlapDetection{}
+	assert.NoError(t, flapDetection.Validate())
+	assert.False(t, flapDetection.Enabled())
+
+	flapDetection = FlapDetection{History: 21, HighThreshold: 50, LowThreshold: 25}
+	assert.NoError(t, flapDetection.Validate())
+	assert.True(t, flapDetection.Enabled())
+
+	flapDetection.History = 2
+	assert.EqualError(t, flapDetection.Validate(), "Expected alerts.flapping.history to be at least 3 but 2 found")
+	flapDetection.History = 21
+	flapDetection.LowThreshold = 60
+	assert.EqualError(t, flapDetection.Validate(), "Expected 0 < alerts.flapping.low-threshold (60) <= high-threshold (50) <= 100")
+}
+
+func TestWorstLevel(t *testing.T) {
+	assert.Equal(t, checks.Warning, worstLevel([]checks.CheckStatus{checks.Pass, checks.Warning}))
+	assert.Equal(t, checks.Critical, worstLevel([]checks.CheckStatus{checks.Critical, checks.Pass, checks.Warning}))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+)
+
+const DefaultHistorySize = 50
+
+// Transition is a change in the alert of an app and check - when it's opened, changes
+// level or is resolved
+type Transition struct {
+	Cluster   string
+	App       string
+	CheckName string
+	From      checks.CheckStatus
+	To        checks.CheckStatus
+	Message   string
+	Timestamp time.Time
+}
+
+// recordTransition adds the change to the history of the check, keeping only the last
+// HistorySize of them. Callers should hold supressMutex.
+func (a *AlertManager) recordTransition(check checks.AppCheck, from, to checks.CheckStatus) {
+	if a.History == nil {
+		a.History = make(map[string][]Transition)
+	}
+	size := a.HistorySize
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	keyPrefix := a.keyPrefix(check)
+	history := append(a.History[keyPrefix], Transition{
+		Cluster:   check.Cluster,
+		App:       check.App,
+		CheckName: check.CheckName,
+		From:      from,
+		To:        to,
+		Message:   check.Message,
+		Timestamp: check.Timestamp,
+	})
+	if len(history) > size {
+		history = history[len(history)-size:]
+	}
+	a.History[keyPrefix] = history
+}
+
+// Transitions returns the changes of every app and check in [from, to), oldest first.
+// A zero from or to leaves that end open.
+func (a *AlertManager) Transitions(from, to time.Time) []Transition {
+	a.supressMutex.Lock()
+	defer a.supressMutex.Unlock()
+	transitions := []Transition{}
+	for _, history := range a.History {
+		for _, transition := range history {
+			if (!from.IsZero() && transition.Timestamp.Before(from)) || (!to.IsZero() && !transition.Timestamp.Before(to)) {
+				continue
+			}
+			transitions = append(transitions, transition)
+		}
+	}
+	sort.Stable(transitionsByTimestamp(transitions))
+	return transitions
+}
+
+// lastTransition is when the check last changed, zero if it's not in the history.
+// Callers should hold supressMutex.
+func (a *AlertManager) lastTransition(check checks.AppCheck) time.Time {
+	history := a.History[a.keyPrefix(check)]
+	if len(history) == 0 {
+		return time.Time{}
+	}
+	return history[len(history)-1].Timestamp
+}
+
+// openedAt is when the alert of the check was last opened, zero if that's no longer in
+// the history. Callers should hold supressMutex.
+func (a *AlertManager) openedAt(check checks.AppCheck) time.Time {
+	history := a.History[a.keyPrefix(check)]
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].From == checks.Pass {
+			return history[i].Timestamp
+		}
+	}
+	return time.Time{}
+}
+
+type transitionsByTimestamp []Transition
+
+func (t transitionsByTimestamp) Len() int      { return len(t) }
+func (t transitionsByTimestamp) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t transitionsByTimestamp) Less(i, j int) bool {
+	return t[i].Timestamp.Before(t[j].Timestamp)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProcessCheckRecordsTransitions(t *testing.T) {
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+	}
+	now := time.Now()
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Warning, Timestamp: now}
+	mgr.processCheck(check)
+	// No change, no transition
+	check.Timestamp = now.Add(1 * time.Minute)
+	mgr.processCheck(check)
+	check.Result = checks.Critical
+	check.Timestamp = now.Add(2 * time.Minute)
+	mgr.processCheck(check)
+	check.Result = checks.Pass
+	check.Timestamp = now.Add(3 * time.Minute)
+	mgr.processCheck(check)
+
+	transitions := mgr.Transitions(time.Time{}, time.Time{})
+	assert.Len(t, transitions, 3)
+	assert.Equal(t, checks.Pass, transitions[0].From)
+	assert.Equal(t, checks.Warning, transitions[0].To)
+	assert.Equal(t, checks.Warning, transitions[1].From)
+	assert.Equal(t, checks.Critical, transitions[1].To)
+	assert.Equal(t, checks.Critical, transitions[2].From)
+	assert.Equal(t, checks.Resolved, transitions[2].To)
+
+	transitions = mgr.Transitions(now.Add(1*time.Minute), now.Add(3*time.Minute))
+	assert.Len(t, transitions, 1)
+	assert.Equal(t, checks.Critical, transitions[0].To)
+}
+
+func TestHistoryKeepsOnlyTheLatestTransitions(t *testing.T) {
+	mgr := AlertManager{HistorySize: 2}
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy"}
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		check.Timestamp = now.Add(time.Duration(i) * time.Minute)
+		mgr.recordTransition(check, checks.Pass, checks.Warning)
+	}
+
+	transitions := mgr.Transitions(time.Time{}, time.Time{})
+	assert.Len(t, transitions, 2)
+	assert.Equal(t, now.Add(1*time.Minute), transitions[0].Timestamp)
+	assert.Equal(t, now.Add(2*time.Minute), mgr.lastTransition(check))
+}
+
+func TestNotificationsHaveWhenTheAlertWasOpened(t *testing.T) {
+	mockNotifier := new(notifiers.MockNotifier)
+	mockNotifier.On("Name").Return("slack")
+	mockNotifier.On("Notify", mock.AnythingOfType("AppCheck")).Return(nil)
+	mgr := AlertManager{
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		Notifiers:   []notifiers.Notifier{mockNotifier},
+	}
+	opened := time.Now()
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Warning, Timestamp: opened}
+	mgr.processCheck(check)
+	check.Result = checks.Critical
+	check.Timestamp = opened.Add(1 * time.Minute)
+	mgr.processCheck(check)
+	check.Result = checks.Pass
+	check.Timestamp = opened.Add(2 * time.Minute)
+	mgr.processCheck(check)
+
+	mockNotifier.AssertNumberOfCalls(t, "Notify", 3)
+	for _, call := range mockNotifier.Calls {
+		if call.Method == "Notify" {
+			assert.Equal(t, opened, call.Arguments.Get(0).(checks.AppCheck).OpenedAt)
+		}
+	}
+}
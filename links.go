@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"text/template"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+)
+
+const (
+	// MarathonAppLink is the page of an app on the Marathon UI, relative to the URI of
+	// the Marathon it runs on
+	MarathonAppLink = "/ui/#/apps/{{urlquery .App}}"
+	// RunbookLabel is the runbook of the app, it overrides alerts.runbook
+	RunbookLabel = "alerts.runbook"
+)
+
+// renderLink executes the link, a text/template, with the check
+func renderLink(link string, check checks.AppCheck) (string, error) {
+	tmpl, err := template.New("link").Parse(link)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, check)
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// validateLink renders the link with a sample check, so the links that can't be
+// rendered are caught on startup
+func validateLink(name, link string) error {
+	_, err := renderLink(link, checks.AppCheck{
+		Cluster:   "prod",
+		App:       "/sample",
+		CheckName: "min-healthy",
+		Result:    checks.Critical,
+		Timestamp: time.Now(),
+		Labels:    map[string]string{},
+	})
+	if err != nil {
+		return fmt.Errorf("Expected %s to be a valid link template - %v", name, err)
+	}
+	return nil
+}
+
+// runbookOf is the runbook of the check, from the alerts.runbook label of its app or
+// the default Runbook. Callers should hold supressMutex.
+func (a *AlertManager) runbookOf(check checks.AppCheck) string {
+	if runbook, present := check.Labels[RunbookLabel]; present {
+		link, err := renderLink(runbook, check)
+		if err == nil {
+			return link
+		}
+		log.Printf("Error - Invalid %s label on %s, falling back to alerts.runbook - %v\n", RunbookLabel, check.App, err)
+	}
+	if a.Runbook == "" {
+		return ""
+	}
+	link, err := renderLink(a.Runbook, check)
+	if err != nil {
+		log.Printf("Error - Unable to render alerts.runbook for %s - %v\n", check.App, err)
+		return ""
+	}
+	return link
+}
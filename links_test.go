@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderLink(t *testing.T) {
+	check := checks.AppCheck{Cluster: "prod", App: "/payments/api", CheckName: "min-healthy"}
+	link, err := renderLink("https://dcos.example.com"+MarathonAppLink, check)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dcos.example.com/ui/#/apps/%2Fpayments%2Fapi", link)
+
+	link, err = renderLink("https://{{.Cluster}}.dcos.example.com/#/services/detail/{{urlquery .App}}", check)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://prod.dcos.example.com/#/services/detail/%2Fpayments%2Fapi", link)
+
+	_, err = renderLink("{{.Application}}", check)
+	assert.Error(t, err)
+}
+
+func TestRunbookOfCheck(t *testing.T) {
+	mgr := AlertManager{Runbook: "https://wiki.example.com/runbooks/{{.CheckName}}"}
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy"}
+	assert.Equal(t, "https://wiki.example.com/runbooks/min-healthy", mgr.runbookOf(check))
+
+	check.Labels = map[string]string{RunbookLabel: "https://wiki.example.com/foo"}
+	assert.Equal(t, "https://wiki.example.com/foo", mgr.runbookOf(check))
+
+	// A broken label falls back to the default
+	check.Labels = map[string]string{RunbookLabel: "https://wiki.example.com/{{.App"}
+	assert.Equal(t, "https://wiki.example.com/runbooks/min-healthy", mgr.runbookOf(check))
+
+	mgr.Runbook = ""
+	check.Labels = nil
+	assert.Equal(t, "", mgr.runbookOf(check))
+}
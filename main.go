@@ -6,130 +6,389 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ashwanthkumar/marathon-alerts/checks"
 	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+	"github.com/ashwanthkumar/marathon-alerts/routes"
+	"github.com/ashwanthkumar/marathon-alerts/state"
 	flag "github.com/spf13/pflag"
 
 	marathon "github.com/gambol99/go-marathon"
 	"github.com/rcrowley/go-metrics"
 )
 
-var appChecker AppChecker
+// One AppChecker for every cluster
+var appCheckers []*AppChecker
 var alertManager AlertManager
 
+// Config currently in use, replaced on every reload
+var currentConfig *Config
+
 // Check settings
 var minHealthyWarningThreshold float32
 var minHealthyCriticalThreshold float32
 var minInstancesWarningThreshold float32
 var minInstancesCriticalThreshold float32
+var deploymentStuckWarningThreshold time.Duration
+var deploymentStuckCriticalThreshold time.Duration
+var taskFlappingWindow time.Duration
+var taskFlappingWarningThreshold int
+var taskFlappingCriticalThreshold int
 
 // Required flags
+var configFile string
 var marathonURI string
 var checkInterval time.Duration
 var alertSuppressDuration time.Duration
+var alertRoutes string
+var alertEscalation string
+var flapHistory int
+var flapHighThreshold float64
+var flapLowThreshold float64
+var alertFailAfter int
+var alertResolveAfter int
+var alertGroupWindow time.Duration
+var alertGroupBy string
+var alertHistorySize int
+var alertRunbook string
+var appLink string
 var debugMode bool
 var pidFile string
+var eventStreamEnabled bool
+var stateFile string
+var httpAddress string
+var shutdownTimeout time.Duration
+
+// Dispatch flags
+var notifyQueueSize int
+var notifyTimeout time.Duration
+var notifyMaxRetries int
+var notifyRetryBackoff time.Duration
+var deadLetterFile string
+
+// Marathon auth flags
+var marathonUsername string
+var marathonPassword string
+var dcosUID string
+var dcosPrivateKey string
+var dcosLoginURL string
+var marathonCACert string
+var marathonClientCert string
+var marathonClientKey string
 
 // Slack flags
 var slackWebhooks string
 var slackChannel string
 var slackOwners string
 
-// DebugMetricsRegistry is used for pushing debug level metrics by rest of the app
+// PagerDuty flags
+var pagerDutyRoutingKey string
+
+// Webhook flags
+var webhookURLs string
+var webhookHeaders []string
+var webhookSecret string
+
+// Email flags
+var emailSMTPServer string
+var emailSMTPTLS string
+var emailSMTPUsername string
+var emailSMTPPassword string
+var emailFrom string
+var emailTo string
+
+// DebugMetricsRegistry is used for pushing debug level metrics by rest of the app, their
+// names start with DebugMetricsPrefix
 var DebugMetricsRegistry metrics.Registry
 
+const DebugMetricsPrefix = "debug"
+
 func main() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.LUTC | log.Lshortfile)
 	log.SetOutput(os.Stdout)
 	os.Args[0] = "marathon-alerts"
-	defineFlags()
+	if len(os.Args) > 1 && os.Args[1] == "ack" {
+		os.Exit(runAckCommand(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplayCommand(os.Args[2:], os.Stdout))
+	}
+	defineFlags(flag.CommandLine)
 	flag.Parse()
+	config, err := LoadConfig(configFile, flag.CommandLine)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	currentConfig = config
+
 	pid := []byte(fmt.Sprintf("%d\n", os.Getpid()))
-	err := ioutil.WriteFile(pidFile, pid, 0644)
+	err = ioutil.WriteFile(config.PidFile, pid, 0644)
 	if err != nil {
 		fmt.Println("Unable to write pid file. ")
 		log.Fatalf("Error - %v\n", err)
 	}
 
-	client, err := marathonClient(marathonURI)
-	if err != nil {
-		fmt.Printf("%v\n", err)
-		os.Exit(1)
-	}
-	DebugMetricsRegistry = metrics.NewPrefixedRegistry("debug")
+	DebugMetricsRegistry = metrics.NewPrefixedRegistry(DebugMetricsPrefix)
 
-	minHealthyTasks := &checks.MinHealthyTasks{
-		DefaultCriticalThreshold: minHealthyCriticalThreshold,
-		DefaultWarningThreshold:  minHealthyWarningThreshold,
-	}
-	minInstances := &checks.MinInstances{
-		DefaultCriticalThreshold: minHealthyCriticalThreshold,
-		DefaultWarningThreshold:  minHealthyWarningThreshold,
+	alertsChannel := make(chan checks.AppCheck, AlertsChannelSize)
+	// The AppCheckers tell the AlertManager about the removed apps, so it has to be
+	// ready before they start
+	snoozer := NewSnoozer()
+	maintenanceWindows := NewMaintenanceWindows(config.Maintenance)
+	alertManager = AlertManager{
+		CheckerChan:       alertsChannel,
+		SuppressDuration:  config.Alerts.SuppressDuration,
+		DefaultRoutes:     string(config.Alerts.Routes),
+		Notifiers:         config.BuildNotifiers(),
+		Escalations:       config.BuildEscalations(),
+		DefaultEscalation: config.Alerts.Escalation,
+		FlapDetection:     config.Alerts.Flapping,
+		FailAfter:         config.Alerts.FailAfter,
+		ResolveAfter:      config.Alerts.ResolveAfter,
+		GroupWindow:       config.Alerts.GroupWindow,
+		GroupBy:           config.Alerts.GroupBy,
+		HistorySize:       config.Alerts.HistorySize,
+		Runbook:           config.Alerts.Runbook,
+		Snoozer:           snoozer,
+		Maintenance:       maintenanceWindows,
+		ShutdownTimeout:   config.ShutdownTimeout,
 	}
-	suspendedCheck := &checks.SuspendedCheck{}
-	checks := []checks.Checker{minHealthyTasks, minInstances, suspendedCheck}
-
-	appChecker = AppChecker{
-		Client:        client,
-		CheckInterval: checkInterval,
-		Checks:        checks,
+	if config.Alerts.StateFile != "" {
+		alertManager.Store = &state.FileStore{Path: config.Alerts.StateFile}
 	}
-	appChecker.Start()
+	alertManager.Dispatcher = config.BuildDispatcher()
+	alertManager.Start()
 
-	var allNotifiers []notifiers.Notifier
-	slack := notifiers.Slack{
-		Webhook: slackWebhooks,
-		Channel: slackChannel,
-		Owners:  slackOwners,
+	for _, cluster := range config.AllClusters() {
+		transport, err := cluster.BuildTransport()
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		client, err := marathonClient(cluster, transport)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		appChecker := &AppChecker{
+			Cluster:       cluster.Name,
+			Client:        client,
+			AppLink:       cluster.AppLink,
+			CheckInterval: cluster.CheckInterval,
+			Checks:        config.BuildChecks(client),
+			AlertsChannel: alertsChannel,
+			Forgetter:     &alertManager,
+		}
+		if cluster.EventStream {
+			appChecker.EventStream = &EventStream{
+				URLs: strings.Split(cluster.URI, ","),
+				// No timeout here, the stream is supposed to stay open
+				Client: &http.Client{Transport: transport},
+			}
+		}
+		appChecker.Start()
+		appCheckers = append(appCheckers, appChecker)
 	}
-	allNotifiers = append(allNotifiers, &slack)
 
-	alertManager = AlertManager{
-		CheckerChan:      appChecker.AlertsChannel,
-		SuppressDuration: alertSuppressDuration,
-		Notifiers:        allNotifiers,
+	var apiServer *APIServer
+	if config.HTTPAddress != "" {
+		apiServer = &APIServer{
+			Address:      config.HTTPAddress,
+			Snoozer:      snoozer,
+			Maintenance:  maintenanceWindows,
+			AlertManager: &alertManager,
+			AppCheckers:  appCheckers,
+			Debug:        config.Debug,
+		}
+		err = apiServer.Start()
+		if err != nil {
+			log.Fatalf("Error - %v\n", err)
+		}
 	}
-	alertManager.Start()
 
 	metrics.RegisterDebugGCStats(DebugMetricsRegistry)
 	metrics.RegisterRuntimeMemStats(DebugMetricsRegistry)
 	go metrics.CaptureDebugGCStats(DebugMetricsRegistry, 15*time.Minute)
 	go metrics.CaptureRuntimeMemStats(DebugMetricsRegistry, 5*time.Minute)
-	go metrics.Log(metrics.DefaultRegistry, 60*time.Second, log.New(os.Stderr, "metrics: ", log.Lmicroseconds))
-	if debugMode {
-		go metrics.Log(DebugMetricsRegistry, 300*time.Second, log.New(os.Stderr, "debug-metrics: ", log.Lmicroseconds))
+	// Metrics are scraped from /metrics when we've the API, else we dump them to STDERR
+	if config.HTTPAddress == "" {
+		go metrics.Log(metrics.DefaultRegistry, 60*time.Second, log.New(os.Stderr, "metrics: ", log.Lmicroseconds))
+		if config.Debug {
+			go metrics.Log(DebugMetricsRegistry, 300*time.Second, log.New(os.Stderr, "debug-metrics: ", log.Lmicroseconds))
+		}
 	}
-	appChecker.RunWaitGroup.Wait()
-	// Handle signals and cleanup all routines
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			reloadConfig()
+			continue
+		}
+		log.Printf("Received %v, shutting down...\n", sig)
+		break
+	}
+	go func() {
+		sig := <-signals
+		log.Printf("Received %v again, exiting without waiting for the shutdown\n", sig)
+		os.Exit(1)
+	}()
+	shutdown(apiServer, config.PidFile)
 }
 
-func marathonClient(uri string) (marathon.Marathon, error) {
+// shutdown stops checking apps, lets the AlertManager notify the checks that were
+// already queued and removes the pid file
+func shutdown(apiServer *APIServer, pidFile string) {
+	if apiServer != nil {
+		apiServer.Stop()
+	}
+	for _, appChecker := range appCheckers {
+		appChecker.Stop()
+	}
+	alertManager.Stop()
+	err := os.Remove(pidFile)
+	if err != nil {
+		log.Printf("Error - Unable to remove the pid file - %v\n", err)
+	}
+	log.Println("Shutdown complete.")
+}
+
+// reloadConfig re-reads the config file and swaps the checks, notifiers, routes,
+// escalation, maintenance, flap detection, hysteresis, grouping and suppression
+// settings. Everything else needs a restart to take effect.
+func reloadConfig() {
+	log.Println("Reloading config...")
+	config, err := LoadConfig(configFile, flag.CommandLine)
+	if err != nil {
+		log.Printf("Error - Not reloading, the config is invalid - %v\n", err)
+		return
+	}
+	if config.Marathon != currentConfig.Marathon || !reflect.DeepEqual(config.Clusters, currentConfig.Clusters) ||
+		config.HTTPAddress != currentConfig.HTTPAddress || config.PidFile != currentConfig.PidFile ||
+		config.Alerts.StateFile != currentConfig.Alerts.StateFile || config.Dispatch != currentConfig.Dispatch {
+		log.Println("Warning - Changes to marathon, clusters, http-address, pid, alerts.state-file and dispatch need a restart to take effect")
+	}
+
+	for _, appChecker := range appCheckers {
+		appChecker.SetChecks(config.BuildChecks(appChecker.Client))
+	}
+	alertManager.Reconfigure(config.BuildNotifiers(), config.Alerts, config.BuildEscalations())
+	alertManager.Maintenance.SetConfigured(config.Maintenance)
+	// Only read on shutdown, which happens on this same goroutine
+	alertManager.ShutdownTimeout = config.ShutdownTimeout
+	currentConfig = config
+	log.Println("Config Reloaded.")
+}
+
+// marathonClient talks to the cluster through the transport, which takes care of
+// the authentication
+func marathonClient(cluster ClusterConfig, transport http.RoundTripper) (marathon.Marathon, error) {
 	config := marathon.NewDefaultConfig()
-	config.URL = uri
+	config.URL = cluster.URI
 	config.HTTPClient = &http.Client{
-		Timeout: (30 * time.Second),
+		Transport: transport,
+		Timeout:   (30 * time.Second),
 	}
 
 	return marathon.NewClient(config)
 }
 
-func defineFlags() {
-	flag.StringVar(&marathonURI, "uri", "", "Marathon URI to connect")
-	flag.StringVar(&pidFile, "pid", "PID", "File to write PID file")
-	flag.BoolVar(&debugMode, "debug", false, "Enable debug mode. More counters for now.")
-	flag.DurationVar(&checkInterval, "check-interval", 60*time.Second, "Check runs periodically on this interval")
-	flag.DurationVar(&alertSuppressDuration, "alerts-suppress-duration", 30*time.Minute, "Suppress alerts for this duration once notified")
+func defineFlags(flags *flag.FlagSet) {
+	flags.StringVar(&configFile, "config", "", "YAML / JSON config file, flags set on the command line override it. Reloaded on SIGHUP")
+	flags.StringVar(&marathonURI, "uri", "", "Marathon URI to connect")
+	flags.StringVar(&appLink, "app-link", "", "Template of the link to the page of the app in alerts, like https://dcos.example.com/#/services/detail/{{urlquery .App}} (defaults to the Marathon UI of --uri)")
+	flags.StringVar(&pidFile, "pid", "PID", "File to write PID file")
+	flags.BoolVar(&debugMode, "debug", false, "Enable debug mode. More counters for now.")
+	flags.DurationVar(&checkInterval, "check-interval", 60*time.Second, "Check runs periodically on this interval")
+	flags.BoolVar(&eventStreamEnabled, "event-stream", false, "Check apps as their events arrive on Marathon's event stream, polling only when the stream is down")
+	flags.StringVar(&httpAddress, "http-address", "", "Address to serve the HTTP API on, like :8000 (the API is disabled if empty)")
+	flags.StringVar(&stateFile, "state-file", "", "File to persist the alerts state across restarts (state is kept only in memory if empty)")
+	flags.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time to wait for the queued checks and in-flight notifications on SIGTERM / SIGINT")
+	flags.IntVar(&notifyQueueSize, "notify-queue-size", DefaultDispatchQueueSize, "# of notifications queued for every notifier, the ones that don't fit are dead lettered")
+	flags.DurationVar(&notifyTimeout, "notify-timeout", DefaultDispatchTimeout, "Time to wait for a notifier to send a notification before retrying it")
+	flags.IntVar(&notifyMaxRetries, "notify-max-retries", 3, "# of times a failed notification is retried before it's dead lettered")
+	flags.DurationVar(&notifyRetryBackoff, "notify-retry-backoff", DefaultDispatchRetryBackoff, "Time to wait before the first retry of a failed notification, doubled on every retry")
+	flags.StringVar(&deadLetterFile, "dead-letter-file", "", "File to write the notifications that failed every retry to, for the replay command (they're only logged if empty)")
+	flags.DurationVar(&alertSuppressDuration, "alerts-suppress-duration", 30*time.Minute, "Suppress alerts for this duration once notified")
+	flags.StringVar(&alertRoutes, "alerts-routes", routes.DefaultRoutes, "Routes for the apps without an alerts.routes label")
+	flags.StringVar(&alertEscalation, "alerts-escalation", "", "Escalation policy (from the config file) for the apps without an alerts.escalation label, alerts are re-notified every --alerts-suppress-duration if empty")
+	flags.IntVar(&alertFailAfter, "alerts-fail-after", 1, "# of consecutive failures of a check before alerting, overridden by the alerts.<check>.fail-after label")
+	flags.IntVar(&alertResolveAfter, "alerts-resolve-after", 1, "# of consecutive passes of a failing check before resolving the alert, overridden by the alerts.<check>.resolve-after label")
+	flags.DurationVar(&alertGroupWindow, "alerts-group-window", 0, "Send the notifications within this window as one digest per notifier and --alerts-group-by, only Slack takes digests (disabled if 0)")
+	flags.StringVar(&alertGroupBy, "alerts-group-by", GroupByCluster, "What to group the notifications on with --alerts-group-window - cluster, group (Marathon group of the app) or check")
+	flags.StringVar(&alertRunbook, "alerts-runbook", "", "Template of the runbook link of the apps without an alerts.runbook label, like https://wiki.example.com/runbooks/{{.CheckName}}")
+	flags.IntVar(&alertHistorySize, "alerts-history-size", DefaultHistorySize, "# of latest transitions of every check to keep for /api/history")
+	flags.IntVar(&flapHistory, "alerts-flap-history", 0, "# of latest results of every check to detect flapping on, 0 disables flap detection")
+	flags.Float64Var(&flapHighThreshold, "alerts-flap-high-threshold", 50, "A check starts flapping once its result changed in more than this % of the history")
+	flags.Float64Var(&flapLowThreshold, "alerts-flap-low-threshold", 25, "A flapping check stops flapping once its result changed in less than this % of the history")
+
+	// Marathon auth flags
+	flags.StringVar(&marathonUsername, "marathon-username", "", "Username to authenticate to Marathon with basic auth")
+	flags.StringVar(&marathonPassword, "marathon-password", "", "Password for --marathon-username, use file:<path> or env:<name> to keep it off the command line")
+	flags.StringVar(&dcosUID, "dcos-uid", "", "DC/OS service account to login to DC/OS IAM as, instead of basic auth")
+	flags.StringVar(&dcosPrivateKey, "dcos-private-key", "", "PEM encoded private key of the DC/OS service account, use file:<path> or env:<name> to keep it off the command line")
+	flags.StringVar(&dcosLoginURL, "dcos-login-url", "", "DC/OS IAM login URL (defaults to /acs/api/v1/auth/login on the host of --uri)")
+	flags.StringVar(&marathonCACert, "marathon-ca-cert", "", "File with the PEM encoded CA certificates to trust on top of the system ones")
+	flags.StringVar(&marathonClientCert, "marathon-client-cert", "", "File with the PEM encoded client certificate to present to Marathon")
+	flags.StringVar(&marathonClientKey, "marathon-client-key", "", "File with the PEM encoded private key of --marathon-client-cert")
 
 	// Check flags
-	flag.Float32Var(&minHealthyWarningThreshold, "check-min-healthy-warn-threshold", 0.75, "Min Healthy instances check warning threshold")
-	flag.Float32Var(&minHealthyCriticalThreshold, "check-min-healthy-critical-threshold", 0.5, "Min Healthy instances check fail threshold")
-	flag.Float32Var(&minInstancesWarningThreshold, "check-min-instances-warn-threshold", 0.75, "Min Instances check warning threshold")
-	flag.Float32Var(&minInstancesCriticalThreshold, "check-min-instances-critical-threshold", 0.5, "Min Instances check fail threshold")
+	flags.Float32Var(&minHealthyWarningThreshold, "check-min-healthy-warn-threshold", 0.75, "Min Healthy instances check warning threshold")
+	flags.Float32Var(&minHealthyCriticalThreshold, "check-min-healthy-critical-threshold", 0.5, "Min Healthy instances check fail threshold")
+	flags.Float32Var(&minInstancesWarningThreshold, "check-min-instances-warn-threshold", 0.75, "Min Instances check warning threshold")
+	flags.Float32Var(&minInstancesCriticalThreshold, "check-min-instances-critical-threshold", 0.5, "Min Instances check fail threshold")
+	flags.DurationVar(&deploymentStuckWarningThreshold, "check-deployment-stuck-warn-threshold", 15*time.Minute, "Deployment stuck check warning threshold, for deployments running longer than this")
+	flags.DurationVar(&deploymentStuckCriticalThreshold, "check-deployment-stuck-critical-threshold", 30*time.Minute, "Deployment stuck check fail threshold, for deployments running longer than this")
+	flags.DurationVar(&taskFlappingWindow, "check-task-flapping-window", 10*time.Minute, "Window over which the task flapping check counts the task restarts")
+	flags.IntVar(&taskFlappingWarningThreshold, "check-task-flapping-warn-threshold", 3, "Task flapping check warning threshold, # of restarts within the window")
+	flags.IntVar(&taskFlappingCriticalThreshold, "check-task-flapping-critical-threshold", 5, "Task flapping check fail threshold, # of restarts within the window")
 
 	// Slack flags
-	flag.StringVar(&slackWebhooks, "slack-webhook", "", "Comma list of Slack webhooks to post the alert")
-	flag.StringVar(&slackChannel, "slack-channel", "", "#Channel / @User to post the alert (defaults to webhook configuration)")
-	flag.StringVar(&slackOwners, "slack-owner", "", "Comma list of owners who should be alerted on the post")
+	flags.StringVar(&slackWebhooks, "slack-webhook", "", "Comma list of Slack webhooks to post the alert")
+	flags.StringVar(&slackChannel, "slack-channel", "", "#Channel / @User to post the alert (defaults to webhook configuration)")
+	flags.StringVar(&slackOwners, "slack-owner", "", "Comma list of owners who should be alerted on the post")
+
+	// PagerDuty flags
+	flags.StringVar(&pagerDutyRoutingKey, "pagerduty-routing-key", "", "PagerDuty Events API v2 routing key to trigger incidents on (alerts are not sent to PagerDuty if empty)")
+
+	// Webhook flags
+	flags.StringVar(&webhookURLs, "webhook-url", "", "Comma list of URLs to POST the alert as JSON")
+	flags.Var(newStringArray(&webhookHeaders), "webhook-header", "Header of the form \"Name: value\" to send with every webhook request, can be repeated")
+	flags.StringVar(&webhookSecret, "webhook-hmac-secret", "", "Secret to sign the webhook body with, the HMAC-SHA256 is sent in the X-Marathon-Alerts-Signature header")
+
+	// Email flags
+	flags.StringVar(&emailSMTPServer, "email-smtp-server", "", "host:port of the SMTP server to send alerts as emails through (alerts are not emailed if empty)")
+	flags.StringVar(&emailSMTPTLS, "email-smtp-tls", notifiers.EmailTLSStartTLS, "How to talk TLS to the SMTP server - starttls, tls (implicit TLS, like on port 465) or none")
+	flags.StringVar(&emailSMTPUsername, "email-smtp-username", "", "Username to authenticate to the SMTP server with, no auth if empty")
+	flags.StringVar(&emailSMTPPassword, "email-smtp-password", "", "Password for --email-smtp-username, use file:<path> or env:<name> to keep it off the command line")
+	flags.StringVar(&emailFrom, "email-from", "", "Address to send the alert emails from")
+	flags.StringVar(&emailTo, "email-to", "", "Comma list of addresses to email the alert to")
+}
+
+// stringArray is a flag that can be repeated, every value is taken as is. Unlike a
+// StringSlice it doesn't split the values on commas, which headers can have.
+type stringArray []string
+
+func newStringArray(p *[]string) *stringArray {
+	*p = []string{}
+	return (*stringArray)(p)
+}
+
+func (s *stringArray) String() string {
+	return "[" + strings.Join(*s, ", ") + "]"
+}
+
+func (s *stringArray) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func (s *stringArray) Type() string {
+	return "stringArray"
 }
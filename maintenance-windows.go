@@ -0,0 +1,119 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/maintenance"
+)
+
+// MaintenanceWindows keeps track of the maintenance windows from the config file and
+// the ones added through the API. Only the ones from the config are replaced on a
+// reload.
+type MaintenanceWindows struct {
+	configured []maintenance.Window
+	added      map[string]maintenance.Window
+	mutex      sync.Mutex
+}
+
+func NewMaintenanceWindows(configured []maintenance.Window) *MaintenanceWindows {
+	return &MaintenanceWindows{
+		configured: configured,
+		added:      make(map[string]maintenance.Window),
+	}
+}
+
+// SetConfigured replaces the windows from the config file
+func (m *MaintenanceWindows) SetConfigured(configured []maintenance.Window) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.configured = configured
+}
+
+// Add validates and adds a new window
+func (m *MaintenanceWindows) Add(window maintenance.Window) (maintenance.Window, error) {
+	err := window.Validate()
+	if err != nil {
+		return maintenance.Window{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return maintenance.Window{}, err
+	}
+	window.ID = id
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.added[window.ID] = window
+	return window, nil
+}
+
+// Remove deletes a window added through the API, it tells if the window was found
+func (m *MaintenanceWindows) Remove(id string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, present := m.added[id]
+	delete(m.added, id)
+	return present
+}
+
+// All returns the windows from the config followed by the ones added through the
+// API that aren't over yet, sorted by name
+func (m *MaintenanceWindows) All() []maintenance.Window {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.removeOver(time.Now())
+	var added []maintenance.Window
+	for _, window := range m.added {
+		added = append(added, window)
+	}
+	sort.Sort(windowsByName(added))
+	return append(append([]maintenance.Window{}, m.configured...), added...)
+}
+
+// InMaintenance tells if the check is covered by a window that's active at now
+func (m *MaintenanceWindows) InMaintenance(check checks.AppCheck, now time.Time) bool {
+	for _, window := range m.All() {
+		if window.Matches(check.Cluster, check.App, check.CheckName) && window.IsActive(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClosedBetween returns the windows that ended in (since, now]
+func (m *MaintenanceWindows) ClosedBetween(since, now time.Time) []maintenance.Window {
+	var closed []maintenance.Window
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, window := range m.configured {
+		if window.ClosedBetween(since, now) {
+			closed = append(closed, window)
+		}
+	}
+	// We hold on to the windows that are over till they're reported as closed
+	for _, window := range m.added {
+		if window.ClosedBetween(since, now) {
+			closed = append(closed, window)
+		}
+	}
+	m.removeOver(now)
+	return closed
+}
+
+func (m *MaintenanceWindows) removeOver(now time.Time) {
+	for id, window := range m.added {
+		// Leave the just closed ones for ClosedBetween
+		if window.IsOver(now.Add(-1 * time.Minute)) {
+			delete(m.added, id)
+		}
+	}
+}
+
+type windowsByName []maintenance.Window
+
+func (w windowsByName) Len() int           { return len(w) }
+func (w windowsByName) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
+func (w windowsByName) Less(i, j int) bool { return w[i].Name < w[j].Name }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/maintenance"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceWindowsInMaintenance(t *testing.T) {
+	now := time.Now()
+	windows := NewMaintenanceWindows([]maintenance.Window{
+		maintenance.Window{Name: "patching", CheckName: "min-healthy", Start: now.Add(-1 * time.Minute), End: now.Add(time.Hour)},
+	})
+	_, err := windows.Add(maintenance.Window{Name: "payments", Group: "/payments", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+	assert.NoError(t, err)
+
+	assert.True(t, windows.InMaintenance(checks.AppCheck{App: "/foo", CheckName: "min-healthy"}, now))
+	assert.False(t, windows.InMaintenance(checks.AppCheck{App: "/foo", CheckName: "min-instances"}, now))
+	assert.False(t, windows.InMaintenance(checks.AppCheck{App: "/payments/api", CheckName: "min-instances"}, now))
+	assert.True(t, windows.InMaintenance(checks.AppCheck{App: "/payments/api", CheckName: "min-instances"}, now.Add(90*time.Minute)))
+}
+
+func TestMaintenanceWindowsAddRemoveAndReload(t *testing.T) {
+	now := time.Now()
+	windows := NewMaintenanceWindows([]maintenance.Window{maintenance.Window{Name: "patching", Cron: "0 22 * * 2", Duration: 4 * time.Hour}})
+	_, err := windows.Add(maintenance.Window{Name: "invalid"})
+	assert.Error(t, err)
+	added, err := windows.Add(maintenance.Window{Name: "upgrade", Start: now, End: now.Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, added.ID)
+	assert.Len(t, windows.All(), 2)
+
+	windows.SetConfigured(nil)
+	assert.Equal(t, []maintenance.Window{added}, windows.All())
+	assert.True(t, windows.Remove(added.ID))
+	assert.False(t, windows.Remove(added.ID))
+	assert.Len(t, windows.All(), 0)
+}
+
+func TestMaintenanceWindowsClosedBetween(t *testing.T) {
+	now := time.Now()
+	windows := NewMaintenanceWindows(nil)
+	added, err := windows.Add(maintenance.Window{Name: "upgrade", Start: now.Add(-1 * time.Hour), End: now})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []maintenance.Window{added}, windows.ClosedBetween(now.Add(-5*time.Second), now))
+	assert.Len(t, windows.ClosedBetween(now, now.Add(5*time.Minute)), 0)
+	// The window is over, so it's gone
+	assert.Len(t, windows.All(), 0)
+}
@@ -0,0 +1,60 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScheduleFailsOnInvalidExpressions(t *testing.T) {
+	invalidExpressions := []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	}
+	for _, expression := range invalidExpressions {
+		_, err := ParseSchedule(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	from := time.Date(2016, 3, 10, 15, 36, 4, 0, time.UTC) // Thursday
+	expectations := map[string]time.Time{
+		"* * * * *":      time.Date(2016, 3, 10, 15, 37, 0, 0, time.UTC),
+		"*/15 * * * *":   time.Date(2016, 3, 10, 15, 45, 0, 0, time.UTC),
+		"0 22 * * 2":     time.Date(2016, 3, 15, 22, 0, 0, 0, time.UTC),
+		"30 1 1,15 * *":  time.Date(2016, 3, 15, 1, 30, 0, 0, time.UTC),
+		"0 0 * * 7":      time.Date(2016, 3, 13, 0, 0, 0, 0, time.UTC),
+		"0 9-17/4 * * *": time.Date(2016, 3, 10, 17, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":     time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC).AddDate(4, 0, 0),
+		// Either the 1st of the month or a Monday
+		"0 0 1 * 1": time.Date(2016, 3, 14, 0, 0, 0, 0, time.UTC),
+	}
+	for expression, expected := range expectations {
+		schedule, err := ParseSchedule(expression)
+		assert.NoError(t, err, expression)
+		assert.Equal(t, expected, schedule.Next(from), expression)
+	}
+}
+
+func TestScheduleNextWithoutAMatch(t *testing.T) {
+	schedule, err := ParseSchedule("0 0 30 2 *")
+	assert.NoError(t, err)
+	assert.True(t, schedule.Next(time.Now()).IsZero())
+}
+
+func TestScheduleNextInTimeZone(t *testing.T) {
+	location := time.FixedZone("IST", 5*60*60+30*60)
+	schedule, err := ParseSchedule("0 22 * * *")
+	assert.NoError(t, err)
+	from := time.Date(2016, 3, 10, 15, 36, 4, 0, time.UTC)
+	assert.Equal(t, time.Date(2016, 3, 10, 16, 30, 0, 0, time.UTC), schedule.Next(from.In(location)).UTC())
+}
@@ -0,0 +1,137 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ryanuber/go-glob"
+)
+
+// Window is a period of planned maintenance, during which the matching checks are
+// still evaluated but not notified. It's either a one-off from Start till End, or
+// recurs on the Cron schedule for Duration every time, in TimeZone (defaults to
+// UTC). Empty Cluster, App, Group and CheckName match everything, so a Window with
+// none of them covers the entire system.
+type Window struct {
+	ID   string `yaml:"-" json:"id"`
+	Name string `yaml:"name" json:"name"`
+	// Cluster is matched against the cluster of the check
+	Cluster string `yaml:"cluster" json:"cluster,omitempty"`
+	// App is a glob on the app ID, like /payments/*
+	App string `yaml:"app" json:"app,omitempty"`
+	// Group is a Marathon group, like /payments, which matches every app under it
+	Group     string `yaml:"group" json:"group,omitempty"`
+	CheckName string `yaml:"check" json:"check,omitempty"`
+
+	Start time.Time `yaml:"start" json:"start"`
+	End   time.Time `yaml:"end" json:"end"`
+
+	Cron     string        `yaml:"cron" json:"cron,omitempty"`
+	Duration time.Duration `yaml:"duration" json:"duration,omitempty"`
+	TimeZone string        `yaml:"time-zone" json:"timeZone,omitempty"`
+}
+
+// windowJSON is a Window with the Duration like 30m0s, the way the API takes it
+type windowJSON struct {
+	window
+	Duration string `json:"duration,omitempty"`
+}
+
+// window has the fields of Window without its JSON methods
+type window Window
+
+func (w Window) MarshalJSON() ([]byte, error) {
+	var duration string
+	if w.Duration != 0 {
+		duration = w.Duration.String()
+	}
+	return json.Marshal(windowJSON{window(w), duration})
+}
+
+func (w *Window) UnmarshalJSON(data []byte) error {
+	var decoded windowJSON
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+	*w = Window(decoded.window)
+	if decoded.Duration != "" {
+		w.Duration, err = time.ParseDuration(decoded.Duration)
+		if err != nil {
+			return fmt.Errorf("Expected duration like 30m or 2h - %v", err)
+		}
+	}
+	return nil
+}
+
+func (w *Window) Validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("Expected every maintenance window to have a name")
+	}
+	if w.Cron == "" {
+		if w.Start.IsZero() || w.End.IsZero() || !w.End.After(w.Start) {
+			return fmt.Errorf("Expected maintenance window %s to have either a cron and duration, or an end after its start", w.Name)
+		}
+		return nil
+	}
+	_, err := ParseSchedule(w.Cron)
+	if err != nil {
+		return fmt.Errorf("Invalid cron of maintenance window %s - %v", w.Name, err)
+	}
+	if w.Duration <= 0 {
+		return fmt.Errorf("Expected a positive duration for maintenance window %s but %v found", w.Name, w.Duration)
+	}
+	_, err = time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return fmt.Errorf("Invalid time-zone of maintenance window %s - %v", w.Name, err)
+	}
+	return nil
+}
+
+// Matches tells if the check of the app on the cluster is covered by the window
+func (w *Window) Matches(cluster, app, checkName string) bool {
+	clusterMatches := w.Cluster == "" || w.Cluster == cluster
+	appMatches := w.App == "" || glob.Glob(w.App, app)
+	groupMatches := w.Group == "" || strings.HasPrefix(app, strings.TrimSuffix(w.Group, "/")+"/")
+	checkMatches := w.CheckName == "" || w.CheckName == checkName
+	return clusterMatches && appMatches && groupMatches && checkMatches
+}
+
+// IsActive tells if we're in the window at now
+func (w *Window) IsActive(now time.Time) bool {
+	if w.Cron == "" {
+		return !now.Before(w.Start) && now.Before(w.End)
+	}
+	// The latest occurrence to start within Duration before now, if any
+	start := w.next(now.Add(-w.Duration))
+	return !start.IsZero() && !start.After(now)
+}
+
+// ClosedBetween tells if an occurrence of the window ended in (since, now]
+func (w *Window) ClosedBetween(since, now time.Time) bool {
+	if w.Cron == "" {
+		return w.End.After(since) && !w.End.After(now)
+	}
+	start := w.next(since.Add(-w.Duration))
+	return !start.IsZero() && !start.After(now.Add(-w.Duration))
+}
+
+// IsOver tells if the window won't be active again after now
+func (w *Window) IsOver(now time.Time) bool {
+	return w.Cron == "" && !now.Before(w.End)
+}
+
+// next returns the first start of the window after t, the zero time if there's none
+func (w *Window) next(t time.Time) time.Time {
+	schedule, err := ParseSchedule(w.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	location, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return time.Time{}
+	}
+	return schedule.Next(t.In(location))
+}
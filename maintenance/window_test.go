@@ -0,0 +1,83 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Every Tuesday from 10 PM till 2 AM
+func tuesdayNights() Window {
+	return Window{Name: "patching", Cron: "0 22 * * 2", Duration: 4 * time.Hour}
+}
+
+func TestWindowValidate(t *testing.T) {
+	window := tuesdayNights()
+	assert.NoError(t, window.Validate())
+
+	window.Name = ""
+	assert.EqualError(t, window.Validate(), "Expected every maintenance window to have a name")
+
+	window = tuesdayNights()
+	window.Duration = 0
+	assert.EqualError(t, window.Validate(), "Expected a positive duration for maintenance window patching but 0s found")
+
+	window = tuesdayNights()
+	window.Cron = "0 22 * *"
+	assert.Error(t, window.Validate())
+
+	window = tuesdayNights()
+	window.TimeZone = "Mars/Olympus_Mons"
+	assert.Error(t, window.Validate())
+
+	now := time.Now()
+	assert.NoError(t, (&Window{Name: "upgrade", Start: now, End: now.Add(time.Hour)}).Validate())
+	assert.Error(t, (&Window{Name: "upgrade", Start: now, End: now}).Validate())
+	assert.Error(t, (&Window{Name: "upgrade"}).Validate())
+}
+
+func TestWindowMatches(t *testing.T) {
+	assert.True(t, (&Window{}).Matches("prod", "/foo", "min-healthy"))
+	assert.True(t, (&Window{App: "/payments/*"}).Matches("", "/payments/api", "min-healthy"))
+	assert.False(t, (&Window{App: "/payments/*"}).Matches("", "/search/api", "min-healthy"))
+	assert.True(t, (&Window{Group: "/payments"}).Matches("", "/payments/api", "min-healthy"))
+	assert.True(t, (&Window{Group: "/payments/"}).Matches("", "/payments/backend/db", "min-healthy"))
+	assert.False(t, (&Window{Group: "/payments"}).Matches("", "/payments-v2/api", "min-healthy"))
+	assert.False(t, (&Window{CheckName: "min-instances"}).Matches("", "/foo", "min-healthy"))
+	assert.False(t, (&Window{Cluster: "staging"}).Matches("prod", "/foo", "min-healthy"))
+}
+
+func TestRecurringWindowIsActive(t *testing.T) {
+	window := tuesdayNights()
+	tuesday := time.Date(2016, 3, 15, 0, 0, 0, 0, time.UTC)
+	assert.False(t, window.IsActive(tuesday.Add(21*time.Hour)))
+	assert.True(t, window.IsActive(tuesday.Add(22*time.Hour)))
+	assert.True(t, window.IsActive(tuesday.Add(25*time.Hour)))
+	assert.False(t, window.IsActive(tuesday.Add(26*time.Hour)))
+	assert.False(t, window.IsOver(tuesday.Add(26*time.Hour)))
+}
+
+func TestRecurringWindowInTimeZone(t *testing.T) {
+	window := tuesdayNights()
+	window.TimeZone = "America/New_York"
+	tuesday := time.Date(2016, 3, 15, 0, 0, 0, 0, time.UTC)
+	// 10 PM in New York is 2 AM UTC during EDT
+	assert.False(t, window.IsActive(tuesday.Add(22*time.Hour)))
+	assert.True(t, window.IsActive(tuesday.Add(26*time.Hour)))
+}
+
+func TestWindowClosedBetween(t *testing.T) {
+	window := tuesdayNights()
+	tuesday := time.Date(2016, 3, 15, 0, 0, 0, 0, time.UTC)
+	assert.False(t, window.ClosedBetween(tuesday.Add(24*time.Hour), tuesday.Add(25*time.Hour)))
+	assert.True(t, window.ClosedBetween(tuesday.Add(25*time.Hour), tuesday.Add(26*time.Hour)))
+	assert.False(t, window.ClosedBetween(tuesday.Add(26*time.Hour), tuesday.Add(27*time.Hour)))
+
+	oneOff := Window{Name: "upgrade", Start: tuesday, End: tuesday.Add(time.Hour)}
+	assert.True(t, oneOff.IsActive(tuesday))
+	assert.False(t, oneOff.IsActive(tuesday.Add(time.Hour)))
+	assert.True(t, oneOff.ClosedBetween(tuesday, tuesday.Add(time.Hour)))
+	assert.False(t, oneOff.ClosedBetween(tuesday.Add(time.Hour), tuesday.Add(2*time.Hour)))
+	assert.True(t, oneOff.IsOver(tuesday.Add(time.Hour)))
+}
@@ -0,0 +1,345 @@
+package notifiers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	maps "github.com/ashwanthkumar/golang-utils/maps"
+	"github.com/ashwanthkumar/marathon-alerts/auth"
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+)
+
+// How we talk TLS to the SMTP server - upgrade the connection with STARTTLS, connect
+// over TLS right away (like on port 465) or not at all
+const (
+	EmailTLSStartTLS = "starttls"
+	EmailTLSImplicit = "tls"
+	EmailTLSNone     = "none"
+)
+
+var EmailTLSModes = []string{EmailTLSStartTLS, EmailTLSImplicit, EmailTLSNone}
+
+const DefaultEmailTimeout = 30 * time.Second
+
+// DefaultEmailTemplates are the email we send for a check, the title is the subject.
+// It leaves out the status so the emails of an alert keep the same subject, which
+// some mail clients need to thread them.
+var DefaultEmailTemplates = Templates{
+	Title: `{{if .Cluster}}{{.Cluster}}:{{end}}{{.App}} - {{.CheckName}}`,
+	Body:  `{{.Status}} - {{.Message}}`,
+	Fields: []TemplateField{
+		{Title: "Cluster", Value: `{{.Cluster}}`},
+		{Title: "App", Value: `{{.App}}`},
+		{Title: "Check", Value: `{{.CheckName}}`},
+		{Title: "Result", Value: `{{.Status}}`},
+		{Title: "Times", Value: `{{.Times}}`},
+		{Title: "Open For", Value: `{{if .Duration}}{{.Duration}}{{end}}`},
+		{Title: "Acked By", Value: `{{if .AckedBy}}{{.AckedBy}}{{if .AckComment}} - {{.AckComment}}{{end}}{{end}}`},
+	},
+}
+
+// Email sends every check as an email with a plain text and an HTML body over SMTP.
+// The emails of an alert are threaded - the ones after the first reply to it with the
+// In-Reply-To and References headers.
+type Email struct {
+	// Alias is the name routes match against, defaults to email
+	Alias string
+	// Server is the host:port of the SMTP server, we don't send emails when it's empty
+	Server string
+	// TLS is one of EmailTLSModes, defaults to starttls
+	TLS string
+	// Username and Password authenticate with PLAIN auth when set, Password can be
+	// read from `file:<path>` or `env:<name>`
+	Username string
+	Password string
+	From     string
+	// To is a comma separated list - overriden using alerts.email.to
+	To string
+	// Templates default to DefaultEmailTemplates, apps override them with labels
+	Templates Templates
+	// TLSConfig is optional, like to trust the CA of the SMTP server
+	TLSConfig *tls.Config
+	// Timeout of the whole conversation with the SMTP server, defaults to DefaultEmailTimeout
+	Timeout time.Duration
+
+	mutex sync.Mutex
+	// sent numbers the emails, so an alert notified again with the same check still
+	// gets a new Message-ID
+	sent uint64
+	// Message-IDs of the first emails of the open alerts, once we've sent one the
+	// emails of its alert reply to it
+	threads map[string]bool
+}
+
+func (e *Email) Name() string {
+	if e.Alias != "" {
+		return e.Alias
+	}
+	return "email"
+}
+
+func (e *Email) Notify(check checks.AppCheck) error {
+	var to []string
+	for _, address := range strings.Split(maps.GetString(check.Labels, "alerts.email.to", e.To), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			to = append(to, address)
+		}
+	}
+	if e.Server == "" || len(to) == 0 {
+		return nil
+	}
+	// Addresses go in the headers as they are, a line break would let them add headers
+	for _, address := range append([]string{e.From}, to...) {
+		if strings.ContainsAny(address, "\r\n") {
+			return PermanentError{fmt.Errorf("Expected an email address without line breaks but %q found", address)}
+		}
+	}
+	message, threadID, err := e.message(check, to)
+	if err != nil {
+		return err
+	}
+	err = e.send(to, message)
+	if err == nil {
+		e.sentThread(threadID, check.Result == checks.Resolved)
+	}
+	return err
+}
+
+// message is the email of the check, headers and all, along with the Message-ID of
+// the first email of its alert
+func (e *Email) message(check checks.AppCheck, to []string) ([]byte, string, error) {
+	data := NewTemplateData(check)
+	rendered := renderCheck(e.Templates, DefaultEmailTemplates, data)
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	err := e.writePart(parts, "text/plain; charset=utf-8", []byte(emailText(rendered, check)))
+	if err != nil {
+		return nil, "", err
+	}
+	var html bytes.Buffer
+	err = emailHTMLTemplate.Execute(&html, emailHTMLData{Rendered: rendered, Check: check})
+	if err != nil {
+		return nil, "", err
+	}
+	err = e.writePart(parts, "text/html; charset=utf-8", html.Bytes())
+	if err != nil {
+		return nil, "", err
+	}
+	err = parts.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	date := check.Timestamp
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID, threadID := e.messageIDs(check, date)
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", e.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(rendered.Title)))
+	fmt.Fprintf(&message, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: %s\r\n", messageID)
+	if threadID != "" && threadID != messageID {
+		fmt.Fprintf(&message, "In-Reply-To: %s\r\n", threadID)
+		fmt.Fprintf(&message, "References: %s\r\n", threadID)
+	}
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), threadID, nil
+}
+
+func (e *Email) writePart(parts *multipart.Writer, contentType string, content []byte) error {
+	part, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	encoder := quotedprintable.NewWriter(part)
+	_, err = encoder.Write(content)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// messageIDs returns the Message-ID of the email of the check, and the Message-ID of
+// the first email of its alert, empty when we don't know when the alert was opened.
+// The first email of an alert takes the Message-ID derived from the app, check and
+// when the alert was opened, the ones after it get a new one on every send.
+func (e *Email) messageIDs(check checks.AppCheck, date time.Time) (string, string) {
+	hash := sha1.Sum([]byte(appName(check) + "/" + check.CheckName))
+	alert := hex.EncodeToString(hash[:])[:16]
+	domain := "marathon-alerts"
+	if at := strings.LastIndex(e.From, "@"); at >= 0 {
+		domain = strings.TrimRight(e.From[at+1:], ">")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.sent++
+	messageID := fmt.Sprintf("<%s.%d.%d@%s>", alert, date.UnixNano(), e.sent, domain)
+	if check.OpenedAt.IsZero() {
+		return messageID, ""
+	}
+	threadID := fmt.Sprintf("<%s.%d@%s>", alert, check.OpenedAt.UnixNano(), domain)
+	if check.OpenedAt.Equal(date) && !e.threads[threadID] {
+		return threadID, threadID
+	}
+	return messageID, threadID
+}
+
+// sentThread records that the first email of the alert went out, and forgets it once
+// the alert is resolved
+func (e *Email) sentThread(threadID string, resolved bool) {
+	if threadID == "" {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if resolved {
+		delete(e.threads, threadID)
+		return
+	}
+	if e.threads == nil {
+		e.threads = make(map[string]bool)
+	}
+	e.threads[threadID] = true
+}
+
+func (e *Email) send(to []string, message []byte) error {
+	client, err := e.dial()
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s - %v", e.Server, err)
+	}
+	defer client.Close()
+	if e.Username != "" {
+		password, err := auth.ResolveSecret(e.Password)
+		if err != nil {
+			return err
+		}
+		host, _, _ := net.SplitHostPort(e.Server)
+		err = client.Auth(smtp.PlainAuth("", e.Username, password, host))
+		if err != nil {
+			return fmt.Errorf("Unable to authenticate to %s - %v", e.Server, err)
+		}
+	}
+	err = client.Mail(e.From)
+	if err != nil {
+		return err
+	}
+	for _, address := range to {
+		err = client.Rcpt(address)
+		if err != nil {
+			return err
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = data.Write(message)
+	if err != nil {
+		return err
+	}
+	err = data.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (e *Email) dial() (*smtp.Client, error) {
+	host, _, err := net.SplitHostPort(e.Server)
+	if err != nil {
+		return nil, err
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultEmailTimeout
+	}
+	tlsConfig := e.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: host}
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if e.TLS == EmailTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", e.Server, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", e.Server)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if e.TLS == EmailTLSImplicit || e.TLS == EmailTLSNone {
+		return client, nil
+	}
+	if supported, _ := client.Extension("STARTTLS"); !supported {
+		client.Close()
+		return nil, fmt.Errorf("Expected the server to support STARTTLS")
+	}
+	err = client.StartTLS(tlsConfig)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// emailText is the plain text body - the body, the fields a line each and the links
+func emailText(rendered Rendered, check checks.AppCheck) string {
+	var text bytes.Buffer
+	fmt.Fprintf(&text, "%s\n\n", rendered.Body)
+	for _, field := range rendered.Fields {
+		fmt.Fprintf(&text, "%s: %s\n", field.Title, field.Value)
+	}
+	if check.Link != "" {
+		fmt.Fprintf(&text, "\nApp: %s\n", check.Link)
+	}
+	if check.Runbook != "" {
+		fmt.Fprintf(&text, "Runbook: %s\n", check.Runbook)
+	}
+	return text.String()
+}
+
+type emailHTMLData struct {
+	Rendered
+	Check checks.AppCheck
+}
+
+var emailHTMLTemplate = template.Must(template.New("email").Parse(`<html>
+<body style="font-family: sans-serif; color: #333;">
+<p>{{.Body}}</p>
+<table style="border-collapse: collapse;">
+{{range .Fields}}<tr><th style="text-align: left; padding: 4px 10px 4px 0;">{{.Title}}</th><td style="padding: 4px 0;">{{.Value}}</td></tr>
+{{end}}</table>
+{{if or .Check.Link .Check.Runbook}}<p>{{if .Check.Link}}<a href="{{.Check.Link}}">Open {{.Check.App}}</a>{{end}}{{if and .Check.Link .Check.Runbook}} | {{end}}{{if .Check.Runbook}}<a href="{{.Check.Runbook}}">Runbook</a>{{end}}</p>{{end}}
+</body>
+</html>
+`))
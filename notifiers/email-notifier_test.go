@@ -0,0 +1,263 @@
+package notifiers
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/stretchr/testify/assert"
+)
+
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeSMTP is an SMTP server that takes every message, and advertises STARTTLS
+// without supporting it
+func fakeSMTP(t *testing.T, listener net.Listener) chan smtpMessage {
+	messages := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	return messages
+}
+
+func serveSMTP(conn net.Conn, messages chan smtpMessage) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	var message smtpMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "EHLO"):
+			text.PrintfLine("250-localhost")
+			text.PrintfLine("250 STARTTLS")
+		case strings.HasPrefix(line, "MAIL FROM:"):
+			message.From = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(line, "RCPT TO:"):
+			message.To = append(message.To, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			text.PrintfLine("250 OK")
+		case line == "DATA":
+			text.PrintfLine("354 Go ahead")
+			lines, err := text.ReadDotLines()
+			if err != nil {
+				return
+			}
+			message.Data = strings.Join(lines, "\r\n")
+			text.PrintfLine("250 OK")
+			messages <- message
+			message = smtpMessage{}
+		case line == "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func localListener(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	return listener
+}
+
+func receive(t *testing.T, messages chan smtpMessage) (smtpMessage, *mail.Message) {
+	select {
+	case message := <-messages:
+		parsed, err := mail.ReadMessage(strings.NewReader(message.Data))
+		assert.NoError(t, err)
+		return message, parsed
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected an email")
+		return smtpMessage{}, nil
+	}
+}
+
+func TestEmailSendsTextAndHTML(t *testing.T) {
+	listener := localListener(t)
+	defer listener.Close()
+	messages := fakeSMTP(t, listener)
+
+	email := Email{Server: listener.Addr().String(), TLS: EmailTLSNone, From: "alerts@example.com", To: "ops@example.com"}
+	err := email.Notify(checks.AppCheck{
+		Cluster:   "prod",
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Critical,
+		Message:   "Only 1 are healthy out of total 2",
+		Times:     1,
+		Link:      "http://marathon:8080/ui/#/apps/%2Ffoo",
+	})
+	assert.NoError(t, err)
+
+	message, parsed := receive(t, messages)
+	assert.Equal(t, "alerts@example.com", message.From)
+	assert.Equal(t, []string{"ops@example.com"}, message.To)
+	assert.Equal(t, "prod:/foo - min-healthy", parsed.Header.Get("Subject"))
+	assert.Equal(t, "ops@example.com", parsed.Header.Get("To"))
+	assert.True(t, strings.HasSuffix(parsed.Header.Get("Message-ID"), "@example.com>"))
+	assert.Equal(t, "", parsed.Header.Get("In-Reply-To"))
+	assert.True(t, strings.HasPrefix(parsed.Header.Get("Content-Type"), "multipart/alternative"))
+	body, err := ioutil.ReadAll(parsed.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "Content-Type: text/plain; charset=utf-8")
+	assert.Contains(t, string(body), "Content-Type: text/html; charset=utf-8")
+	assert.Contains(t, string(body), "Critical - Only 1 are healthy out of total 2")
+	assert.Contains(t, string(body), "Check: min-healthy")
+}
+
+func TestEmailThreadsTheEmailsOfAnAlert(t *testing.T) {
+	listener := localListener(t)
+	defer listener.Close()
+	messages := fakeSMTP(t, listener)
+
+	email := Email{Server: listener.Addr().String(), TLS: EmailTLSNone, From: "alerts@example.com", To: "ops@example.com"}
+	opened := time.Now()
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Warning, Timestamp: opened, OpenedAt: opened}
+	assert.NoError(t, email.Notify(check))
+	check.Result = checks.Critical
+	check.Timestamp = opened.Add(1 * time.Minute)
+	assert.NoError(t, email.Notify(check))
+	check.Result = checks.Resolved
+	check.Timestamp = opened.Add(2 * time.Minute)
+	assert.NoError(t, email.Notify(check))
+
+	_, first := receive(t, messages)
+	_, second := receive(t, messages)
+	_, third := receive(t, messages)
+	threadID := first.Header.Get("Message-ID")
+	assert.Equal(t, "", first.Header.Get("In-Reply-To"))
+	assert.Equal(t, threadID, second.Header.Get("In-Reply-To"))
+	assert.Equal(t, threadID, second.Header.Get("References"))
+	assert.Equal(t, threadID, third.Header.Get("In-Reply-To"))
+	assert.NotEqual(t, second.Header.Get("Message-ID"), third.Header.Get("Message-ID"))
+	assert.Equal(t, first.Header.Get("Subject"), third.Header.Get("Subject"))
+}
+
+func TestEmailRepeatsOfACheckGetTheirOwnMessageID(t *testing.T) {
+	listener := localListener(t)
+	defer listener.Close()
+	messages := fakeSMTP(t, listener)
+
+	email := Email{Server: listener.Addr().String(), TLS: EmailTLSNone, From: "alerts@example.com", To: "ops@example.com"}
+	opened := time.Now()
+	// Like an escalation of an alert we haven't checked since it was opened
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical, Timestamp: opened, OpenedAt: opened}
+	assert.NoError(t, email.Notify(check))
+	assert.NoError(t, email.Notify(check))
+	check.OpenedAt = time.Time{}
+	assert.NoError(t, email.Notify(check))
+	assert.NoError(t, email.Notify(check))
+
+	_, first := receive(t, messages)
+	_, second := receive(t, messages)
+	_, third := receive(t, messages)
+	_, fourth := receive(t, messages)
+	threadID := first.Header.Get("Message-ID")
+	assert.NotEqual(t, threadID, second.Header.Get("Message-ID"))
+	assert.Equal(t, threadID, second.Header.Get("In-Reply-To"))
+	assert.NotEqual(t, third.Header.Get("Message-ID"), fourth.Header.Get("Message-ID"))
+}
+
+func TestEmailRejectsLineBreaksInAddresses(t *testing.T) {
+	email := Email{Server: "127.0.0.1:25", TLS: EmailTLSNone, From: "alerts@example.com", To: "ops@example.com"}
+	err := email.Notify(checks.AppCheck{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Critical,
+		Labels:    map[string]string{"alerts.email.to": "ops@example.com\r\nBcc: someone@example.com"},
+	})
+	assert.Error(t, err)
+	assert.True(t, IsPermanent(err))
+
+	email.From = "alerts@example.com\nBcc: someone@example.com"
+	err = email.Notify(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical})
+	assert.Error(t, err)
+	assert.True(t, IsPermanent(err))
+}
+
+func TestEmailRecipientsOverridenFromAppLabels(t *testing.T) {
+	listener := localListener(t)
+	defer listener.Close()
+	messages := fakeSMTP(t, listener)
+
+	email := Email{Server: listener.Addr().String(), TLS: EmailTLSNone, From: "alerts@example.com", To: "ops@example.com"}
+	err := email.Notify(checks.AppCheck{
+		App:       "/payments/api",
+		CheckName: "min-healthy",
+		Result:    checks.Critical,
+		Labels:    map[string]string{"alerts.email.to": "payments@example.com, oncall@example.com"},
+	})
+	assert.NoError(t, err)
+
+	message, _ := receive(t, messages)
+	assert.Equal(t, []string{"payments@example.com", "oncall@example.com"}, message.To)
+}
+
+func TestEmailOverImplicitTLS(t *testing.T) {
+	// Borrow the self-signed certificate of httptest
+	server := httptest.NewUnstartedServer(nil)
+	server.StartTLS()
+	certificates := server.TLS.Certificates
+	server.Close()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certificates})
+	assert.NoError(t, err)
+	defer listener.Close()
+	messages := fakeSMTP(t, listener)
+
+	email := Email{
+		Server:    listener.Addr().String(),
+		TLS:       EmailTLSImplicit,
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+		From:      "alerts@example.com",
+		To:        "ops@example.com",
+	}
+	err = email.Notify(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical})
+	assert.NoError(t, err)
+	message, _ := receive(t, messages)
+	assert.Equal(t, []string{"ops@example.com"}, message.To)
+}
+
+func TestEmailFailsWhenSTARTTLSFails(t *testing.T) {
+	listener := localListener(t)
+	defer listener.Close()
+	fakeSMTP(t, listener)
+
+	email := Email{Server: listener.Addr().String(), From: "alerts@example.com", To: "ops@example.com", Timeout: 5 * time.Second}
+	err := email.Notify(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical})
+	assert.Error(t, err)
+}
+
+func TestEmailDoesNotSendWithoutServerOrRecipients(t *testing.T) {
+	email := Email{To: "ops@example.com"}
+	assert.NoError(t, email.Notify(checks.AppCheck{App: "/foo", Result: checks.Critical}))
+	// Nothing listens on this port, so we'd fail if we tried
+	email = Email{Server: "127.0.0.1:1"}
+	assert.NoError(t, email.Notify(checks.AppCheck{App: "/foo", Result: checks.Critical}))
+}
+
+func TestEmailIsRoutableByName(t *testing.T) {
+	assert.Equal(t, "email", (&Email{}).Name())
+	assert.Equal(t, "team-a-email", (&Email{Alias: "team-a-email"}).Name())
+}
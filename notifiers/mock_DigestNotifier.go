@@ -0,0 +1,19 @@
+package notifiers
+
+type MockDigestNotifier struct {
+	MockNotifier
+}
+
+// NotifyDigest provides a mock function with given fields: digest
+func (_m *MockDigestNotifier) NotifyDigest(digest Digest) error {
+	ret := _m.Called(digest)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(Digest) error); ok {
+		r0 = rf(digest)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -9,8 +9,17 @@ type MockNotifier struct {
 }
 
 // Notify provides a mock function with given fields: check
-func (_m *MockNotifier) Notify(check checks.AppCheck) {
-	_m.Called(check)
+func (_m *MockNotifier) Notify(check checks.AppCheck) error {
+	ret := _m.Called(check)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(checks.AppCheck) error); ok {
+		r0 = rf(check)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
 }
 
 // Name provides a mock function with given fields:
@@ -2,7 +2,68 @@ package notifiers
 
 import "github.com/ashwanthkumar/marathon-alerts/checks"
 
+// Notifier sends a check to wherever it's configured to. Notify returns an error when
+// the check couldn't be sent, so it can be retried.
 type Notifier interface {
-	Notify(check checks.AppCheck)
+	Notify(check checks.AppCheck) error
 	Name() string
 }
+
+// DigestNotifier is a Notifier that can send a batch of checks as a single
+// notification. When alerts are grouped, AlertManager sends them the checks of a
+// group window as a Digest, while the other notifiers get every check right away.
+type DigestNotifier interface {
+	Notifier
+	NotifyDigest(digest Digest) error
+}
+
+// DestinationNotifier is a Notifier that sends a check to more than one destination,
+// like the URLs of a webhook. The Dispatcher sends, retries and dead letters the check
+// to every destination on its own, so a retry doesn't send it again to the ones that
+// already got it.
+type DestinationNotifier interface {
+	Notifier
+	Destinations(check checks.AppCheck) []string
+	NotifyDestination(check checks.AppCheck, destination string) error
+}
+
+// DigestDestinationNotifier is a DigestNotifier that sends a digest to more than one
+// destination, which the Dispatcher sends it to one at a time like a DestinationNotifier
+type DigestDestinationNotifier interface {
+	DigestNotifier
+	DigestDestinations(digest Digest) []string
+	NotifyDigestDestination(digest Digest, destination string) error
+}
+
+// PermanentError is a failure that retrying won't fix, like a webhook answering with
+// a 4xx. The Dispatcher gives up on the notification right away.
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// IsPermanent tells if the error is a PermanentError
+func IsPermanent(err error) bool {
+	_, permanent := err.(PermanentError)
+	return permanent
+}
+
+// Digest is the checks of a group that were notified within a group window, in the
+// order they were notified. GroupBy is what they're grouped on - cluster, group or
+// check, and Group is the value they share, like /payments for group.
+type Digest struct {
+	GroupBy string
+	Group   string
+	Checks  []checks.AppCheck
+}
+
+// appName is the App, prefixed with `Cluster:` when the check has a Cluster
+func appName(check checks.AppCheck) string {
+	if check.Cluster != "" {
+		return check.Cluster + ":" + check.App
+	}
+	return check.App
+}
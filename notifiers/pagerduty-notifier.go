@@ -0,0 +1,159 @@
+package notifiers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	maps "github.com/ashwanthkumar/golang-utils/maps"
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+)
+
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// DefaultPagerDutyTemplates are the event we trigger for a check, the title is the
+// summary and the fields are the custom details. PagerDuty has no body.
+var DefaultPagerDutyTemplates = Templates{
+	Title: `[{{.Status}}] {{if .Cluster}}{{.Cluster}}:{{end}}{{.App}} - {{.Message}}`,
+	Fields: []TemplateField{
+		{Title: "Cluster", Value: `{{.Cluster}}`},
+		{Title: "App", Value: `{{.App}}`},
+		{Title: "Check", Value: `{{.CheckName}}`},
+		{Title: "Result", Value: `{{.Status}}`},
+		{Title: "Message", Value: `{{.Message}}`},
+		{Title: "Times", Value: `{{.Times}}`},
+	},
+}
+
+// PagerDuty sends checks as events to PagerDuty's Events API v2. Warning and Critical
+// checks trigger an incident and Resolved checks resolve it. Since the dedup key is
+// derived from the App and CheckName, the incident follows the state in AlertManager.
+type PagerDuty struct {
+	// Alias is the name routes match against, defaults to pagerduty
+	Alias string
+	// RoutingKey - overriden using alerts.pagerduty.routing-key
+	RoutingKey string
+	// URL of the Events API, defaults to PagerDutyEventsURL
+	URL    string
+	Client *http.Client
+	// Templates default to DefaultPagerDutyTemplates, apps override them with labels
+	Templates Templates
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	Links       []pagerDutyLink   `json:"links,omitempty"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component"`
+	CustomDetails map[string]string `json:"custom_details"`
+}
+
+func (p *PagerDuty) Name() string {
+	if p.Alias != "" {
+		return p.Alias
+	}
+	return "pagerduty"
+}
+
+func (p *PagerDuty) Notify(check checks.AppCheck) error {
+	routingKey := maps.GetString(check.Labels, "alerts.pagerduty.routing-key", p.RoutingKey)
+	if routingKey == "" {
+		return nil
+	}
+	event, ok := p.event(check, routingKey)
+	if !ok {
+		return nil
+	}
+
+	return p.send(event)
+}
+
+func (p *PagerDuty) event(check checks.AppCheck, routingKey string) (pagerDutyEvent, bool) {
+	event := pagerDutyEvent{
+		RoutingKey: routingKey,
+		DedupKey:   p.dedupKey(check),
+	}
+	switch check.Result {
+	case checks.Resolved:
+		event.EventAction = "resolve"
+	case checks.Warning, checks.Critical:
+		event.EventAction = "trigger"
+		message := renderCheck(p.Templates, DefaultPagerDutyTemplates, NewTemplateData(check))
+		event.Payload = &pagerDutyPayload{
+			Summary:       message.Title,
+			Source:        check.App,
+			Severity:      p.resultToSeverity(check.Result),
+			Component:     check.CheckName,
+			CustomDetails: make(map[string]string),
+		}
+		for _, field := range message.Fields {
+			event.Payload.CustomDetails[field.Title] = field.Value
+		}
+		if check.Link != "" {
+			event.Links = append(event.Links, pagerDutyLink{Href: check.Link, Text: appName(check)})
+		}
+		if check.Runbook != "" {
+			event.Links = append(event.Links, pagerDutyLink{Href: check.Runbook, Text: "Runbook"})
+		}
+		if !check.Timestamp.IsZero() {
+			event.Payload.Timestamp = check.Timestamp.Format(time.RFC3339)
+		}
+	default:
+		// PagerDuty has no notion of a passed check, there's nothing to open or close
+		return event, false
+	}
+
+	return event, true
+}
+
+func (p *PagerDuty) send(event pagerDutyEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	url := p.URL
+	if url == "" {
+		url = PagerDutyEventsURL
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("Expected 202 from PagerDuty for %s but got %d", event.DedupKey, resp.StatusCode)
+	}
+	return nil
+}
+
+func (p *PagerDuty) dedupKey(check checks.AppCheck) string {
+	return fmt.Sprintf("marathon-alerts:%s:%s", appName(check), check.CheckName)
+}
+
+func (p *PagerDuty) resultToSeverity(result checks.CheckStatus) string {
+	if result == checks.Critical {
+		return "critical"
+	}
+	return "warning"
+}
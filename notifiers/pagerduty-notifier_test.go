@@ -0,0 +1,126 @@
+package notifiers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/stretchr/testify/assert"
+)
+
+func fakePagerDuty(events *[]pagerDutyEvent) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event pagerDutyEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		*events = append(*events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+}
+
+func TestPagerDutyTriggersAndResolvesWithSameDedupKey(t *testing.T) {
+	var events []pagerDutyEvent
+	server := fakePagerDuty(&events)
+	defer server.Close()
+
+	pagerDuty := PagerDuty{RoutingKey: "global-key", URL: server.URL}
+	check := checks.AppCheck{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Critical,
+		Message:   "Only 0 are healthy out of total 1",
+		Times:     1,
+	}
+	pagerDuty.Notify(check)
+	check.Result = checks.Resolved
+	pagerDuty.Notify(check)
+
+	assert.Len(t, events, 2)
+	assert.Equal(t, "trigger", events[0].EventAction)
+	assert.Equal(t, "global-key", events[0].RoutingKey)
+	assert.Equal(t, "marathon-alerts:/foo:min-healthy", events[0].DedupKey)
+	assert.Equal(t, "critical", events[0].Payload.Severity)
+	assert.Equal(t, "/foo", events[0].Payload.Source)
+	assert.Equal(t, "min-healthy", events[0].Payload.Component)
+	assert.Equal(t, "[Critical] /foo - Only 0 are healthy out of total 1", events[0].Payload.Summary)
+
+	assert.Equal(t, "resolve", events[1].EventAction)
+	assert.Equal(t, events[0].DedupKey, events[1].DedupKey)
+	assert.Nil(t, events[1].Payload)
+}
+
+func TestPagerDutyDedupKeyHasCluster(t *testing.T) {
+	var events []pagerDutyEvent
+	server := fakePagerDuty(&events)
+	defer server.Close()
+
+	pagerDuty := PagerDuty{RoutingKey: "global-key", URL: server.URL}
+	pagerDuty.Notify(checks.AppCheck{Cluster: "prod", App: "/foo", CheckName: "min-healthy", Result: checks.Critical, Message: "Down"})
+
+	assert.Len(t, events, 1)
+	assert.Equal(t, "marathon-alerts:prod:/foo:min-healthy", events[0].DedupKey)
+	assert.Equal(t, "[Critical] prod:/foo - Down", events[0].Payload.Summary)
+	assert.Equal(t, "prod", events[0].Payload.CustomDetails["Cluster"])
+}
+
+func TestPagerDutyEventLinksToTheAppAndRunbook(t *testing.T) {
+	var events []pagerDutyEvent
+	server := fakePagerDuty(&events)
+	defer server.Close()
+
+	pagerDuty := PagerDuty{RoutingKey: "global-key", URL: server.URL}
+	pagerDuty.Notify(checks.AppCheck{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Critical,
+		Message:   "Down",
+		Link:      "http://marathon:8080/ui/#/apps/%2Ffoo",
+		Runbook:   "https://wiki.example.com/runbooks/min-healthy",
+	})
+
+	assert.Len(t, events, 1)
+	assert.Equal(t, []pagerDutyLink{
+		{Href: "http://marathon:8080/ui/#/apps/%2Ffoo", Text: "/foo"},
+		{Href: "https://wiki.example.com/runbooks/min-healthy", Text: "Runbook"},
+	}, events[0].Links)
+}
+
+func TestPagerDutyRoutingKeyOverridenFromAppLabels(t *testing.T) {
+	var events []pagerDutyEvent
+	server := fakePagerDuty(&events)
+	defer server.Close()
+
+	appLabels := make(map[string]string)
+	appLabels["alerts.pagerduty.routing-key"] = "app-key"
+	pagerDuty := PagerDuty{URL: server.URL}
+	pagerDuty.Notify(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Warning, Labels: appLabels})
+
+	assert.Len(t, events, 1)
+	assert.Equal(t, "app-key", events[0].RoutingKey)
+	assert.Equal(t, "warning", events[0].Payload.Severity)
+}
+
+func TestPagerDutyDoesNotSendWithoutRoutingKeyOrForPass(t *testing.T) {
+	var events []pagerDutyEvent
+	server := fakePagerDuty(&events)
+	defer server.Close()
+
+	pagerDuty := PagerDuty{URL: server.URL}
+	pagerDuty.Notify(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical})
+	pagerDuty.RoutingKey = "global-key"
+	pagerDuty.Notify(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Pass})
+
+	assert.Len(t, events, 0)
+}
+
+func TestPagerDutySendFailsOnUnexpectedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	pagerDuty := PagerDuty{URL: server.URL}
+	err := pagerDuty.send(pagerDutyEvent{RoutingKey: "key", EventAction: "resolve", DedupKey: "dedup"})
+	assert.Error(t, err)
+}
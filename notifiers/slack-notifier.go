@@ -9,27 +9,55 @@ import (
 	"github.com/ashwanthkumar/slack-go-webhook"
 )
 
+// DefaultSlackTemplates are the message the Slack notifier posts for a check, the
+// title is the text and the body is the text of the attachment
+var DefaultSlackTemplates = Templates{
+	Title: `{{.Owners}}, {{if eq .Status "Resolved"}}Check Resolved, thanks!{{else if eq .Status "Passed"}}Check Passed{{else}}Please check!{{end}}`,
+	Body:  `{{.Message}}`,
+	Fields: []TemplateField{
+		{Title: "Cluster", Value: `{{.Cluster}}`, Short: true},
+		{Title: "App", Value: `{{.App}}`, Short: true},
+		{Title: "Check", Value: `{{.CheckName}}`, Short: true},
+		{Title: "Result", Value: `{{.Status}}`, Short: true},
+		{Title: "Times", Value: `{{.Times}}`, Short: true},
+		{Title: "Acked By", Value: `{{if .AckedBy}}{{.AckedBy}}{{if .AckComment}} - {{.AckComment}}{{end}}{{end}}`},
+	},
+}
+
 type Slack struct {
+	// Alias is the name routes match against, defaults to slack
+	Alias   string
 	Webhook string
 	Channel string
 	Owners  string
+	// Templates default to DefaultSlackTemplates, apps override them with labels
+	Templates Templates
 }
 
 func (s *Slack) Name() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
 	return "slack"
 }
 
-func (s *Slack) Notify(check checks.AppCheck) {
-	attachment := slack.Attachment{
-		Text:  &check.Message,
-		Color: s.resultToColor(check.Result),
+func (s *Slack) Notify(check checks.AppCheck) error {
+	var lastErr error
+	for _, webhook := range s.Destinations(check) {
+		if err := s.NotifyDestination(check, webhook); err != nil {
+			lastErr = err
+		}
 	}
-	attachment.
-		AddField(slack.Field{Title: "App", Value: check.App, Short: true}).
-		AddField(slack.Field{Title: "Check", Value: check.CheckName, Short: true}).
-		AddField(slack.Field{Title: "Result", Value: checks.CheckStatusToString(check.Result), Short: true}).
-		AddField(slack.Field{Title: "Times", Value: fmt.Sprintf("%d", check.Times), Short: true})
+	return lastErr
+}
 
+// Destinations are the webhooks the check is posted to
+func (s *Slack) Destinations(check checks.AppCheck) []string {
+	return splitWebhooks(maps.GetString(check.Labels, "alerts.slack.webhook", s.Webhook))
+}
+
+// NotifyDestination posts the check to one of its webhooks
+func (s *Slack) NotifyDestination(check checks.AppCheck, webhook string) error {
 	destination := maps.GetString(check.Labels, "alerts.slack.channel", s.Channel)
 
 	appSpecificOwners := maps.GetString(check.Labels, "alerts.slack.owners", s.Owners)
@@ -40,28 +68,195 @@ func (s *Slack) Notify(check checks.AppCheck) {
 		owners = []string{"@here"}
 	}
 
-	alertSuffix := "Please check!"
-	if check.Result == checks.Resolved {
-		alertSuffix = "Check Resolved, thanks!"
-	} else if check.Result == checks.Pass {
-		alertSuffix = "Check Passed"
+	data := NewTemplateData(check)
+	data.Owners = s.parseOwners(owners)
+	message := renderCheck(s.Templates, DefaultSlackTemplates, data)
+	title := appName(check) + " - " + check.CheckName
+	attachment := slack.Attachment{
+		Title: &title,
+		Text:  &message.Body,
+		Color: s.resultToColor(check.Result),
+	}
+	if check.Link != "" {
+		attachment.TitleLink = &check.Link
+	}
+	for _, field := range message.Fields {
+		attachment.AddField(slack.Field{Title: field.Title, Value: field.Value, Short: field.Short})
+	}
+	attachments := []slack.Attachment{attachment}
+	if check.Runbook != "" {
+		runbook := "Runbook"
+		attachments = append(attachments, slack.Attachment{
+			Title:     &runbook,
+			TitleLink: &check.Runbook,
+			Color:     attachment.Color,
+		})
 	}
-	mainText := fmt.Sprintf("%s, %s", s.parseOwners(owners), alertSuffix)
 
-	payload := slack.Payload(mainText,
+	payload := slack.Payload(message.Title,
 		"marathon-alerts",
 		"",
 		destination,
-		[]slack.Attachment{attachment})
+		attachments)
+	return s.send(webhook, payload)
+}
+
+// NotifyDigest posts the checks as one message to every channel they go to, with a
+// field for every check laid out two to a row
+func (s *Slack) NotifyDigest(digest Digest) error {
+	var lastErr error
+	for _, webhook := range s.DigestDestinations(digest) {
+		if err := s.NotifyDigestDestination(digest, webhook); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// DigestDestinations are the webhooks any of the checks of the digest are posted to
+func (s *Slack) DigestDestinations(digest Digest) []string {
+	var webhooks []string
+	for _, destination := range s.digestDestinations(digest.Checks) {
+		for _, webhook := range splitWebhooks(destination.webhooks) {
+			if !containsString(webhooks, webhook) {
+				webhooks = append(webhooks, webhook)
+			}
+		}
+	}
+	return webhooks
+}
+
+// NotifyDigestDestination posts the checks of the digest that go to the webhook, a
+// message for every channel they go to
+func (s *Slack) NotifyDigestDestination(digest Digest, webhook string) error {
+	for _, destination := range s.digestDestinations(digest.Checks) {
+		if !containsString(splitWebhooks(destination.webhooks), webhook) {
+			continue
+		}
+		worst := checks.Resolved
+		for _, check := range destination.checks {
+			if check.Result < worst {
+				worst = check.Result
+			}
+		}
+		title := fmt.Sprintf("%d alerts for %s %s", len(destination.checks), digest.GroupBy, digest.Group)
+		if digest.Group == "" {
+			title = fmt.Sprintf("%d alerts", len(destination.checks))
+		}
+		attachment := slack.Attachment{
+			Title:    &title,
+			Fallback: &title,
+			Color:    s.resultToColor(worst),
+		}
+		for _, check := range destination.checks {
+			attachment.AddField(s.digestField(check))
+		}
+
+		owners := []string{"@here"}
+		if len(destination.owners) > 0 {
+			owners = destination.owners
+		}
+		mainText := fmt.Sprintf("%s, Please check!", s.parseOwners(owners))
+		if worst == checks.Resolved || worst == checks.Pass {
+			mainText = fmt.Sprintf("%s, Checks Resolved, thanks!", s.parseOwners(owners))
+		}
+		payload := slack.Payload(mainText,
+			"marathon-alerts",
+			"",
+			destination.channel,
+			[]slack.Attachment{attachment})
+		if err := s.send(webhook, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Slack) send(webhook string, payload map[string]interface{}) error {
+	errs := slack.Send(webhook, "", payload)
+	if errs != nil {
+		return fmt.Errorf("Unable to post to Slack - %v", errs)
+	}
+	return nil
+}
+
+// splitWebhooks splits the comma separated webhooks, leaving out the empty ones
+func splitWebhooks(webhooks string) []string {
+	var split []string
+	for _, webhook := range strings.Split(webhooks, ",") {
+		if webhook = strings.TrimSpace(webhook); webhook != "" {
+			split = append(split, webhook)
+		}
+	}
+	return split
+}
 
-	webhooks := strings.Split(maps.GetString(check.Labels, "alerts.slack.webhook", s.Webhook), ",")
+// slackDestination is where a part of a digest goes, since apps can pick their own
+// webhooks, channel and owners with labels
+type slackDestination struct {
+	webhooks string
+	channel  string
+	owners   []string
+	checks   []checks.AppCheck
+}
+
+// digestDestinations splits the checks by the webhooks and channel they go to, in the
+// order they first show up. The owners of all the checks in a destination are tagged.
+func (s *Slack) digestDestinations(allChecks []checks.AppCheck) []*slackDestination {
+	var destinations []*slackDestination
+	for _, check := range allChecks {
+		webhooks := maps.GetString(check.Labels, "alerts.slack.webhook", s.Webhook)
+		channel := maps.GetString(check.Labels, "alerts.slack.channel", s.Channel)
+		var destination *slackDestination
+		for _, existing := range destinations {
+			if existing.webhooks == webhooks && existing.channel == channel {
+				destination = existing
+				break
+			}
+		}
+		if destination == nil {
+			destination = &slackDestination{webhooks: webhooks, channel: channel}
+			destinations = append(destinations, destination)
+		}
+		destination.checks = append(destination.checks, check)
+
+		appSpecificOwners := maps.GetString(check.Labels, "alerts.slack.owners", s.Owners)
+		if appSpecificOwners == "" {
+			continue
+		}
+		for _, owner := range strings.Split(appSpecificOwners, ",") {
+			if !containsString(destination.owners, owner) {
+				destination.owners = append(destination.owners, owner)
+			}
+		}
+	}
+	return destinations
+}
+
+// digestField is a row of the digest, like `/foo` - `Critical min-healthy - Only 1 healthy`.
+// The check name links to the app and the runbook follows the message, when they're set.
+func (s *Slack) digestField(check checks.AppCheck) slack.Field {
+	checkName := check.CheckName
+	if check.Link != "" {
+		checkName = fmt.Sprintf("<%s|%s>", check.Link, check.CheckName)
+	}
+	value := fmt.Sprintf("%s %s - %s", checks.CheckStatusToString(check.Result), checkName, check.Message)
+	if check.Runbook != "" {
+		value += fmt.Sprintf(" <%s|Runbook>", check.Runbook)
+	}
+	if check.AckedBy != "" {
+		value += fmt.Sprintf(" (acked by %s)", check.AckedBy)
+	}
+	return slack.Field{Title: appName(check), Value: value, Short: true}
+}
 
-	for _, webhook := range webhooks {
-		err := slack.Send(webhook, "", payload)
-		if err != nil {
-			fmt.Printf("Unexpected Error - %v", err)
+func containsString(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
 		}
 	}
+	return false
 }
 
 func (s *Slack) resultToColor(result checks.CheckStatus) *string {
@@ -15,3 +15,48 @@ func TestResultToColor(t *testing.T) {
 	assert.Equal(t, "danger", *slack.resultToColor(checks.Critical))
 	assert.Equal(t, "black", *slack.resultToColor(127))
 }
+
+func TestSlackDigestDestinations(t *testing.T) {
+	slack := Slack{Webhook: "https://hooks.slack.com/default", Channel: "#alerts", Owners: "ashwanthkumar"}
+	foo := checks.AppCheck{App: "/foo"}
+	bar := checks.AppCheck{App: "/bar", Labels: map[string]string{"alerts.slack.owners": "slackbot,ashwanthkumar"}}
+	payments := checks.AppCheck{App: "/payments", Labels: map[string]string{"alerts.slack.channel": "#payments"}}
+
+	destinations := slack.digestDestinations([]checks.AppCheck{foo, payments, bar})
+	assert.Len(t, destinations, 2)
+	assert.Equal(t, "#alerts", destinations[0].channel)
+	assert.Equal(t, []checks.AppCheck{foo, bar}, destinations[0].checks)
+	assert.Equal(t, []string{"ashwanthkumar", "slackbot"}, destinations[0].owners)
+	assert.Equal(t, "#payments", destinations[1].channel)
+	assert.Equal(t, "https://hooks.slack.com/default", destinations[1].webhooks)
+	assert.Equal(t, []checks.AppCheck{payments}, destinations[1].checks)
+}
+
+func TestSlackDigestField(t *testing.T) {
+	slack := Slack{}
+	field := slack.digestField(checks.AppCheck{
+		Cluster:   "prod",
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Critical,
+		Message:   "Only 1 healthy",
+		AckedBy:   "ashwanthkumar",
+	})
+	assert.Equal(t, "prod:/foo", field.Title)
+	assert.Equal(t, "Critical min-healthy - Only 1 healthy (acked by ashwanthkumar)", field.Value)
+	assert.True(t, field.Short)
+}
+
+func TestSlackDigestFieldLinksToTheAppAndRunbook(t *testing.T) {
+	slack := Slack{}
+	field := slack.digestField(checks.AppCheck{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Critical,
+		Message:   "Only 1 healthy",
+		Link:      "http://marathon:8080/ui/#/apps/%2Ffoo",
+		Runbook:   "https://wiki.example.com/runbooks/min-healthy",
+	})
+	assert.Equal(t, "/foo", field.Title)
+	assert.Equal(t, "Critical <http://marathon:8080/ui/#/apps/%2Ffoo|min-healthy> - Only 1 healthy <https://wiki.example.com/runbooks/min-healthy|Runbook>", field.Value)
+}
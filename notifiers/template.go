@@ -0,0 +1,203 @@
+package notifiers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	maps "github.com/ashwanthkumar/golang-utils/maps"
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+)
+
+// Apps override the templates of every notifier with these labels. The fields are a
+// comma separated list of titles, the value of each is the alerts.template.field.<title>
+// label, or the notifier's field of that title.
+const (
+	TitleTemplateLabel       = "alerts.template.title"
+	BodyTemplateLabel        = "alerts.template.body"
+	FieldsTemplateLabel      = "alerts.template.fields"
+	FieldTemplateLabelPrefix = "alerts.template.field."
+)
+
+// Templates are the text/templates of what a notifier sends for a check, they're
+// executed with a TemplateData. The empty ones fall back to the notifier's defaults.
+type Templates struct {
+	Title  string          `yaml:"title"`
+	Body   string          `yaml:"body"`
+	Fields []TemplateField `yaml:"fields"`
+}
+
+// TemplateField is a titled value sent along with the body, fields whose value renders
+// to nothing are left out
+type TemplateField struct {
+	Title string `yaml:"title"`
+	Value string `yaml:"value"`
+	Short bool   `yaml:"short"`
+}
+
+// TemplateData is what the templates are executed with
+type TemplateData struct {
+	checks.AppCheck
+	// Status is one of Passed, Resolved, Warning or Critical
+	Status string
+	// Duration is how long the alert has been open, or was open once it's resolved.
+	// It's 0 when we don't know when it was opened.
+	Duration time.Duration
+	// Owners are who the notifier tags, like `@ashwanthkumar, @here` on Slack
+	Owners string
+}
+
+// Rendered is a check rendered with Templates
+type Rendered struct {
+	Title  string
+	Body   string
+	Fields []TemplateField
+}
+
+// NewTemplateData is the data of the check, without Owners
+func NewTemplateData(check checks.AppCheck) TemplateData {
+	data := TemplateData{AppCheck: check, Status: checks.CheckStatusToString(check.Result)}
+	if !check.OpenedAt.IsZero() && check.Timestamp.After(check.OpenedAt) {
+		data.Duration = check.Timestamp.Sub(check.OpenedAt) / time.Second * time.Second
+	}
+	return data
+}
+
+// WithDefaults fills the empty templates from the defaults
+func (t Templates) WithDefaults(defaults Templates) Templates {
+	if t.Title == "" {
+		t.Title = defaults.Title
+	}
+	if t.Body == "" {
+		t.Body = defaults.Body
+	}
+	if len(t.Fields) == 0 {
+		t.Fields = defaults.Fields
+	}
+	return t
+}
+
+// OverriddenBy returns the templates with the ones set in the alerts.template.* labels
+func (t Templates) OverriddenBy(labels map[string]string) (Templates, error) {
+	t.Title = maps.GetString(labels, TitleTemplateLabel, t.Title)
+	t.Body = maps.GetString(labels, BodyTemplateLabel, t.Body)
+	titles := maps.GetString(labels, FieldsTemplateLabel, "")
+	if titles == "" {
+		return t, nil
+	}
+	var fields []TemplateField
+	for _, title := range strings.Split(titles, ",") {
+		title = strings.TrimSpace(title)
+		if value, present := labels[FieldTemplateLabelPrefix+title]; present {
+			fields = append(fields, TemplateField{Title: title, Value: value, Short: true})
+			continue
+		}
+		field, present := t.field(title)
+		if !present {
+			return t, fmt.Errorf("Expected a %s%s label for the field %s", FieldTemplateLabelPrefix, title, title)
+		}
+		fields = append(fields, field)
+	}
+	t.Fields = fields
+	return t, nil
+}
+
+func (t Templates) field(title string) (TemplateField, bool) {
+	for _, field := range t.Fields {
+		if field.Title == title {
+			return field, true
+		}
+	}
+	return TemplateField{}, false
+}
+
+// Validate parses the templates and executes them with a sample check, so the ones that
+// can't be rendered are caught before we need them
+func (t Templates) Validate() error {
+	_, err := t.Render(NewTemplateData(checks.AppCheck{
+		Cluster:   "prod",
+		App:       "/sample",
+		CheckName: "min-healthy",
+		Result:    checks.Critical,
+		Message:   "Only 0 are healthy out of total 1",
+		Timestamp: time.Now(),
+		Labels:    map[string]string{},
+		Times:     1,
+	}))
+	return err
+}
+
+// Render executes the templates with the data
+func (t Templates) Render(data TemplateData) (Rendered, error) {
+	var rendered Rendered
+	var err error
+	rendered.Title, err = render("title", t.Title, data)
+	if err != nil {
+		return rendered, err
+	}
+	rendered.Body, err = render("body", t.Body, data)
+	if err != nil {
+		return rendered, err
+	}
+	for _, field := range t.Fields {
+		value, err := render("field "+field.Title, field.Value, data)
+		if err != nil {
+			return rendered, err
+		}
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		rendered.Fields = append(rendered.Fields, TemplateField{Title: field.Title, Value: value, Short: field.Short})
+	}
+	return rendered, nil
+}
+
+func render(name, text string, data TemplateData) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("Invalid %s template - %v", name, err)
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, data)
+	if err != nil {
+		return "", fmt.Errorf("Unable to render the %s template - %v", name, err)
+	}
+	return out.String(), nil
+}
+
+// renderCheck renders the check with the templates, as overridden by the labels of the
+// app. Broken label templates fall back to the templates, and templates that fail to
+// render to the defaults.
+func renderCheck(templates, defaults Templates, data TemplateData) Rendered {
+	templates = templates.WithDefaults(defaults)
+	if hasTemplateLabels(data.Labels) {
+		appTemplates, err := templates.OverriddenBy(data.Labels)
+		if err == nil {
+			var rendered Rendered
+			rendered, err = appTemplates.Render(data)
+			if err == nil {
+				return rendered
+			}
+		}
+		log.Printf("Error - Unable to use the alerts.template labels of %s, falling back to the notifier's templates - %v\n", data.App, err)
+	}
+	rendered, err := templates.Render(data)
+	if err == nil {
+		return rendered
+	}
+	log.Printf("Error - Unable to render %s, falling back to the default templates - %v\n", data.App, err)
+	rendered, _ = defaults.Render(data)
+	return rendered
+}
+
+func hasTemplateLabels(labels map[string]string) bool {
+	for label := range labels {
+		if strings.HasPrefix(label, "alerts.template.") {
+			return true
+		}
+	}
+	return false
+}
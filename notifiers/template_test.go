@@ -0,0 +1,92 @@
+package notifiers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultSlackTemplates(t *testing.T) {
+	data := NewTemplateData(checks.AppCheck{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Critical,
+		Message:   "Only 1 are healthy out of total 2",
+		Times:     2,
+	})
+	data.Owners = "@ashwanthkumar"
+	rendered, err := DefaultSlackTemplates.Render(data)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "@ashwanthkumar, Please check!", rendered.Title)
+	assert.Equal(t, "Only 1 are healthy out of total 2", rendered.Body)
+	// Cluster and Acked By are empty, so they're left out
+	assert.Equal(t, []TemplateField{
+		{Title: "App", Value: "/foo", Short: true},
+		{Title: "Check", Value: "min-healthy", Short: true},
+		{Title: "Result", Value: "Critical", Short: true},
+		{Title: "Times", Value: "2", Short: true},
+	}, rendered.Fields)
+
+	data.Result = checks.Resolved
+	data.Status = checks.CheckStatusToString(checks.Resolved)
+	rendered, err = DefaultSlackTemplates.Render(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "@ashwanthkumar, Check Resolved, thanks!", rendered.Title)
+}
+
+func TestTemplateDataHasTheAlertDuration(t *testing.T) {
+	opened := time.Now()
+	data := NewTemplateData(checks.AppCheck{OpenedAt: opened, Timestamp: opened.Add(90*time.Minute + 500*time.Millisecond)})
+	assert.Equal(t, 90*time.Minute, data.Duration)
+
+	data = NewTemplateData(checks.AppCheck{Timestamp: opened})
+	assert.Equal(t, time.Duration(0), data.Duration)
+}
+
+func TestTemplatesOverriddenByLabels(t *testing.T) {
+	templates := Templates{Title: "{{.App}} is down", Body: "{{.Message}}"}.WithDefaults(DefaultSlackTemplates)
+	overridden, err := templates.OverriddenBy(map[string]string{
+		BodyTemplateLabel:                 "{{.Message}}, see the runbook",
+		FieldsTemplateLabel:               "Team,Check",
+		FieldTemplateLabelPrefix + "Team": `{{index .Labels "team"}}`,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "{{.App}} is down", overridden.Title)
+	assert.Equal(t, "{{.Message}}, see the runbook", overridden.Body)
+	assert.Equal(t, []TemplateField{
+		{Title: "Team", Value: `{{index .Labels "team"}}`, Short: true},
+		{Title: "Check", Value: "{{.CheckName}}", Short: true},
+	}, overridden.Fields)
+
+	_, err = templates.OverriddenBy(map[string]string{FieldsTemplateLabel: "Team"})
+	assert.EqualError(t, err, "Expected a alerts.template.field.Team label for the field Team")
+}
+
+func TestRenderCheckFallsBackOnBrokenTemplates(t *testing.T) {
+	templates := Templates{Title: "{{.App}} is down"}
+	data := NewTemplateData(checks.AppCheck{
+		App:    "/foo",
+		Labels: map[string]string{TitleTemplateLabel: "{{.App"},
+	})
+	rendered := renderCheck(templates, DefaultPagerDutyTemplates, data)
+	assert.Equal(t, "/foo is down", rendered.Title)
+
+	templates = Templates{Title: "{{index .Labels 1}}"}
+	data.Labels = nil
+	rendered = renderCheck(templates, DefaultPagerDutyTemplates, data)
+	assert.Equal(t, "[Unknown] /foo - ", rendered.Title)
+}
+
+func TestTemplatesValidate(t *testing.T) {
+	assert.NoError(t, DefaultSlackTemplates.Validate())
+	assert.NoError(t, DefaultPagerDutyTemplates.Validate())
+	assert.NoError(t, Templates{}.Validate())
+	err := Templates{Title: "{{.App"}.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid title template")
+	assert.Error(t, Templates{Fields: []TemplateField{{Title: "Hosts", Value: "{{.Hosts}}"}}}.Validate())
+}
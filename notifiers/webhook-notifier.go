@@ -0,0 +1,150 @@
+package notifiers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	maps "github.com/ashwanthkumar/golang-utils/maps"
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+)
+
+const WebhookSignatureHeader = "X-Marathon-Alerts-Signature"
+
+// WebhookPayload is the JSON document we POST for every check
+type WebhookPayload struct {
+	Cluster   string            `json:"cluster,omitempty"`
+	App       string            `json:"app"`
+	CheckName string            `json:"check"`
+	Status    string            `json:"status"`
+	Message   string            `json:"message"`
+	Timestamp time.Time         `json:"timestamp"`
+	Times     int               `json:"times"`
+	Labels    map[string]string `json:"labels"`
+	Link      string            `json:"link,omitempty"`
+	Runbook   string            `json:"runbook,omitempty"`
+	// AckedBy and AckComment are set once someone acked the alert
+	AckedBy    string `json:"ackedBy,omitempty"`
+	AckComment string `json:"ackComment,omitempty"`
+}
+
+// Webhook POSTs every check as a WebhookPayload to one or more URLs. When a Secret is
+// set, the hex encoded HMAC-SHA256 of the body is sent as `sha256=<hmac>` in the
+// X-Marathon-Alerts-Signature header. Every URL is a destination of its own, the
+// Dispatcher retries the ones that fail - except on a 4xx, which is a PermanentError.
+type Webhook struct {
+	// Alias is the name routes match against, defaults to webhook
+	Alias string
+	// URLs is a comma separated list - overriden using alerts.webhook.urls
+	URLs    string
+	Headers map[string]string
+	Secret  string
+	Client  *http.Client
+}
+
+func (w *Webhook) Name() string {
+	if w.Alias != "" {
+		return w.Alias
+	}
+	return "webhook"
+}
+
+// Notify posts the check to every URL, it returns the error of the last one that failed
+func (w *Webhook) Notify(check checks.AppCheck) error {
+	var lastErr error
+	for _, url := range w.Destinations(check) {
+		err := w.NotifyDestination(check, url)
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Destinations are the URLs the check is posted to
+func (w *Webhook) Destinations(check checks.AppCheck) []string {
+	return splitWebhooks(maps.GetString(check.Labels, "alerts.webhook.urls", w.URLs))
+}
+
+// NotifyDestination posts the check to the URL once
+func (w *Webhook) NotifyDestination(check checks.AppCheck, url string) error {
+	body, err := json.Marshal(w.payload(check))
+	if err != nil {
+		return err
+	}
+	return w.post(url, body)
+}
+
+func (w *Webhook) payload(check checks.AppCheck) WebhookPayload {
+	return WebhookPayload{
+		Cluster:    check.Cluster,
+		App:        check.App,
+		CheckName:  check.CheckName,
+		Status:     checks.CheckStatusToString(check.Result),
+		Message:    check.Message,
+		Timestamp:  check.Timestamp,
+		Times:      check.Times,
+		Labels:     check.Labels,
+		Link:       check.Link,
+		Runbook:    check.Runbook,
+		AckedBy:    check.AckedBy,
+		AckComment: check.AckComment,
+	}
+}
+
+// post sends the body once, the responses other than a 5xx won't change on a retry
+func (w *Webhook) post(url string, body []byte) error {
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return PermanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "marathon-alerts")
+	for name, value := range w.Headers {
+		req.Header.Set(name, value)
+	}
+	if w.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+w.sign(body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("Got %d from %s", resp.StatusCode, url)
+	} else if resp.StatusCode >= 300 {
+		return PermanentError{fmt.Errorf("Got %d from %s", resp.StatusCode, url)}
+	}
+	return nil
+}
+
+func (w *Webhook) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ParseWebhookHeaders parses headers of the form `Name: value`
+func ParseWebhookHeaders(headers []string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for _, header := range headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("Expected header of the form `Name: value` but %s found", header)
+		}
+		parsed[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return parsed, nil
+}
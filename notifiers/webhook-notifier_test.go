@@ -0,0 +1,151 @@
+package notifiers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/routes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookPostsPayload(t *testing.T) {
+	var requests []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+
+	now := time.Date(2016, 3, 10, 15, 36, 4, 0, time.UTC)
+	appLabels := make(map[string]string)
+	appLabels["team"] = "payments"
+	webhook := Webhook{
+		URLs:    server.URL + "/one," + server.URL + "/two",
+		Headers: map[string]string{"X-Token": "secret-token"},
+		Secret:  "hmac-secret",
+	}
+	webhook.Notify(checks.AppCheck{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Result:    checks.Warning,
+		Message:   "Only 59 are healthy out of total 100",
+		Timestamp: now,
+		Times:     2,
+		Labels:    appLabels,
+	})
+
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "/one", requests[0].URL.Path)
+	assert.Equal(t, "/two", requests[1].URL.Path)
+	assert.Equal(t, "application/json", requests[0].Header.Get("Content-Type"))
+	assert.Equal(t, "secret-token", requests[0].Header.Get("X-Token"))
+	assert.Equal(t, "sha256="+webhook.sign(bodies[0]), requests[0].Header.Get(WebhookSignatureHeader))
+
+	var payload WebhookPayload
+	assert.NoError(t, json.Unmarshal(bodies[0], &payload))
+	expectedPayload := WebhookPayload{
+		App:       "/foo",
+		CheckName: "min-healthy",
+		Status:    "Warning",
+		Message:   "Only 59 are healthy out of total 100",
+		Timestamp: now,
+		Times:     2,
+		Labels:    appLabels,
+	}
+	assert.Equal(t, expectedPayload, payload)
+}
+
+func TestWebhookURLsOverridenFromAppLabels(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer server.Close()
+
+	appLabels := make(map[string]string)
+	appLabels["alerts.webhook.urls"] = server.URL + "/app"
+	webhook := Webhook{URLs: server.URL + "/global"}
+	webhook.Notify(checks.AppCheck{App: "/foo", Result: checks.Critical, Labels: appLabels})
+
+	assert.Equal(t, []string{"/app"}, paths)
+}
+
+func TestWebhookPostsToEveryDestinationOnItsOwn(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer server.Close()
+
+	webhook := Webhook{URLs: server.URL + "/one,," + server.URL + "/two"}
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical}
+	assert.Equal(t, []string{server.URL + "/one", server.URL + "/two"}, webhook.Destinations(check))
+	assert.NoError(t, webhook.NotifyDestination(check, server.URL+"/two"))
+	assert.Equal(t, []string{"/two"}, paths)
+
+	assert.Len(t, (&Webhook{}).Destinations(check), 0)
+}
+
+func TestWebhookFailsOn5xx(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	webhook := Webhook{}
+	err := webhook.post(server.URL, []byte("{}"))
+	assert.EqualError(t, err, "Got 502 from "+server.URL)
+	assert.False(t, IsPermanent(err))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestWebhookFailsPermanentlyOn4xx(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	webhook := Webhook{}
+	err := webhook.post(server.URL, []byte("{}"))
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestWebhookNotifyReturnsTheFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	webhook := Webhook{URLs: server.URL}
+	err := webhook.Notify(checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical})
+	assert.EqualError(t, err, "Got 400 from "+server.URL)
+}
+
+func TestWebhookIsRoutableByName(t *testing.T) {
+	allRoutes, err := routes.ParseRoutes("*/critical/webhook")
+	assert.NoError(t, err)
+	webhook := Webhook{}
+	assert.True(t, allRoutes[0].MatchNotifier(webhook.Name()))
+	assert.False(t, allRoutes[0].MatchNotifier((&Slack{}).Name()))
+}
+
+func TestParseWebhookHeaders(t *testing.T) {
+	headers, err := ParseWebhookHeaders([]string{"X-Token: abc", "Authorization:Bearer a:b"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"X-Token": "abc", "Authorization": "Bearer a:b"}, headers)
+
+	_, err = ParseWebhookHeaders([]string{"no-separator"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/rcrowley/go-metrics"
+)
+
+const PrometheusNamespace = "marathon_alerts"
+
+var invalidPrometheusChars = regexp.MustCompile("[^a-zA-Z0-9_]+")
+var prometheusQuantiles = []float64{0.5, 0.75, 0.95, 0.99}
+
+// WritePrometheusMetrics writes every metric in the registry in Prometheus' text
+// exposition format. Metric names are prefixed with the namespace and every char
+// Prometheus doesn't allow in a name is replaced with `_`. Of the metrics that end
+// up with the same name, like `/foo-bar` and `/foo/bar`, only the first is written.
+func WritePrometheusMetrics(w io.Writer, namespace string, registry metrics.Registry) {
+	writePrometheusMetrics(w, namespace, registry, "")
+}
+
+// WritePrometheusDebugMetrics writes the metrics of the DebugMetricsRegistry like
+// WritePrometheusMetrics, with DebugMetricsPrefix in the namespace rather than in
+// front of every name, like `marathon_alerts_debug_apps_checker_alerts_sent`
+func WritePrometheusDebugMetrics(w io.Writer, namespace string, registry metrics.Registry) {
+	writePrometheusMetrics(w, namespace+"_"+DebugMetricsPrefix, registry, DebugMetricsPrefix)
+}
+
+func writePrometheusMetrics(w io.Writer, namespace string, registry metrics.Registry, trimPrefix string) {
+	all := make(map[string]interface{})
+	registry.Each(func(name string, metric interface{}) {
+		all[strings.TrimPrefix(name, trimPrefix)] = metric
+	})
+	var names []string
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	written := make(map[string]bool)
+	for _, name := range names {
+		promName := prometheusName(namespace, name)
+		if written[promName] {
+			continue
+		}
+		written[promName] = true
+		switch metric := all[name].(type) {
+		case metrics.Counter:
+			writePrometheusValue(w, promName, "counter", float64(metric.Count()))
+		case metrics.Gauge:
+			writePrometheusValue(w, promName, "gauge", float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			writePrometheusValue(w, promName, "gauge", metric.Value())
+		case metrics.Meter:
+			m := metric.Snapshot()
+			writePrometheusValue(w, promName+"_count", "counter", float64(m.Count()))
+			writePrometheusValue(w, promName+"_rate1", "gauge", m.Rate1())
+			writePrometheusValue(w, promName+"_rate5", "gauge", m.Rate5())
+			writePrometheusValue(w, promName+"_rate15", "gauge", m.Rate15())
+			writePrometheusValue(w, promName+"_rate_mean", "gauge", m.RateMean())
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			writePrometheusSummary(w, promName, h.Percentiles(prometheusQuantiles), float64(h.Sum()), h.Count(), 1)
+		case metrics.Timer:
+			t := metric.Snapshot()
+			writePrometheusSummary(w, promName+"_seconds", t.Percentiles(prometheusQuantiles), float64(t.Sum()), t.Count(), float64(time.Second))
+		}
+	}
+}
+
+// WritePrometheusCheckStatus writes the current status of every app and check as
+// a gauge - 0 for Pass, 1 for Warning and 2 for Critical. Checks from a named
+// cluster also have a cluster label.
+func WritePrometheusCheckStatus(w io.Writer, namespace string, allChecks []checks.AppCheck) {
+	name := namespace + "_check_status"
+	fmt.Fprintf(w, "# HELP %s Current status of the check for the app, 0 - Pass, 1 - Warning, 2 - Critical\n", name)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	for _, check := range allChecks {
+		labels := fmt.Sprintf("app=\"%s\",check=\"%s\"", escapePrometheusLabel(check.App), escapePrometheusLabel(check.CheckName))
+		if check.Cluster != "" {
+			labels = fmt.Sprintf("cluster=\"%s\",%s", escapePrometheusLabel(check.Cluster), labels)
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", name, labels, prometheusCheckStatus(check.Result))
+	}
+}
+
+func prometheusCheckStatus(result checks.CheckStatus) int {
+	switch result {
+	case checks.Warning:
+		return 1
+	case checks.Critical:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func writePrometheusValue(w io.Writer, name, metricType string, value float64) {
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+	fmt.Fprintf(w, "%s %v\n", name, value)
+}
+
+func writePrometheusSummary(w io.Writer, name string, quantiles []float64, sum float64, count int64, unit float64) {
+	fmt.Fprintf(w, "# TYPE %s summary\n", name)
+	for i, quantile := range prometheusQuantiles {
+		fmt.Fprintf(w, "%s{quantile=\"%v\"} %v\n", name, quantile, quantiles[i]/unit)
+	}
+	fmt.Fprintf(w, "%s_sum %v\n", name, sum/unit)
+	fmt.Fprintf(w, "%s_count %d\n", name, count)
+}
+
+func prometheusName(namespace, name string) string {
+	return namespace + "_" + strings.Trim(invalidPrometheusChars.ReplaceAllString(name, "_"), "_")
+}
+
+func escapePrometheusLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
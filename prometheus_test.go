@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePrometheusMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("notifications-total", registry).Inc(3)
+	metrics.GetOrRegisterGauge("apps", registry).Update(7)
+	metrics.GetOrRegisterTimer("marathon-all-apps-response-time", registry).Update(2 * time.Second)
+
+	var out bytes.Buffer
+	WritePrometheusMetrics(&out, "marathon_alerts", registry)
+	output := out.String()
+
+	assert.Contains(t, output, "# TYPE marathon_alerts_apps gauge\nmarathon_alerts_apps 7\n")
+	assert.Contains(t, output, "# TYPE marathon_alerts_notifications_total counter\nmarathon_alerts_notifications_total 3\n")
+	assert.Contains(t, output, "# TYPE marathon_alerts_marathon_all_apps_response_time_seconds summary\n")
+	assert.Contains(t, output, "marathon_alerts_marathon_all_apps_response_time_seconds{quantile=\"0.5\"} 2\n")
+	assert.Contains(t, output, "marathon_alerts_marathon_all_apps_response_time_seconds_sum 2\n")
+	assert.Contains(t, output, "marathon_alerts_marathon_all_apps_response_time_seconds_count 1\n")
+}
+
+func TestWritePrometheusMetricsForMeters(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterMeter("notifications-rate", registry).Mark(2)
+
+	var out bytes.Buffer
+	WritePrometheusMetrics(&out, "marathon_alerts", registry)
+	assert.Contains(t, out.String(), "marathon_alerts_notifications_rate_count 2\n")
+	assert.Contains(t, out.String(), "# TYPE marathon_alerts_notifications_rate_rate1 gauge\n")
+}
+
+func TestWritePrometheusMetricsSkipsNamesThatCollide(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("apps-checker-app-/foo-bar", registry).Inc(1)
+	metrics.GetOrRegisterCounter("apps-checker-app-/foo/bar", registry).Inc(2)
+
+	var out bytes.Buffer
+	WritePrometheusMetrics(&out, "marathon_alerts", registry)
+	assert.Equal(t, 1, strings.Count(out.String(), "# TYPE marathon_alerts_apps_checker_app_foo_bar counter\n"))
+	assert.Contains(t, out.String(), "marathon_alerts_apps_checker_app_foo_bar 1\n")
+	assert.NotContains(t, out.String(), "marathon_alerts_apps_checker_app_foo_bar 2\n")
+}
+
+func TestWritePrometheusCheckStatus(t *testing.T) {
+	allChecks := []checks.AppCheck{
+		checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Pass},
+		checks.AppCheck{App: "/foo", CheckName: "suspended", Result: checks.Critical},
+		checks.AppCheck{App: "/bar\"baz", CheckName: "min-instances", Result: checks.Warning},
+		checks.AppCheck{Cluster: "prod", App: "/foo", CheckName: "min-healthy", Result: checks.Critical},
+	}
+
+	var out bytes.Buffer
+	WritePrometheusCheckStatus(&out, "marathon_alerts", allChecks)
+	output := out.String()
+	assert.Contains(t, output, "# TYPE marathon_alerts_check_status gauge\n")
+	assert.Contains(t, output, "marathon_alerts_check_status{app=\"/foo\",check=\"min-healthy\"} 0\n")
+	assert.Contains(t, output, "marathon_alerts_check_status{app=\"/foo\",check=\"suspended\"} 2\n")
+	assert.Contains(t, output, "marathon_alerts_check_status{app=\"/bar\\\"baz\",check=\"min-instances\"} 1\n")
+	assert.Contains(t, output, "marathon_alerts_check_status{cluster=\"prod\",app=\"/foo\",check=\"min-healthy\"} 2\n")
+}
+
+func TestPrometheusName(t *testing.T) {
+	assert.Equal(t, "marathon_alerts_apps_checker_app_foo_bar", prometheusName("marathon_alerts", "apps-checker-app-/foo/bar"))
+	assert.Equal(t, "marathon_alerts_debug_alerts_manager_stopped", prometheusName("marathon_alerts", "debug.alerts-manager-stopped"))
+}
+
+func TestWritePrometheusDebugMetrics(t *testing.T) {
+	registry := metrics.NewPrefixedRegistry(DebugMetricsPrefix)
+	metrics.GetOrRegisterCounter("apps-checker-alerts-sent", registry).Inc(3)
+
+	var out bytes.Buffer
+	WritePrometheusDebugMetrics(&out, "marathon_alerts", registry)
+	assert.Contains(t, out.String(), "marathon_alerts_debug_apps_checker_alerts_sent 3\n")
+}
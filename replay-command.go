@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ashwanthkumar/marathon-alerts/deadletter"
+	"github.com/ashwanthkumar/marathon-alerts/notifiers"
+	flag "github.com/spf13/pflag"
+)
+
+// runReplayCommand is `marathon-alerts replay`, which sends the notifications in the
+// dead letter file again with the notifiers of the same config and flags. The ones
+// that fail again are written back to it. It returns the exit code.
+func runReplayCommand(args []string, output io.Writer) int {
+	flags := flag.NewFlagSet("marathon-alerts replay", flag.ContinueOnError)
+	flags.SetOutput(output)
+	defineFlags(flags)
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	config, err := LoadConfig(configFile, flags)
+	if err != nil {
+		fmt.Fprintf(output, "%v\n", err)
+		return 2
+	}
+	if config.Dispatch.DeadLetterFile == "" {
+		fmt.Fprintln(output, "Expected dispatch.dead-letter-file (or --dead-letter-file) to be set")
+		return 2
+	}
+
+	deadLetters := &deadletter.Log{Path: config.Dispatch.DeadLetterFile}
+	sent, failed := replay(deadLetters, config.BuildNotifiers(), output)
+	if failed < 0 {
+		return 1
+	}
+	fmt.Fprintf(output, "Sent %d notifications, %d failed again and are back in %s\n", sent, failed, deadLetters.Path)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// replay sends the letters to the notifiers they were for, failed is -1 when the
+// letters couldn't be taken out of the log
+func replay(deadLetters *deadletter.Log, allNotifiers []notifiers.Notifier, output io.Writer) (sent, failed int) {
+	letters, err := deadLetters.Take()
+	if err != nil {
+		fmt.Fprintf(output, "%v\n", err)
+		return 0, -1
+	}
+	notifiersByName := make(map[string]notifiers.Notifier)
+	for _, notifier := range allNotifiers {
+		notifiersByName[notifier.Name()] = notifier
+	}
+
+	for _, letter := range letters {
+		letter.Attempts++
+		notifier, present := notifiersByName[letter.Notifier]
+		if letter.Check == nil && letter.Digest == nil {
+			err = fmt.Errorf("Letter has neither a check nor a digest")
+		} else if present {
+			err = notification{notifier: notifier, check: letter.Check, digest: letter.Digest, destination: letter.Destination}.send()
+		} else {
+			err = fmt.Errorf("Notifier %s isn't configured", letter.Notifier)
+		}
+		if err == nil {
+			sent++
+			continue
+		}
+		failed++
+		fmt.Fprintf(output, "Unable to notify %s - %v\n", letter.Notifier, err)
+		letter.Error = err.Error()
+		err = deadLetters.Append(letter)
+		if err != nil {
+			fmt.Fprintf(output, "Unable to write it back to %s, it's lost - %v\n", deadLetters.Path, err)
+		}
+	}
+	return sent, failed
+}
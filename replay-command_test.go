@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/ashwanthkumar/marathon-alerts/deadletter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayCommand(t *testing.T) {
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer server.Close()
+	deadLetters := testDeadLetters(t)
+	defer os.RemoveAll(path.Dir(deadLetters.Path))
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy", Result: checks.Critical}
+	assert.NoError(t, deadLetters.Append(deadletter.Letter{Notifier: "webhook", Check: &check, Error: "Timed out after 30s", Attempts: 4, FailedAt: time.Now()}))
+	assert.NoError(t, deadLetters.Append(deadletter.Letter{Notifier: "team-a-slack", Check: &check, Error: "Timed out after 30s", Attempts: 4, FailedAt: time.Now()}))
+
+	var output bytes.Buffer
+	exitCode := runReplayCommand([]string{"--uri", "http://marathon:8080", "--webhook-url", server.URL, "--dead-letter-file", deadLetters.Path}, &output)
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 1, received)
+	assert.Contains(t, output.String(), "Sent 1 notifications, 1 failed again")
+
+	letters, err := deadLetters.Take()
+	assert.NoError(t, err)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "team-a-slack", letters[0].Notifier)
+	assert.Equal(t, "Notifier team-a-slack isn't configured", letters[0].Error)
+	assert.Equal(t, 5, letters[0].Attempts)
+
+	exitCode = runReplayCommand([]string{"--uri", "http://marathon:8080"}, &output)
+	assert.Equal(t, 2, exitCode)
+}
@@ -2,6 +2,8 @@ package routes
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/ashwanthkumar/marathon-alerts/checks"
@@ -17,16 +19,47 @@ var DefaultRoutes = "*/warning/*;*/critical/*;*/resolved/*"
 // Ex. min-healthy/warning/slack
 // The default Route(s) are of the form
 // 	`*/warning/*` and `*/critical/*` and `*/resolved/*`
+// Routes can be qualified further with `?key=value&key=value`
+// Ex. */critical/pagerduty?cluster=prod-*
+// Ex. */critical/pagerduty?app=/payments/*&label.team=payments&priority=10&stop
 type Route struct {
 	Check      string
 	CheckLevel checks.CheckStatus
 	Notifier   string
+	// Cluster is matched against the cluster of the check, matches all if empty
+	Cluster string
+	// App is matched against the app ID, matches all if empty
+	App string
+	// Labels are matched against the labels of the app, all of them have to match
+	Labels map[string]string
+	// Priority orders the routes, the higher ones are matched first
+	Priority int
+	// Stop ends the routing at this route when it matches, the rest are skipped
+	Stop bool
 }
 
 func (r *Route) Match(check checks.AppCheck) bool {
 	nameMatches := glob.Glob(r.Check, check.CheckName)
 	checkLevelMatches := r.CheckLevel == check.Result
-	return nameMatches && checkLevelMatches
+	return nameMatches && checkLevelMatches && r.MatchCluster(check.Cluster) && r.MatchApp(check.App) && r.MatchLabels(check.Labels)
+}
+
+func (r *Route) MatchCluster(cluster string) bool {
+	return r.Cluster == "" || glob.Glob(r.Cluster, cluster)
+}
+
+func (r *Route) MatchApp(app string) bool {
+	return r.App == "" || glob.Glob(r.App, app)
+}
+
+// MatchLabels matches the label globs against the labels, a missing label is empty
+func (r *Route) MatchLabels(labels map[string]string) bool {
+	for key, value := range r.Labels {
+		if !glob.Glob(value, labels[key]) {
+			return false
+		}
+	}
+	return true
 }
 
 func (r *Route) MatchNotifier(notifier string) bool {
@@ -37,6 +70,36 @@ func (r *Route) MatchCheckResult(level checks.CheckStatus) bool {
 	return r.CheckLevel == level
 }
 
+// Matching returns the routes that match the check, in order, up to the first one
+// that stops
+func Matching(allRoutes []Route, check checks.AppCheck) []Route {
+	var matching []Route
+	for _, route := range allRoutes {
+		if route.Match(check) {
+			matching = append(matching, route)
+			if route.Stop {
+				break
+			}
+		}
+	}
+	return matching
+}
+
+// Extend returns the routes of an app given the routing table and the routes in its
+// alerts.routes label. The app's routes override the table, or are added to it
+// when they start with a `+`.
+func Extend(table, appRoutes string) string {
+	if appRoutes == "" {
+		return table
+	}
+	if strings.HasPrefix(appRoutes, "+") {
+		return table + ";" + strings.TrimPrefix(appRoutes, "+")
+	}
+	return appRoutes
+}
+
+// ParseRoutes parses the routes and orders them by their priority, routes of the
+// same priority stay in the order they're in
 func ParseRoutes(routes string) ([]Route, error) {
 	var finalRoutes []Route
 	routesAsString := strings.Split(routes, ";")
@@ -44,24 +107,71 @@ func ParseRoutes(routes string) ([]Route, error) {
 		if routes != "" && routeAsString == "" {
 			continue
 		}
-		segments := strings.Split(routeAsString, "/")
+		parts := strings.SplitN(routeAsString, "?", 2)
+		segments := strings.Split(parts[0], "/")
 		if len(segments) != 3 {
 			return nil, fmt.Errorf("Expected 3 parts in %s, separated by `/` but %d found", routeAsString, len(segments))
 		}
 		checkLevel, err := parseCheckLevel(segments[1])
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("Invalid check level %q in route %s - %v", segments[1], routeAsString, err)
 		}
 		route := Route{
 			Check:      segments[0],
 			CheckLevel: checkLevel,
 			Notifier:   segments[2],
 		}
+		if len(parts) == 2 {
+			err = parseQualifiers(&route, parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid qualifier in route %s - %v", routeAsString, err)
+			}
+		}
 		finalRoutes = append(finalRoutes, route)
 	}
+	sort.Stable(routesByPriority(finalRoutes))
 	return finalRoutes, nil
 }
 
+type routesByPriority []Route
+
+func (r routesByPriority) Len() int           { return len(r) }
+func (r routesByPriority) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r routesByPriority) Less(i, j int) bool { return r[i].Priority > r[j].Priority }
+
+func parseQualifiers(route *Route, qualifiers string) error {
+	for _, qualifier := range strings.Split(qualifiers, "&") {
+		if qualifier == "stop" {
+			route.Stop = true
+			continue
+		}
+		keyValue := strings.SplitN(qualifier, "=", 2)
+		if len(keyValue) != 2 {
+			return fmt.Errorf("Expected qualifier of the form key=value but %s found", qualifier)
+		}
+		switch key := keyValue[0]; {
+		case key == "cluster":
+			route.Cluster = keyValue[1]
+		case key == "app":
+			route.App = keyValue[1]
+		case key == "priority":
+			priority, err := strconv.Atoi(keyValue[1])
+			if err != nil {
+				return fmt.Errorf("Expected priority to be a number but %s found", keyValue[1])
+			}
+			route.Priority = priority
+		case strings.HasPrefix(key, "label.") && len(key) > len("label."):
+			if route.Labels == nil {
+				route.Labels = make(map[string]string)
+			}
+			route.Labels[strings.TrimPrefix(key, "label.")] = keyValue[1]
+		default:
+			return fmt.Errorf("Expected one of cluster / app / label.<name> / priority / stop as the qualifier but %s found", key)
+		}
+	}
+	return nil
+}
+
 func parseCheckLevel(checkLevel string) (checks.CheckStatus, error) {
 	switch strings.ToLower(checkLevel) {
 	case "warning":
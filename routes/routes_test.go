@@ -179,6 +179,95 @@ func TestRouteMatchCheckResult(t *testing.T) {
 	assert.False(t, route.MatchCheckResult(checks.Pass))
 }
 
+func TestParseRoutesWithClusterQualifier(t *testing.T) {
+	routes, err := ParseRoutes("*/critical/pagerduty?cluster=prod-*;*/warning/slack")
+	assert.NoError(t, err)
+	assert.Len(t, routes, 2)
+	expectedRoute := Route{
+		Check:      "*",
+		CheckLevel: checks.Critical,
+		Notifier:   "pagerduty",
+		Cluster:    "prod-*",
+	}
+	assert.Equal(t, expectedRoute, routes[0])
+	assert.Equal(t, "", routes[1].Cluster)
+}
+
+func TestParseRoutesWithInvalidQualifiers(t *testing.T) {
+	_, err := ParseRoutes("*/critical/pagerduty?cluster")
+	assert.EqualError(t, err, "Invalid qualifier in route */critical/pagerduty?cluster - Expected qualifier of the form key=value but cluster found")
+	_, err = ParseRoutes("*/warning/slack;*/critical/pagerduty?datacenter=dc1")
+	assert.EqualError(t, err, "Invalid qualifier in route */critical/pagerduty?datacenter=dc1 - Expected one of cluster / app / label.<name> / priority / stop as the qualifier but datacenter found")
+	_, err = ParseRoutes("*/critical/pagerduty?priority=high")
+	assert.EqualError(t, err, "Invalid qualifier in route */critical/pagerduty?priority=high - Expected priority to be a number but high found")
+	_, err = ParseRoutes("*/warning/slack;*/blahblah/pagerduty")
+	assert.EqualError(t, err, "Invalid check level \"blahblah\" in route */blahblah/pagerduty - Expected one of warning / critical / pass / resolved but blahblah found")
+}
+
+func TestParseRoutesWithAppLabelPriorityAndStop(t *testing.T) {
+	routes, err := ParseRoutes("*/critical/slack;*/critical/pagerduty?app=/payments/*&label.team=payments&priority=10&stop")
+	assert.NoError(t, err)
+	assert.Len(t, routes, 2)
+	expectedRoute := Route{
+		Check:      "*",
+		CheckLevel: checks.Critical,
+		Notifier:   "pagerduty",
+		App:        "/payments/*",
+		Labels:     map[string]string{"team": "payments"},
+		Priority:   10,
+		Stop:       true,
+	}
+	// The higher priority comes first
+	assert.Equal(t, expectedRoute, routes[0])
+	assert.Equal(t, "slack", routes[1].Notifier)
+}
+
+func TestRouteMatchAppAndLabels(t *testing.T) {
+	route := Route{
+		Check:      "*",
+		CheckLevel: checks.Critical,
+		App:        "/payments/*",
+		Labels:     map[string]string{"team": "pay*"},
+	}
+	labels := map[string]string{"team": "payments"}
+	assert.True(t, route.Match(checks.AppCheck{App: "/payments/api", CheckName: "min-healthy", Result: checks.Critical, Labels: labels}))
+	assert.False(t, route.Match(checks.AppCheck{App: "/search/api", CheckName: "min-healthy", Result: checks.Critical, Labels: labels}))
+	assert.False(t, route.Match(checks.AppCheck{App: "/payments/api", CheckName: "min-healthy", Result: checks.Critical}))
+}
+
+func TestMatchingStopsAtTheFirstRouteThatStops(t *testing.T) {
+	routes, err := ParseRoutes("*/critical/slack;*/critical/pagerduty?app=/payments/*&stop;*/critical/webhook")
+	assert.NoError(t, err)
+
+	matching := Matching(routes, checks.AppCheck{App: "/payments/api", CheckName: "min-healthy", Result: checks.Critical})
+	assert.Len(t, matching, 2)
+	assert.Equal(t, "pagerduty", matching[1].Notifier)
+
+	matching = Matching(routes, checks.AppCheck{App: "/search/api", CheckName: "min-healthy", Result: checks.Critical})
+	assert.Len(t, matching, 2)
+	assert.Equal(t, "webhook", matching[1].Notifier)
+}
+
+func TestExtend(t *testing.T) {
+	assert.Equal(t, DefaultRoutes, Extend(DefaultRoutes, ""))
+	assert.Equal(t, "*/critical/pagerduty", Extend(DefaultRoutes, "*/critical/pagerduty"))
+	assert.Equal(t, DefaultRoutes+";*/critical/pagerduty", Extend(DefaultRoutes, "+*/critical/pagerduty"))
+}
+
+func TestRouteMatchCluster(t *testing.T) {
+	route := Route{
+		Check:      "*",
+		CheckLevel: checks.Critical,
+		Cluster:    "prod-*",
+	}
+	assert.True(t, route.Match(checks.AppCheck{CheckName: "min-healthy", Result: checks.Critical, Cluster: "prod-east"}))
+	assert.False(t, route.Match(checks.AppCheck{CheckName: "min-healthy", Result: checks.Critical, Cluster: "staging"}))
+
+	route.Cluster = ""
+	assert.True(t, route.MatchCluster("staging"))
+	assert.True(t, route.MatchCluster(""))
+}
+
 func BenchmarkSimpleParseRoutes(b *testing.B) {
 	routeString := "min-healthy/warning/slack"
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+)
+
+// Snooze silences the notifications for a Cluster / App / CheckName combination
+// until a point in time. Empty Cluster matches every cluster, empty App every app and
+// empty CheckName every check, so a Snooze with none of them snoozes the entire
+// system, which is handy when doing maintenance of the mesos cluster.
+type Snooze struct {
+	ID        string    `json:"id"`
+	Cluster   string    `json:"cluster,omitempty"`
+	App       string    `json:"app,omitempty"`
+	CheckName string    `json:"check,omitempty"`
+	Reason    string    `json:"reason"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+	Until     time.Time `json:"until"`
+}
+
+func (s *Snooze) Matches(check checks.AppCheck) bool {
+	clusterMatches := s.Cluster == "" || s.Cluster == check.Cluster
+	appMatches := s.App == "" || s.App == check.App
+	checkMatches := s.CheckName == "" || s.CheckName == check.CheckName
+	return clusterMatches && appMatches && checkMatches
+}
+
+func (s *Snooze) IsActive(now time.Time) bool {
+	return now.Before(s.Until)
+}
+
+// Snoozer keeps track of all the active Snoozes. Checks are still evaluated and
+// tracked by AlertManager while they're snoozed, only the notifications are dropped.
+type Snoozer struct {
+	snoozes map[string]Snooze
+	// ended are the Snoozes that expired or were cancelled, till they're reported
+	ended []Snooze
+	mutex sync.Mutex
+}
+
+func NewSnoozer() *Snoozer {
+	return &Snoozer{snoozes: make(map[string]Snooze)}
+}
+
+// Snooze adds a new Snooze that lasts for the duration from now
+func (s *Snoozer) Snooze(snooze Snooze, duration time.Duration) (Snooze, error) {
+	if duration <= 0 {
+		return Snooze{}, fmt.Errorf("Expected a positive snooze duration but %v found", duration)
+	}
+	id, err := newID()
+	if err != nil {
+		return Snooze{}, err
+	}
+	snooze.ID = id
+	snooze.CreatedAt = time.Now()
+	snooze.Until = snooze.CreatedAt.Add(duration)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snoozes[snooze.ID] = snooze
+	return snooze, nil
+}
+
+// Cancel ends a Snooze before it expires, it tells if the Snooze was found
+func (s *Snoozer) Cancel(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snooze, present := s.snoozes[id]
+	if present {
+		s.ended = append(s.ended, snooze)
+	}
+	delete(s.snoozes, id)
+	return present
+}
+
+// Ended returns the Snoozes that expired or were cancelled since it was last called
+func (s *Snoozer) Ended() []Snooze {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.removeExpired()
+	ended := s.ended
+	s.ended = nil
+	return ended
+}
+
+// Active returns all the Snoozes which haven't expired yet, oldest first
+func (s *Snoozer) Active() []Snooze {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.removeExpired()
+	active := []Snooze{}
+	for _, snooze := range s.snoozes {
+		active = append(active, snooze)
+	}
+	sort.Sort(snoozesByCreatedAt(active))
+	return active
+}
+
+func (s *Snoozer) IsSnoozed(check checks.AppCheck) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.removeExpired()
+	for _, snooze := range s.snoozes {
+		if snooze.Matches(check) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Snoozer) removeExpired() {
+	now := time.Now()
+	for id, snooze := range s.snoozes {
+		if !snooze.IsActive(now) {
+			s.ended = append(s.ended, snooze)
+			delete(s.snoozes, id)
+		}
+	}
+}
+
+// newID returns a random ID for the snoozes and maintenance windows added through the API
+func newID() (string, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+type snoozesByCreatedAt []Snooze
+
+func (s snoozesByCreatedAt) Len() int           { return len(s) }
+func (s snoozesByCreatedAt) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s snoozesByCreatedAt) Less(i, j int) bool { return s[i].CreatedAt.Before(s[j].CreatedAt) }
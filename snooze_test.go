@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashwanthkumar/marathon-alerts/checks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnoozeMatches(t *testing.T) {
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy"}
+	everything := Snooze{}
+	app := Snooze{App: "/foo"}
+	appAndCheck := Snooze{App: "/foo", CheckName: "min-healthy"}
+	otherApp := Snooze{App: "/bar"}
+	otherCheck := Snooze{App: "/foo", CheckName: "suspended"}
+
+	assert.True(t, everything.Matches(check))
+	assert.True(t, app.Matches(check))
+	assert.True(t, appAndCheck.Matches(check))
+	assert.False(t, otherApp.Matches(check))
+	assert.False(t, otherCheck.Matches(check))
+}
+
+func TestSnoozeMatchesCluster(t *testing.T) {
+	check := checks.AppCheck{Cluster: "prod", App: "/foo", CheckName: "min-healthy"}
+	cluster := Snooze{Cluster: "prod"}
+	anyCluster := Snooze{App: "/foo"}
+	otherCluster := Snooze{Cluster: "staging", App: "/foo"}
+
+	assert.True(t, cluster.Matches(check))
+	assert.True(t, anyCluster.Matches(check))
+	assert.False(t, otherCluster.Matches(check))
+}
+
+func TestSnoozerSnoozeAndCancel(t *testing.T) {
+	snoozer := NewSnoozer()
+	check := checks.AppCheck{App: "/foo", CheckName: "min-healthy"}
+	assert.False(t, snoozer.IsSnoozed(check))
+
+	snooze, err := snoozer.Snooze(Snooze{App: "/foo", Reason: "deploying", Author: "ashwanthkumar"}, 1*time.Hour)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, snooze.ID)
+	assert.Equal(t, 1*time.Hour, snooze.Until.Sub(snooze.CreatedAt))
+	assert.True(t, snoozer.IsSnoozed(check))
+	assert.False(t, snoozer.IsSnoozed(checks.AppCheck{App: "/bar", CheckName: "min-healthy"}))
+	assert.Equal(t, []Snooze{snooze}, snoozer.Active())
+
+	assert.True(t, snoozer.Cancel(snooze.ID))
+	assert.False(t, snoozer.Cancel(snooze.ID))
+	assert.False(t, snoozer.IsSnoozed(check))
+	assert.Len(t, snoozer.Active(), 0)
+}
+
+func TestSnoozerDropsExpiredSnoozes(t *testing.T) {
+	snoozer := NewSnoozer()
+	snoozer.snoozes["expired"] = Snooze{ID: "expired", Until: time.Now().Add(-1 * time.Minute)}
+
+	assert.False(t, snoozer.IsSnoozed(checks.AppCheck{App: "/foo", CheckName: "min-healthy"}))
+	assert.Len(t, snoozer.Active(), 0)
+}
+
+func TestSnoozerReportsEndedSnoozesOnce(t *testing.T) {
+	snoozer := NewSnoozer()
+	snoozer.snoozes["expired"] = Snooze{ID: "expired", Until: time.Now().Add(-1 * time.Minute)}
+	cancelled, err := snoozer.Snooze(Snooze{App: "/foo"}, 1*time.Hour)
+	assert.NoError(t, err)
+	snoozer.Cancel(cancelled.ID)
+
+	ended := snoozer.Ended()
+	assert.Len(t, ended, 2)
+	assert.Equal(t, cancelled.ID, ended[0].ID)
+	assert.Equal(t, "expired", ended[1].ID)
+	assert.Len(t, snoozer.Ended(), 0)
+}
+
+func TestSnoozerRejectsNonPositiveDuration(t *testing.T) {
+	snoozer := NewSnoozer()
+	_, err := snoozer.Snooze(Snooze{}, 0)
+	assert.Error(t, err)
+}
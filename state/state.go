@@ -0,0 +1,110 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SchemaVersion is the version of Snapshot we write. Bump it when a field changes
+// meaning, and teach Load how to migrate the older versions.
+const SchemaVersion = 1
+
+// Snapshot is the AlertManager state we need to pick up where we left off after a restart
+type Snapshot struct {
+	Version     int                  `json:"version"`
+	AppSuppress map[string]time.Time `json:"appSuppress"`
+	AlertCount  map[string]int       `json:"alertCount"`
+	// Acks are keyed like AppSuppress, older snapshots don't have them
+	Acks map[string]Ack `json:"acks,omitempty"`
+	// OpenedOn is when the alerts in AppSuppress were opened, which stays put when
+	// their suppression is renewed. Older snapshots don't have it.
+	OpenedOn map[string]time.Time `json:"openedOn,omitempty"`
+}
+
+// Ack is someone telling us they're on an open alert
+type Ack struct {
+	By      string    `json:"by"`
+	Comment string    `json:"comment"`
+	At      time.Time `json:"at"`
+}
+
+// NewSnapshot returns an empty Snapshot of the current SchemaVersion
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		Version:     SchemaVersion,
+		AppSuppress: make(map[string]time.Time),
+		AlertCount:  make(map[string]int),
+		Acks:        make(map[string]Ack),
+		OpenedOn:    make(map[string]time.Time),
+	}
+}
+
+// Store persists the AlertManager state across restarts
+type Store interface {
+	// Load returns the last saved Snapshot, or an empty one if nothing was saved yet
+	Load() (*Snapshot, error)
+	Save(snapshot *Snapshot) error
+}
+
+// FileStore keeps the Snapshot as JSON in a local file. Every Save writes to a temp
+// file which is then renamed, so we never leave a half written state behind.
+type FileStore struct {
+	Path string
+}
+
+func (f *FileStore) Load() (*Snapshot, error) {
+	content, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return NewSnapshot(), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	snapshot := NewSnapshot()
+	err = json.Unmarshal(content, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse state from %s - %v", f.Path, err)
+	}
+	if snapshot.Version < 1 || snapshot.Version > SchemaVersion {
+		return nil, fmt.Errorf("Expected state version between 1 and %d in %s but %d found", SchemaVersion, f.Path, snapshot.Version)
+	}
+	if snapshot.AppSuppress == nil {
+		snapshot.AppSuppress = make(map[string]time.Time)
+	}
+	if snapshot.AlertCount == nil {
+		snapshot.AlertCount = make(map[string]int)
+	}
+	if snapshot.Acks == nil {
+		snapshot.Acks = make(map[string]Ack)
+	}
+	if snapshot.OpenedOn == nil {
+		snapshot.OpenedOn = make(map[string]time.Time)
+	}
+	return snapshot, nil
+}
+
+func (f *FileStore) Save(snapshot *Snapshot) error {
+	snapshot.Version = SchemaVersion
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(f.Path), filepath.Base(f.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(content)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), f.Path)
+}
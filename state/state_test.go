@@ -0,0 +1,78 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempStore(t *testing.T) (*FileStore, func()) {
+	dir, err := ioutil.TempDir("", "marathon-alerts-state")
+	assert.NoError(t, err)
+	return &FileStore{Path: filepath.Join(dir, "state.json")}, func() { os.RemoveAll(dir) }
+}
+
+func TestFileStoreLoadWhenNothingWasSaved(t *testing.T) {
+	store, cleanup := tempStore(t)
+	defer cleanup()
+
+	snapshot, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, NewSnapshot(), snapshot)
+}
+
+func TestFileStoreSaveAndLoad(t *testing.T) {
+	store, cleanup := tempStore(t)
+	defer cleanup()
+
+	suppressedOn := time.Date(2016, 3, 10, 15, 36, 4, 0, time.UTC)
+	snapshot := NewSnapshot()
+	snapshot.AppSuppress["/foo-check-name-2"] = suppressedOn
+	snapshot.AlertCount["/foo-check-name"] = 3
+	snapshot.Acks["/foo-check-name-2"] = Ack{By: "ashwanthkumar", Comment: "Looking into it", At: suppressedOn}
+	assert.NoError(t, store.Save(snapshot))
+
+	loaded, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion, loaded.Version)
+	assert.True(t, suppressedOn.Equal(loaded.AppSuppress["/foo-check-name-2"]))
+	assert.Equal(t, 3, loaded.AlertCount["/foo-check-name"])
+	assert.Equal(t, "ashwanthkumar", loaded.Acks["/foo-check-name-2"].By)
+
+	files, err := ioutil.ReadDir(filepath.Dir(store.Path))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestFileStoreLoadFailsForUnknownVersion(t *testing.T) {
+	store, cleanup := tempStore(t)
+	defer cleanup()
+
+	assert.NoError(t, ioutil.WriteFile(store.Path, []byte(`{"version": 99}`), 0644))
+	_, err := store.Load()
+	assert.Error(t, err)
+}
+
+func TestFileStoreLoadFailsForCorruptState(t *testing.T) {
+	store, cleanup := tempStore(t)
+	defer cleanup()
+
+	assert.NoError(t, ioutil.WriteFile(store.Path, []byte(`{"version": `), 0644))
+	_, err := store.Load()
+	assert.Error(t, err)
+}
+
+func TestFileStoreLoadFillsMissingFields(t *testing.T) {
+	store, cleanup := tempStore(t)
+	defer cleanup()
+
+	assert.NoError(t, ioutil.WriteFile(store.Path, []byte(`{"version": 1}`), 0644))
+	snapshot, err := store.Load()
+	assert.NoError(t, err)
+	assert.NotNil(t, snapshot.AppSuppress)
+	assert.NotNil(t, snapshot.AlertCount)
+}